@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/store"
+	"time"
+)
+
+type DeletionScheduledResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// DeleteAccount godoc
+//
+//	@Summary		Delete account
+//	@Description	Schedules the current account for deletion after a grace period. Logging in again cancels it
+//	@Tags			users
+//	@Produce		json
+//	@Success		202	{object}	DeletionScheduledResponse
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [delete]
+func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	at := time.Now().Add(app.config.profile.deletionGracePeriod).UTC().Truncate(time.Second)
+	if err := app.store.Users.ScheduleDeletion(ctx, user.ID, at); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.invalidateUserCache(ctx, user.ID)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, DeletionScheduledResponse{DeletionScheduledAt: at}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ExportAccount godoc
+//
+//	@Summary		Export account data
+//	@Description	Downloads a ZIP archive with all data stored about the current user as JSON files: the profile, posts with their attachments, comments
+//	@Description	on any post, follows, reactions, blocks, mutes and the metadata of every uploaded file. Comments others left on the user's posts are not included
+//	@Tags			users
+//	@Produce		application/zip
+//	@Success		200	{file}		file
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/export [get]
+func (app *application) exportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	export, err := app.store.Export.Export(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for i := range export.Media {
+		app.setMediaURLs(&export.Media[i])
+	}
+	for i := range export.Posts {
+		for j := range export.Posts[i].Attachments {
+			app.setMediaURLs(&export.Posts[i].Attachments[j])
+		}
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"posts.json", export.Posts},
+		{"comments.json", export.Comments},
+		{"followers.json", export.Followers},
+		{"following.json", export.Following},
+		{"reactions.json", export.Reactions},
+		{"blocks.json", export.Blocks},
+		{"mutes.json", export.Mutes},
+		{"media.json", export.Media},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="export-%d-%s.zip"`, user.ID, time.Now().Format("20060102")))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			app.logger.Errorw("failed to write export", "user", user.ID, "error", err)
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			app.logger.Errorw("failed to write export", "user", user.ID, "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		app.logger.Errorw("failed to write export", "user", user.ID, "error", err)
+	}
+}
+
+// purgeDeletedAccounts deletes the accounts whose deletion grace period is
+// over, along with their uploaded files. An account that fails to be deleted
+// does not hold up the others; it is retried on the next run.
+func (app *application) purgeDeletedAccounts(ctx context.Context) error {
+	ids, err := app.store.Users.GetDueForDeletion(ctx, time.Now(), 100)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range ids {
+		if err := app.purgeAccount(ctx, id); err != nil {
+			app.logger.Errorw("failed to delete account", "user", id, "error", err)
+			errs = append(errs, fmt.Errorf("user %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (app *application) purgeAccount(ctx context.Context, id int64) error {
+	keys, err := app.store.Media.GetKeysByUserID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := app.store.Users.Delete(ctx, id); err != nil {
+		return err
+	}
+	app.invalidateUserCache(ctx, id)
+
+	for _, key := range keys {
+		if err := app.blobStore.Delete(ctx, key); err != nil {
+			app.logger.Warnw("failed to delete blob of deleted account", "user", id, "key", key, "error", err)
+		}
+	}
+	app.logger.Infow("deleted account", "user", id)
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"project/internal/blob"
+	"project/internal/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deletingUserStore has users 1 to 3 due for deletion and fails to delete
+// user 2.
+type deletingUserStore struct {
+	store.MockUserStore
+	scheduledAt time.Time
+	deleted     []int64
+}
+
+func (s *deletingUserStore) ScheduleDeletion(ctx context.Context, id int64, at time.Time) error {
+	s.scheduledAt = at
+	return nil
+}
+
+func (s *deletingUserStore) GetDueForDeletion(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	return []int64{1, 2, 3}, nil
+}
+
+func (s *deletingUserStore) Delete(ctx context.Context, id int64) error {
+	if id == 2 {
+		return errors.New("connection lost")
+	}
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+// keyedMediaStore has one upload per user, stored under media/<user>.png.
+type keyedMediaStore struct {
+	failingMediaStore
+}
+
+func (s *keyedMediaStore) GetKeysByUserID(ctx context.Context, userID int64) ([]string, error) {
+	return []string{fmt.Sprintf("media/%d.png", userID)}, nil
+}
+
+type stubExportStore struct{}
+
+func (s *stubExportStore) Export(ctx context.Context, userID int64) (*store.UserExport, error) {
+	return &store.UserExport{
+		Profile:  &store.User{ID: userID, Username: "gopher"},
+		Posts:    []store.Post{{ID: 1, Title: "first", Attachments: []store.Media{{ID: 3, Key: "media/0/a.png"}}}},
+		Comments: []store.Comment{{ID: 2, PostID: 5, Content: "on another post"}},
+		Media:    []store.Media{{ID: 3, Key: "media/0/a.png"}},
+	}, nil
+}
+
+func TestAccountDeletion(t *testing.T) {
+	app := newTestApp(t, config{profile: profileConfig{deletionGracePeriod: 30 * 24 * time.Hour}})
+	users := &deletingUserStore{}
+	app.store.Users = users
+	app.store.Media = &keyedMediaStore{}
+	app.store.Export = &stubExportStore{}
+	root := t.TempDir()
+	blobStore, err := blob.NewLocalStore(root, "http://localhost:8080/v1/media/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobStore = blobStore
+	do := newTestClient(app, app.mount())
+
+	t.Run("should schedule the deletion after the grace period", func(t *testing.T) {
+		res := do(t, http.MethodDelete, "/v1/users/me", "")
+		checkResponseCode(t, http.StatusAccepted, res.StatusCode)
+		if d := time.Until(users.scheduledAt); d < 29*24*time.Hour || d > 30*24*time.Hour {
+			t.Errorf("expected the deletion in 30 days, got %s", users.scheduledAt)
+		}
+	})
+
+	t.Run("should export the data as JSON files", func(t *testing.T) {
+		res := do(t, http.MethodGet, "/v1/users/me/export", "")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string]string{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name] = string(content)
+		}
+		if len(files) != 9 {
+			t.Errorf("expected 9 files, got %d", len(files))
+		}
+		if !strings.Contains(files["posts.json"], "http://localhost:8080/v1/media/files/media/0/a.png") {
+			t.Errorf("expected the URLs of post attachments, got %s", files["posts.json"])
+		}
+		if !strings.Contains(files["comments.json"], "on another post") {
+			t.Errorf("expected the comments, got %s", files["comments.json"])
+		}
+	})
+
+	t.Run("should purge the other accounts when one fails", func(t *testing.T) {
+		for _, name := range []string{"1.png", "2.png", "3.png"} {
+			if err := os.MkdirAll(filepath.Join(root, "media"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(root, "media", name), []byte("png"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := app.purgeDeletedAccounts(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "user 2") {
+			t.Errorf("expected the failure of user 2 to be reported, got %v", err)
+		}
+		if len(users.deleted) != 2 || users.deleted[0] != 1 || users.deleted[1] != 3 {
+			t.Errorf("expected users 1 and 3 to be deleted, got %v", users.deleted)
+		}
+		for name, kept := range map[string]bool{"1.png": false, "2.png": true, "3.png": false} {
+			_, err := os.Stat(filepath.Join(root, "media", name))
+			if exists := err == nil; exists != kept {
+				t.Errorf("expected %s to be kept: %t, got %t", name, kept, exists)
+			}
+		}
+	})
+}
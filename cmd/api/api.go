@@ -15,9 +15,19 @@ import (
 	"os/signal"
 	"project/docs"
 	authoticator "project/internal/auth"
+	"project/internal/blob"
+	"project/internal/cursor"
+	"project/internal/digest"
+	"project/internal/events"
+	"project/internal/gateway"
+	"project/internal/mailer"
+	"project/internal/ranking"
 	"project/internal/ratelimiter"
 	"project/internal/store"
 	"project/internal/store/cache"
+	"project/internal/stream"
+	"project/internal/webhook"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -29,8 +39,19 @@ type application struct {
 	logger        *zap.SugaredLogger
 	authenticator authoticator.Authenticator
 	rateLimiter   ratelimiter.Limiter
+	mailer        mailer.Client
+	blobStore     blob.Store
+	cursors       *cursor.Codec
+	digestSigner  *digest.Signer
+	timelineJobs  chan timelineJob
+	ranker        ranking.Ranker
+	hub           stream.Hub
+	gateway       *gateway.Gateway
+	events        *events.Bus
+	webhookSender *webhook.Sender
 
-	//mailer mailer.Client
+	// jobs tracks the background jobs started by run
+	jobs sync.WaitGroup
 }
 
 type dbConfig struct {
@@ -47,9 +68,93 @@ type config struct {
 	apiURL string
 	mail   mailConfig
 	auth   authConfig
-	//frontendURL string
+
+	frontendURL string
 	redisConfig redisConfig
 	rateLimiter ratelimiter.Config
+	profile     profileConfig
+	upload      uploadConfig
+	search      searchConfig
+	trending    trendingConfig
+	timeline    timelineConfig
+	ranking     rankingConfig
+	stream      streamConfig
+	gateway     gateway.Config
+	digest      digestConfig
+	webhook     webhookConfig
+	events      events.Config
+	messages    messagesConfig
+	polls       pollsConfig
+}
+
+type streamConfig struct {
+	heartbeat time.Duration
+	hub       stream.Config
+}
+
+type rankingConfig struct {
+	// window is how old followed posts can be to be ranked
+	window time.Duration
+	// affinityWindow is how far back interactions count towards affinity
+	affinityWindow time.Duration
+	candidates     int
+	// popular is how many trending posts are ranked along followed ones
+	popular      int
+	maxPerAuthor int
+	halfLife     time.Duration
+	weights      rankingWeights
+}
+
+type rankingWeights struct {
+	recency        float64
+	engagement     float64
+	authorAffinity float64
+	tagAffinity    float64
+}
+
+// timelineConfig controls fan-out-on-write: new posts are pushed into the
+// cached timelines of the author's followers, except for authors with at
+// least largeAccountFollowers followers, whose posts are read on demand.
+type timelineConfig struct {
+	enabled               bool
+	largeAccountFollowers int64
+	workers               int
+	queueSize             int
+}
+
+type trendingConfig struct {
+	refreshInterval time.Duration
+	// size is how many tags and posts are ranked per window
+	size    int
+	weights store.TrendingWeights
+}
+
+type searchConfig struct {
+	// language is the Postgres text search configuration new posts are
+	// indexed with, e.g. "english"
+	language string
+}
+
+type uploadConfig struct {
+	maxBytes       int64
+	minDimension   int
+	maxDimension   int
+	maxPixels      int
+	thumbnailSize  int
+	avatarSize     int
+	maxAttachments int
+	blob           blobConfig
+}
+
+type blobConfig struct {
+	driver   string
+	localDir string
+	s3       blob.S3Config
+}
+
+type profileConfig struct {
+	usernameCooldown    time.Duration
+	deletionGracePeriod time.Duration
 }
 
 type redisConfig struct {
@@ -78,6 +183,14 @@ type basicConfig struct {
 type mailConfig struct {
 	exp       time.Duration
 	fromEmail string
+	smtp      smtpConfig
+}
+
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
 }
 
 //type mailTrapConfig struct {
@@ -99,6 +212,13 @@ func (app *application) run(mux http.Handler) error {
 		ReadTimeout:  10 * time.Second,
 		IdleTimeout:  time.Minute,
 	}
+	// Shutdown waits for requests to finish, which streams never do.
+	srv.RegisterOnShutdown(app.hub.Close)
+	srv.RegisterOnShutdown(app.gateway.Hub.Close)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	app.startBackgroundJobs(jobsCtx)
+
 	shutdown := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -118,6 +238,8 @@ func (app *application) run(mux http.Handler) error {
 	if err != nil {
 		return err
 	}
+	stopJobs()
+	app.jobs.Wait()
 	app.logger.Infof("server shutdown")
 	return nil
 }
@@ -130,54 +252,200 @@ func (app *application) mount() http.Handler {
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"'http://localhost:3050'"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Last-Event-ID"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 	r.Use(app.RateLimiterMiddleware)
-	r.Use(middleware.Timeout(60 * time.Second))
 	r.Route("/v1", func(r chi.Router) {
-		//r.With(app.BasicAuthMiddleWare()).Get("/health", app.healthCheckHandler)
-		r.Get("/health", app.healthCheckHandler)
-		r.With(app.BasicAuthMiddleWare()).Get("/metrics", expvar.Handler().ServeHTTP)
-		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
-		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
-
-		r.Route("/posts", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
-			r.Route("/{postId}", func(r chi.Router) {
-				r.Use(app.postsContextMiddleware)
-				r.Get("/", app.getPostHandler)
-				r.Delete("/", app.checkPostOwnership(
-					"admin", app.deletePostHandler))
-				r.Patch("/", app.checkPostOwnership(
-					"moderator", app.patchPostHandler))
+		// Streams stay open for as long as the client listens, so they are
+		// kept out of the request timeout.
+		r.With(app.AuthTokenMiddleware).Get("/stream", app.streamHandler)
+		r.With(app.AuthTokenMiddleware).Get("/ws", app.gatewayHandler)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(60 * time.Second))
+			//r.With(app.BasicAuthMiddleWare()).Get("/health", app.healthCheckHandler)
+			r.Get("/health", app.healthCheckHandler)
+			r.With(app.BasicAuthMiddleWare()).Get("/metrics", expvar.Handler().ServeHTTP)
+			docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
+			r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
+
+			r.With(app.AuthTokenMiddleware).Get("/media/files/*", app.serveMediaHandler)
+			r.With(app.AuthTokenMiddleware).Post("/media", app.uploadMediaHandler)
+
+			r.Route("/posts", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Post("/", app.createPostHandler)
+				r.Get("/search", app.searchPostsHandler)
+				r.Route("/{postId}", func(r chi.Router) {
+					r.Use(app.postsContextMiddleware)
+					r.Get("/", app.getPostHandler)
+					r.Delete("/", app.checkPostOwnership(
+						"admin", app.deletePostHandler))
+					r.Patch("/", app.checkPostOwnership(
+						"moderator", app.patchPostHandler))
+					r.Post("/comments", app.createCommentHandler)
+					r.Put("/reactions", app.reactToPostHandler)
+					r.Delete("/reactions", app.deleteReactionHandler)
+					r.Get("/poll", app.getPollHandler)
+					r.Post("/poll/votes", app.votePollHandler)
+					r.Put("/repost", app.repostHandler)
+					r.Delete("/repost", app.deleteRepostHandler)
+				})
 			})
-		})
 
-		r.Route("/users", func(r chi.Router) {
-			r.Put("/activate/{token}", app.activateUserHandler)
-			r.Route("/{userID}", func(r chi.Router) {
+			r.With(app.AuthTokenMiddleware).Get("/tags/{tag}/posts", app.getTagPostsHandler)
+
+			r.Route("/notifications", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unFollowUserHandler)
+				r.Get("/", app.getNotificationsHandler)
+				r.Get("/unread-count", app.getUnreadCountHandler)
+				r.Put("/read", app.markAllNotificationsReadHandler)
+				r.Put("/{notificationID}/read", app.markNotificationReadHandler)
+				r.Get("/preferences", app.getNotificationPreferencesHandler)
+				r.Patch("/preferences", app.updateNotificationPreferencesHandler)
+			})
 
+			r.Route("/conversations", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Post("/", app.startConversationHandler)
+				r.Get("/", app.getConversationsHandler)
+				r.Get("/unread-count", app.getUnreadMessagesHandler)
+				r.Route("/{conversationID}", func(r chi.Router) {
+					r.Get("/", app.getConversationHandler)
+					r.Get("/messages", app.getMessagesHandler)
+					r.Post("/messages", app.sendMessageHandler)
+					r.Put("/read", app.markConversationReadHandler)
+				})
 			})
-			r.Group(func(r chi.Router) {
+
+			r.Route("/lists", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/feed", app.getUserFeedHandler)
+				r.Post("/", app.createListHandler)
+				r.Get("/", app.getListsHandler)
+				r.Route("/{listID}", func(r chi.Router) {
+					r.Use(app.listsContextMiddleware)
+					r.Get("/", app.getListHandler)
+					r.Patch("/", app.updateListHandler)
+					r.Delete("/", app.deleteListHandler)
+					r.Get("/members", app.getListMembersHandler)
+					r.Put("/members/{userID}", app.addListMemberHandler)
+					r.Delete("/members/{userID}", app.removeListMemberHandler)
+					r.Get("/feed", app.getListFeedHandler)
+				})
 			})
 
-		})
-		r.Route("/authentication", func(r chi.Router) {
-			r.Post("/user", app.registerUserHandler)
-			r.Post("/token", app.createTokenHandler)
-		})
+			r.Route("/communities", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Post("/", app.createCommunityHandler)
+				r.Get("/", app.getCommunitiesHandler)
+				r.Route("/{communityID}", func(r chi.Router) {
+					r.Use(app.communitiesContextMiddleware)
+					r.Get("/", app.getCommunityHandler)
+					r.Patch("/", app.requireCommunityRole(
+						store.CommunityRoleOwner, app.updateCommunityHandler))
+					r.Delete("/", app.deleteCommunityHandler)
+					r.Put("/join", app.joinCommunityHandler)
+					r.Put("/leave", app.leaveCommunityHandler)
+					r.Get("/feed", app.getCommunityFeedHandler)
+					r.Get("/members", app.getCommunityMembersHandler)
+					r.Route("/members/{userID}", func(r chi.Router) {
+						r.Delete("/", app.requireCommunityRole(
+							store.CommunityRoleModerator, app.removeCommunityMemberHandler))
+						r.Put("/invite", app.requireCommunityRole(
+							store.CommunityRoleModerator, app.inviteCommunityMemberHandler))
+						r.Put("/approve", app.requireCommunityRole(
+							store.CommunityRoleModerator, app.approveCommunityMemberHandler))
+						r.Put("/role", app.requireCommunityRole(
+							store.CommunityRoleOwner, app.setCommunityRoleHandler))
+					})
+				})
+			})
+
+			r.Route("/reports", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Post("/", app.createReportHandler)
+			})
+
+			r.Route("/moderation", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireRole("moderator"))
+				r.Get("/reports", app.getReportsHandler)
+				r.Route("/reports/{reportID}", func(r chi.Router) {
+					r.Use(app.reportsContextMiddleware)
+					r.Get("/", app.getReportHandler)
+					r.Put("/claim", app.claimReportHandler)
+					r.Put("/resolve", app.resolveReportHandler)
+				})
+				r.Get("/actions", app.getModerationActionsHandler)
+			})
 
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Post("/", app.createWebhookHandler)
+				r.Get("/", app.getWebhooksHandler)
+				r.Patch("/{webhookID}", app.updateWebhookHandler)
+				r.Delete("/{webhookID}", app.deleteWebhookHandler)
+				r.Get("/{webhookID}/deliveries", app.getWebhookDeliveriesHandler)
+			})
+
+			r.Route("/trending", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Get("/tags", app.getTrendingTagsHandler)
+				r.Get("/posts", app.getTrendingPostsHandler)
+			})
+
+			r.Route("/users", func(r chi.Router) {
+				r.Put("/activate/{token}", app.activateUserHandler)
+				r.Put("/email/confirm/{token}", app.confirmEmailHandler)
+				r.Put("/digest/unsubscribe/{token}", app.unsubscribeDigestHandler)
+				r.Route("/me", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Patch("/", app.updateProfileHandler)
+					r.Delete("/", app.deleteAccountHandler)
+					r.Get("/export", app.exportAccountHandler)
+					r.Put("/avatar", app.uploadAvatarHandler)
+					r.Put("/privacy", app.updatePrivacyHandler)
+					r.Get("/follow-requests", app.getFollowRequestsHandler)
+					r.Put("/follow-requests/{requesterID}/approve", app.approveFollowRequestHandler)
+					r.Put("/follow-requests/{requesterID}/reject", app.rejectFollowRequestHandler)
+					r.Get("/blocks", app.getBlockedUsersHandler)
+					r.Get("/mutes", app.getMutedUsersHandler)
+					r.Get("/digest", app.getDigestSettingsHandler)
+					r.Put("/digest", app.updateDigestSettingsHandler)
+					r.Get("/messaging", app.getMessagingSettingsHandler)
+					r.Put("/messaging", app.updateMessagingSettingsHandler)
+				})
+				r.Route("/{userID}", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Get("/", app.getUserHandler)
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unFollowUserHandler)
+					r.Get("/followers", app.getFollowersHandler)
+					r.Get("/following", app.getFollowingHandler)
+					r.Get("/mutual", app.getMutualFollowHandler)
+					r.Put("/block", app.blockUserHandler)
+					r.Put("/unblock", app.unblockUserHandler)
+					r.Put("/mute", app.muteUserHandler)
+					r.Put("/unmute", app.unmuteUserHandler)
+					r.Get("/lists", app.getUserListsHandler)
+
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Get("/feed", app.getUserFeedHandler)
+					r.Get("/search", app.searchUsersHandler)
+				})
+
+			})
+			r.Route("/authentication", func(r chi.Router) {
+				r.Post("/user", app.registerUserHandler)
+				r.Post("/token", app.createTokenHandler)
+			})
+		})
 	})
 
 	return r
@@ -152,6 +152,15 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
+	// logging in during the grace period keeps the account
+	if user.DeletionScheduledAt != nil {
+		if err := app.store.Users.CancelDeletion(r.Context(), user.ID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.invalidateUserCache(r.Context(), user.ID)
+	}
+
 	claims := jwt.MapClaims{
 		"sub": user.ID,
 		"exp": time.Now().Add(app.config.auth.token.expiry).Unix(),
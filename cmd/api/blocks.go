@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/store"
+	"strconv"
+)
+
+// Block user godoc
+//
+//	@Summary		Block user
+//	@Description	Blocks a user by ID, removing follow relationships in both directions
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		204	{object}	nil
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.userRelationHandler(w, r, app.store.Blocks.Block)
+}
+
+// Unblock user godoc
+//
+//	@Summary		Unblock user
+//	@Description	Unblocks a user by ID
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		204	{object}	nil
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/unblock [put]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.userRelationHandler(w, r, app.store.Blocks.Unblock)
+}
+
+// Mute user godoc
+//
+//	@Summary		Mute user
+//	@Description	Mutes a user by ID, hiding their posts and comments from you
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		204	{object}	nil
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.userRelationHandler(w, r, app.store.Mutes.Mute)
+}
+
+// Unmute user godoc
+//
+//	@Summary		Unmute user
+//	@Description	Unmutes a user by ID
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		204	{object}	nil
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/unmute [put]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.userRelationHandler(w, r, app.store.Mutes.Unmute)
+}
+
+func (app *application) userRelationHandler(w http.ResponseWriter, r *http.Request, apply func(context.Context, int64, int64) error) {
+	targetID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if err := apply(r.Context(), user.ID, targetID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get blocked users godoc
+//
+//	@Summary		Fetches blocked users
+//	@Description	Fetches the users blocked by the current user
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.BlockedUser
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks [get]
+func (app *application) getBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	app.blockedUsersList(w, r, app.store.Blocks.GetBlocked)
+}
+
+// Get muted users godoc
+//
+//	@Summary		Fetches muted users
+//	@Description	Fetches the users muted by the current user
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.BlockedUser
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mutes [get]
+func (app *application) getMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	app.blockedUsersList(w, r, app.store.Mutes.GetMuted)
+}
+
+func (app *application) blockedUsersList(w http.ResponseWriter, r *http.Request,
+	list func(context.Context, int64, store.PaginationQuery) ([]store.BlockedUser, error)) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	users, err := list(r.Context(), user.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"project/internal/store"
+	"testing"
+)
+
+// stubRelationStore blocks and mutes users, failing with err, and reports
+// whether the test user and others blocked each other with blocked.
+type stubRelationStore struct {
+	store.MockBlockStore
+	store.MockMuteStore
+	blocked bool
+	err     error
+}
+
+func (s *stubRelationStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return s.err
+}
+
+func (s *stubRelationStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	return s.err
+}
+
+func (s *stubRelationStore) IsBlocked(ctx context.Context, a, b int64) (bool, error) {
+	return s.blocked, nil
+}
+
+func (s *stubRelationStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	return s.err
+}
+
+func TestBlocks(t *testing.T) {
+	app := newTestApp(t, config{})
+	relations := &stubRelationStore{}
+	mockStore := app.store
+	mockStore.Blocks = relations
+	mockStore.Mutes = relations
+	app.store = mockStore
+	do := newTestClient(app, app.mount())
+
+	t.Run("should block and mute users", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/1/block", "").StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/1/mute", "").StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/1/unblock", "").StatusCode)
+	})
+
+	t.Run("should report missing blocks and mutes", func(t *testing.T) {
+		relations.err = store.ErrNotFound
+		defer func() { relations.err = nil }()
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodPut, "/v1/users/1/unblock", "").StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodPut, "/v1/users/1/unmute", "").StatusCode)
+
+		relations.err = store.ErrConflict
+		checkResponseCode(t, http.StatusConflict, do(t, http.MethodPut, "/v1/users/1/block", "").StatusCode)
+	})
+
+	t.Run("should hide blocked users from each other", func(t *testing.T) {
+		relations.blocked = true
+		defer func() { relations.blocked = false }()
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodGet, "/v1/users/1", "").StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodGet, "/v1/users/1/mutual", "").StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodGet, "/v1/users/1/followers", "").StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodGet, "/v1/users/1/following", "").StatusCode)
+	})
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/store"
+	"strconv"
+)
+
+type communityKey string
+
+const communityCtx communityKey = "community"
+
+type CreateCommunityPayload struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+	JoinPolicy  string `json:"join_policy" validate:"omitempty,oneof=open approval invite"`
+}
+
+type UpdateCommunityPayload struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=1000"`
+	JoinPolicy  *string `json:"join_policy" validate:"omitempty,oneof=open approval invite"`
+}
+
+type SetCommunityRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=member moderator"`
+}
+
+// CommunityWithMembership is a community along with the membership of the
+// current user, if any.
+type CommunityWithMembership struct {
+	store.Community
+	Membership *store.CommunityMember `json:"membership"`
+}
+
+type membershipStatus struct {
+	Status string `json:"status"`
+}
+
+// communityMember returns the membership of userID in a community, or nil
+// when they are not in it.
+func (app *application) communityMember(ctx context.Context, communityID, userID int64) (*store.CommunityMember, error) {
+	member, err := app.store.Communities.GetMember(ctx, communityID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return member, err
+}
+
+// Create community godoc
+//
+//	@Summary		Creates a community
+//	@Description	Creates a community owned by the current user. Anyone can join open communities, approval ones
+//	@Description	need a moderator to approve each request and invite-only ones can only be joined when invited
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateCommunityPayload	true	"Community payload"
+//	@Success		201		{object}	store.Community
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities [post]
+func (app *application) createCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCommunityPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if payload.JoinPolicy == "" {
+		payload.JoinPolicy = "open"
+	}
+
+	user := getUserFromContext(r)
+	community := &store.Community{
+		Name:        payload.Name,
+		Description: payload.Description,
+		JoinPolicy:  payload.JoinPolicy,
+		CreatedBy:   &user.ID,
+	}
+	if err := app.store.Communities.Create(r.Context(), community); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, errors.New("community name is taken"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, community); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get communities godoc
+//
+//	@Summary		Lists communities
+//	@Description	Lists communities, largest first
+//	@Tags			communities
+//	@Produce		json
+//	@Param			search	query		string	false	"Part of the name"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.Community
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities [get]
+func (app *application) getCommunitiesHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	communities, err := app.store.Communities.GetAll(r.Context(), r.URL.Query().Get("search"), pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, communities); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get community godoc
+//
+//	@Summary		Fetches a community
+//	@Description	Fetches a community along with the membership of the current user
+//	@Tags			communities
+//	@Produce		json
+//	@Param			communityID	path		int	true	"Community ID"
+//	@Success		200			{object}	CommunityWithMembership
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID} [get]
+func (app *application) getCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+	member, err := app.communityMember(r.Context(), community.ID, getUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, CommunityWithMembership{*community, member}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Update community godoc
+//
+//	@Summary		Updates a community
+//	@Description	Updates the name, description or join policy of a community. Only its owner can
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int						true	"Community ID"
+//	@Param			payload		body		UpdateCommunityPayload	true	"Community payload"
+//	@Success		200			{object}	store.Community
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID} [patch]
+func (app *application) updateCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateCommunityPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	community := getCommunityFromCtx(r)
+	if payload.Name != nil {
+		community.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		community.Description = *payload.Description
+	}
+	if payload.JoinPolicy != nil {
+		community.JoinPolicy = *payload.JoinPolicy
+	}
+
+	if err := app.store.Communities.Update(r.Context(), community); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, errors.New("community name is taken"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, community); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Delete community godoc
+//
+//	@Summary		Deletes a community
+//	@Description	Deletes a community along with its posts. Only its owner and admins can
+//	@Tags			communities
+//	@Param			communityID	path	int	true	"Community ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID} [delete]
+func (app *application) deleteCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	member, err := app.communityMember(ctx, community.ID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !member.HasRole(store.CommunityRoleOwner) {
+		allowed, err := app.checkRole(ctx, user, "admin")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	if err := app.store.Communities.Delete(ctx, community.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Join community godoc
+//
+//	@Summary		Joins a community
+//	@Description	Joins an open community or one the current user was invited to, or asks to join an approval one.
+//	@Description	Returns the resulting membership status: active or pending
+//	@Tags			communities
+//	@Produce		json
+//	@Param			communityID	path		int	true	"Community ID"
+//	@Success		200			{object}	membershipStatus
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/join [put]
+func (app *application) joinCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+	status, err := app.store.Communities.Join(r.Context(), community.ID, getUserFromContext(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrInviteOnly):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, membershipStatus{status}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Leave community godoc
+//
+//	@Summary		Leaves a community
+//	@Description	Leaves a community, or withdraws a request to join or an invitation. Owners cannot leave
+//	@Tags			communities
+//	@Param			communityID	path	int	true	"Community ID"
+//	@Success		204
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/leave [put]
+func (app *application) leaveCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	member, err := app.communityMember(ctx, community.ID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if member != nil && member.Role == store.CommunityRoleOwner {
+		app.conflictError(w, r, errors.New("owners cannot leave their community"))
+		return
+	}
+
+	if err := app.store.Communities.RemoveMember(ctx, community.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get community members godoc
+//
+//	@Summary		Lists the members of a community
+//	@Description	Lists the members of a community, owners and moderators first. Moderators can also list
+//	@Description	pending requests to join and invitations
+//	@Tags			communities
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			status		query		string	false	"active (default), pending or invited"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Success		200			{object}	[]store.CommunityMember
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members [get]
+func (app *application) getCommunityMembersHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = store.MemberActive
+	case store.MemberActive, store.MemberPending, store.MemberInvited:
+	default:
+		app.badRequestError(w, r, errors.New("status must be active, pending or invited"))
+		return
+	}
+
+	community := getCommunityFromCtx(r)
+	ctx := r.Context()
+	if status != store.MemberActive {
+		member, err := app.communityMember(ctx, community.ID, getUserFromContext(r).ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !member.HasRole(store.CommunityRoleModerator) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	members, err := app.store.Communities.GetMembers(ctx, community.ID, status, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, members); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Invite community member godoc
+//
+//	@Summary		Invites a user to a community
+//	@Description	Invites a user to a community, or admits them if they asked to join. Moderators and owners can invite
+//	@Tags			communities
+//	@Produce		json
+//	@Param			communityID	path		int	true	"Community ID"
+//	@Param			userID		path		int	true	"User ID"
+//	@Success		200			{object}	membershipStatus
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members/{userID}/invite [put]
+func (app *application) inviteCommunityMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	community := getCommunityFromCtx(r)
+	status, err := app.store.Communities.Invite(r.Context(), community.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, membershipStatus{status}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Approve community member godoc
+//
+//	@Summary		Approves a request to join a community
+//	@Tags			communities
+//	@Param			communityID	path	int	true	"Community ID"
+//	@Param			userID		path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members/{userID}/approve [put]
+func (app *application) approveCommunityMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	community := getCommunityFromCtx(r)
+	if err := app.store.Communities.Approve(r.Context(), community.ID, userID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Remove community member godoc
+//
+//	@Summary		Removes a member from a community
+//	@Description	Removes a member, rejects a request to join or withdraws an invitation. Moderators can remove
+//	@Description	members; only the owner can remove moderators
+//	@Tags			communities
+//	@Param			communityID	path	int	true	"Community ID"
+//	@Param			userID		path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members/{userID} [delete]
+func (app *application) removeCommunityMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	community := getCommunityFromCtx(r)
+	ctx := r.Context()
+	target, err := app.communityMember(ctx, community.ID, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if target.HasRole(store.CommunityRoleModerator) {
+		actor, err := app.communityMember(ctx, community.ID, getUserFromContext(r).ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !actor.HasRole(store.CommunityRoleOwner) || target.Role == store.CommunityRoleOwner {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	if err := app.store.Communities.RemoveMember(ctx, community.ID, userID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Set community role godoc
+//
+//	@Summary		Sets the role of a community member
+//	@Description	Makes an active member a moderator or a plain member again. Only the owner can
+//	@Tags			communities
+//	@Accept			json
+//	@Param			communityID	path	int						true	"Community ID"
+//	@Param			userID		path	int						true	"User ID"
+//	@Param			payload		body	SetCommunityRolePayload	true	"Role payload"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members/{userID}/role [put]
+func (app *application) setCommunityRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var payload SetCommunityRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	community := getCommunityFromCtx(r)
+	if err := app.store.Communities.SetRole(r.Context(), community.ID, userID, payload.Role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get community feed godoc
+//
+//	@Summary		Fetches a community feed
+//	@Description	Fetches the posts of a community, with the same filters and pagination as the user feed.
+//	@Description	Only members can read communities that are not open
+//	@Tags			communities
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			since		query		string	false	"First day, YYYY-MM-DD. Defaults to a week ago"
+//	@Param			until		query		string	false	"Last day, YYYY-MM-DD. Defaults to today"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			cursor		query		string	false	"Cursor from the next or prev field of a previous page"
+//	@Param			offset		query		int		false	"Offset, cannot be combined with cursor"
+//	@Param			sort		query		string	false	"Sort by creation time: asc or desc (default)"
+//	@Param			tags		query		string	false	"Comma separated tags the posts must all carry"
+//	@Param			search		query		string	false	"Search"
+//	@Success		200			{object}	[]store.PostWithMetadata
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/feed [get]
+func (app *application) getCommunityFeedHandler(w http.ResponseWriter, r *http.Request) {
+	filterQuery, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	if filterQuery.Mode != "chronological" {
+		app.badRequestError(w, r, errors.New("community feeds are only chronological"))
+		return
+	}
+
+	community := getCommunityFromCtx(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	if community.JoinPolicy != "open" {
+		member, err := app.communityMember(ctx, community.ID, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !member.HasRole(store.CommunityRoleMember) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	limit := filterQuery.Limit
+	filterQuery.Limit++
+	posts, err := app.store.Communities.GetFeed(ctx, community.ID, user.ID, filterQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.writeFeed(w, r, filterQuery, limit, posts)
+}
+
+func (app *application) communitiesContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "communityID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		ctx := r.Context()
+
+		community, err := app.store.Communities.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, communityCtx, community)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireCommunityRole lets through users who hold role or a higher one in
+// the community of the request.
+func (app *application) requireCommunityRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		community := getCommunityFromCtx(r)
+		member, err := app.communityMember(r.Context(), community.ID, getUserFromContext(r).ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !member.HasRole(role) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func getCommunityFromCtx(r *http.Request) *store.Community {
+	return r.Context().Value(communityCtx).(*store.Community)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"project/internal/store"
+	"testing"
+)
+
+// memberCommunityStore serves the communities and memberships a test sets
+// up, keyed by community and user ID.
+type memberCommunityStore struct {
+	store.MockCommunityStore
+	communities map[int64]*store.Community
+	members     map[[2]int64]*store.CommunityMember
+}
+
+func (s *memberCommunityStore) GetByID(ctx context.Context, id int64) (*store.Community, error) {
+	if c, ok := s.communities[id]; ok {
+		return c, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *memberCommunityStore) GetMember(ctx context.Context, communityID, userID int64) (*store.CommunityMember, error) {
+	if m, ok := s.members[[2]int64{communityID, userID}]; ok {
+		return m, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+// communityPostStore holds the posts a test sets up, keyed by ID.
+type communityPostStore struct {
+	mentionlessPostStore
+	posts map[int64]*store.Post
+}
+
+func (s *communityPostStore) GetByID(ctx context.Context, id int64) (*store.Post, error) {
+	if p, ok := s.posts[id]; ok {
+		return p, nil
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *communityPostStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+
+// levelRoleStore puts every role above the test user.
+type levelRoleStore struct{}
+
+func (s *levelRoleStore) GetByName(ctx context.Context, name string) (*store.Role, error) {
+	return &store.Role{Name: name, Level: "3"}, nil
+}
+
+func TestCommunities(t *testing.T) {
+	app := newTestApp(t, config{})
+	mockStore := app.store
+	// The test user, whose ID is 0, owns open community 1, is not in
+	// invite-only community 2 and moderates community 3, which user 5 owns.
+	mockStore.Communities = &memberCommunityStore{
+		communities: map[int64]*store.Community{
+			1: {ID: 1, JoinPolicy: "open"},
+			2: {ID: 2, JoinPolicy: "invite"},
+			3: {ID: 3, JoinPolicy: "open"},
+		},
+		members: map[[2]int64]*store.CommunityMember{
+			{1, 0}: {ID: 0, Role: store.CommunityRoleOwner, Status: store.MemberActive},
+			{1, 3}: {ID: 3, Role: store.CommunityRoleModerator, Status: store.MemberActive},
+			{1, 4}: {ID: 4, Role: store.CommunityRoleMember, Status: store.MemberPending},
+			{3, 0}: {ID: 0, Role: store.CommunityRoleModerator, Status: store.MemberActive},
+			{3, 5}: {ID: 5, Role: store.CommunityRoleOwner, Status: store.MemberActive},
+			{3, 6}: {ID: 6, Role: store.CommunityRoleModerator, Status: store.MemberActive},
+			{3, 7}: {ID: 7, Role: store.CommunityRoleMember, Status: store.MemberActive},
+		},
+	}
+	community := func(id int64) *int64 { return &id }
+	mockStore.Posts = &communityPostStore{posts: map[int64]*store.Post{
+		1: {ID: 1, UserId: 9, CommunityID: community(1)},
+		2: {ID: 2, UserId: 9, CommunityID: community(2)},
+		3: {ID: 3, UserId: 3, CommunityID: community(1)},
+		4: {ID: 4, UserId: 5, CommunityID: community(3)},
+		5: {ID: 5, UserId: 6, CommunityID: community(3)},
+		6: {ID: 6, UserId: 7, CommunityID: community(3)},
+	}}
+	mockStore.Roles = &levelRoleStore{}
+	app.store = mockStore
+	do := newTestClient(app, app.mount())
+
+	t.Run("should create communities", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, do(t, http.MethodPost, "/v1/communities", `{"name": "gophers", "join_policy": "approval"}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/communities", `{"name": "gophers", "join_policy": "secret"}`).StatusCode)
+	})
+
+	t.Run("should join communities and keep their owner", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPut, "/v1/communities/1/join", "").StatusCode)
+		checkResponseCode(t, http.StatusConflict, do(t, http.MethodPut, "/v1/communities/1/leave", "").StatusCode)
+	})
+
+	t.Run("should check community roles", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/communities/1/members/4/approve", "").StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/communities/1/members/3/role", `{"role": "member"}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPut, "/v1/communities/1/members/3/role", `{"role": "owner"}`).StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodDelete, "/v1/communities/1/members/3", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodPut, "/v1/communities/2/members/4/invite", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodPatch, "/v1/communities/2", `{"name": "mine"}`).StatusCode)
+	})
+
+	t.Run("should only show closed communities to members", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/communities/1/feed", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodGet, "/v1/communities/2/feed", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodGet, "/v1/communities/2/members?status=pending", "").StatusCode)
+	})
+
+	t.Run("should only let members post in communities", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodPost, "/v1/posts", `{"title": "hi", "content": "hi", "community_id": 2}`).StatusCode)
+	})
+
+	t.Run("should let community moderators delete posts", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodDelete, "/v1/posts/1", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodDelete, "/v1/posts/2", "").StatusCode)
+	})
+
+	t.Run("should only let community moderators act on posts of lower roles", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodDelete, "/v1/posts/3", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodDelete, "/v1/posts/4", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodPatch, "/v1/posts/5", `{"title": "mine"}`).StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodDelete, "/v1/posts/6", "").StatusCode)
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/digest"
+	"project/internal/mailer"
+	"project/internal/store"
+	"time"
+)
+
+type digestConfig struct {
+	// interval is how often due digests are looked for
+	interval  time.Duration
+	batchSize int
+	topPosts  int
+}
+
+type DigestSettings struct {
+	Frequency string `json:"frequency" validate:"required,oneof=off daily weekly"`
+}
+
+type digestPost struct {
+	Title     string
+	Username  string
+	URL       string
+	Reactions int
+	Comments  int
+}
+
+var digestLines = map[string]string{
+	store.NotificationFollow:        "%d new followers",
+	store.NotificationFollowRequest: "%d follow requests",
+	store.NotificationComment:       "%d comments on your posts",
+	store.NotificationReply:         "%d replies to posts you commented on",
+	store.NotificationReaction:      "%d reactions to your posts",
+	store.NotificationMention:       "%d mentions",
+	store.NotificationModeration:    "%d moderation notices",
+}
+
+// sendDigests mails the daily and weekly digests of the last complete
+// period. Each digest is claimed before it is sent, so a restart may skip a
+// digest but never sends one twice. Transient mail errors are retried by the
+// mailer.
+func (app *application) sendDigests(ctx context.Context) error {
+	now := time.Now()
+	for _, frequency := range []string{digest.Daily, digest.Weekly} {
+		start, end := digest.Period(frequency, now)
+		for {
+			recipients, err := app.store.Digests.GetDue(ctx, frequency, start, app.config.digest.batchSize)
+			if err != nil {
+				return err
+			}
+			if len(recipients) == 0 {
+				break
+			}
+
+			for _, rcpt := range recipients {
+				claimed, err := app.store.Digests.Claim(ctx, rcpt.UserID, start)
+				if err != nil {
+					return err
+				}
+				if !claimed {
+					continue
+				}
+				if err := app.sendDigest(ctx, rcpt, frequency, start, end); err != nil {
+					app.logger.Warnw("failed to send digest", "user", rcpt.UserID, "error", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (app *application) sendDigest(ctx context.Context, rcpt store.DigestRecipient, frequency string, start, end time.Time) error {
+	content, err := app.store.Digests.GetContent(ctx, rcpt.UserID, start, end, app.config.digest.topPosts)
+	if err != nil {
+		return err
+	}
+	if content.Empty() {
+		return nil
+	}
+
+	var lines []string
+	for _, t := range store.NotificationTypes {
+		if n := content.Notifications[t]; n > 0 {
+			lines = append(lines, fmt.Sprintf(digestLines[t], n))
+		}
+	}
+	posts := make([]digestPost, len(content.Posts))
+	for i, p := range content.Posts {
+		posts[i] = digestPost{
+			Title:     p.Title,
+			Username:  p.Username,
+			URL:       fmt.Sprintf("%s/posts/%d", app.config.frontendURL, p.ID),
+			Reactions: p.Reactions,
+			Comments:  p.Comments,
+		}
+	}
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username       string
+		Frequency      string
+		Since          string
+		Notifications  []string
+		Posts          []digestPost
+		AppURL         string
+		UnsubscribeURL string
+	}{
+		Username:       rcpt.Username,
+		Frequency:      frequency,
+		Since:          start.Format("January 2"),
+		Notifications:  lines,
+		Posts:          posts,
+		AppURL:         app.config.frontendURL,
+		UnsubscribeURL: fmt.Sprintf("%s/unsubscribe/%s", app.config.frontendURL, app.digestSigner.Token(rcpt.UserID)),
+	}
+	if _, err := app.mailer.Send(mailer.DigestTemplate, rcpt.Username, rcpt.Email, vars, !isProdEnv); err != nil {
+		return err
+	}
+	return app.store.Digests.MarkSent(ctx, rcpt.UserID, start)
+}
+
+// Get digest settings godoc
+//
+//	@Summary		Gets digest settings
+//	@Description	Reports how often the current user gets activity digests by email
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	DigestSettings
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/digest [get]
+func (app *application) getDigestSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	frequency, err := app.store.Digests.GetFrequency(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, DigestSettings{Frequency: frequency}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Update digest settings godoc
+//
+//	@Summary		Updates digest settings
+//	@Description	Subscribes the current user to daily or weekly activity digests by email, or turns them off
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DigestSettings	true	"Digest settings"
+//	@Success		200		{object}	DigestSettings
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/digest [put]
+func (app *application) updateDigestSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DigestSettings
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if err := app.store.Digests.SetFrequency(r.Context(), user.ID, payload.Frequency); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, payload); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Unsubscribe from digests godoc
+//
+//	@Summary		Unsubscribes from digests
+//	@Description	Turns off the activity digests of the user the token from a digest email was issued to
+//	@Tags			users
+//	@Param			token	path		string	true	"Unsubscribe token"
+//	@Success		204		{string}	string	"Unsubscribed"
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/digest/unsubscribe/{token} [put]
+func (app *application) unsubscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.digestSigner.UserID(chi.URLParam(r, "token"))
+	if err != nil {
+		app.notFoundError(w, r, err)
+		return
+	}
+
+	if err := app.store.Digests.SetFrequency(r.Context(), userID, digest.Off); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"project/internal/digest"
+	"project/internal/mailer"
+	"project/internal/store"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *recordingMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, email)
+	return 200, nil
+}
+
+// renderingMailer renders the body of the last email sent.
+type renderingMailer struct {
+	body string
+}
+
+func (m *renderingMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int64, error) {
+	tmpl, err := template.ParseFS(mailer.FS, "templates/"+templateFile)
+	if err != nil {
+		return -1, err
+	}
+	body := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(body, "body", data); err != nil {
+		return -1, err
+	}
+	m.body = body.String()
+	return 200, nil
+}
+
+// claimingDigestStore has a daily subscriber (user 1) and a weekly one
+// (user 2), and remembers claimed digests like the digest_deliveries table.
+type claimingDigestStore struct {
+	store.MockDigestStore
+	claimed map[string]bool
+}
+
+func (s *claimingDigestStore) key(userID int64, periodStart time.Time) string {
+	return fmt.Sprint(userID, periodStart.Unix())
+}
+
+func (s *claimingDigestStore) GetDue(ctx context.Context, frequency string, periodStart time.Time, limit int) ([]store.DigestRecipient, error) {
+	userID := int64(1)
+	if frequency == digest.Weekly {
+		userID = 2
+	}
+	if s.claimed[s.key(userID, periodStart)] {
+		return []store.DigestRecipient{}, nil
+	}
+	return []store.DigestRecipient{{UserID: userID, Username: "gopher", Email: frequency + "@example.com"}}, nil
+}
+
+func (s *claimingDigestStore) Claim(ctx context.Context, userID int64, periodStart time.Time) (bool, error) {
+	if s.claimed[s.key(userID, periodStart)] {
+		return false, nil
+	}
+	s.claimed[s.key(userID, periodStart)] = true
+	return true, nil
+}
+
+func (s *claimingDigestStore) GetContent(ctx context.Context, userID int64, from, to time.Time, topPosts int) (*store.DigestContent, error) {
+	return &store.DigestContent{
+		Notifications: map[string]int{store.NotificationFollow: 2},
+		Posts:         []store.DigestPost{{ID: 1, Title: "Hello", Username: "alice"}},
+	}, nil
+}
+
+func TestSendDigests(t *testing.T) {
+	app := newTestApp(t, config{digest: digestConfig{batchSize: 10, topPosts: 5}})
+	m := &recordingMailer{}
+	app.mailer = m
+	app.store.Digests = &claimingDigestStore{claimed: map[string]bool{}}
+
+	// A restarted job finds every digest of the period claimed.
+	for i := 0; i < 2; i++ {
+		if err := app.sendDigests(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := strings.Join(m.sent, ","); got != "daily@example.com,weekly@example.com" {
+		t.Errorf("expected one daily and one weekly digest, got %s", got)
+	}
+}
+
+func TestDigestSettings(t *testing.T) {
+	app := newTestApp(t, config{})
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	do := func(t *testing.T, method, path, body string, auth bool) int {
+		t.Helper()
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should update the frequency", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/users/me/digest", "", true))
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPut, "/v1/users/me/digest", `{"frequency": "weekly"}`, true))
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPut, "/v1/users/me/digest", `{"frequency": "hourly"}`, true))
+	})
+
+	t.Run("should unsubscribe with a signed token only", func(t *testing.T) {
+		token := app.digestSigner.Token(1)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/digest/unsubscribe/"+token, "", false))
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodPut, "/v1/users/digest/unsubscribe/"+token+"x", "", false))
+	})
+}
+
+func TestDigestTemplate(t *testing.T) {
+	app := newTestApp(t, config{frontendURL: "http://localhost:4000"})
+	m := &renderingMailer{}
+	app.mailer = m
+	app.store.Digests = &claimingDigestStore{claimed: map[string]bool{}}
+
+	start, end := digest.Period(digest.Daily, time.Now())
+	err := app.sendDigest(context.Background(), store.DigestRecipient{UserID: 1, Username: "gopher"}, digest.Daily, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"2 new followers", "Hello", "http://localhost:4000/unsubscribe/" + app.digestSigner.Token(1)} {
+		if !strings.Contains(m.body, want) {
+			t.Errorf("expected the digest to contain %q", want)
+		}
+	}
+}
@@ -46,3 +46,23 @@ func (app *application) conflictError(w http.ResponseWriter, r *http.Request, er
 	app.logger.Warnf("Conflict error: Method %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
 	app.jsonResponse(w, http.StatusConflict, err.Error())
 }
+
+func (app *application) payloadTooLargeError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("Payload too large error: Method %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
+	app.jsonResponse(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func (app *application) unsupportedMediaTypeError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("Unsupported media type error: Method %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
+	app.jsonResponse(w, http.StatusUnsupportedMediaType, err.Error())
+}
+
+func (app *application) tooManyRequestsError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("Too many requests error: Method %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
+	app.jsonResponse(w, http.StatusTooManyRequests, err.Error())
+}
+
+func (app *application) serviceUnavailableError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("Service unavailable error: Method %s path: %s error: %s", r.Method, r.URL.Path, err.Error())
+	app.jsonResponse(w, http.StatusServiceUnavailable, err.Error())
+}
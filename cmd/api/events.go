@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"project/internal/events"
+	"project/internal/store"
+	"project/internal/stream"
+	"project/internal/webhook"
+	"slices"
+)
+
+// The domain events handlers publish once their changes are stored. They
+// live here rather than in the events package so that it does not depend
+// on the store, which publishes through it.
+
+type PostCreated struct {
+	Post   *store.Post
+	Author *store.User
+}
+
+func (PostCreated) Name() string { return "post.created" }
+
+// PostEdited carries the mentions of the post from before the edit.
+type PostEdited struct {
+	Post      *store.Post
+	Editor    *store.User
+	Mentioned []store.Mention
+}
+
+func (PostEdited) Name() string { return "post.edited" }
+
+type PostDeleted struct {
+	Post      *store.Post
+	DeletedBy *store.User
+}
+
+func (PostDeleted) Name() string { return "post.deleted" }
+
+type CommentCreated struct {
+	Post    *store.Post
+	Comment *store.Comment
+	Author  *store.User
+}
+
+func (CommentCreated) Name() string { return "comment.created" }
+
+type ReactionAdded struct {
+	Post     *store.Post
+	Reaction *store.Reaction
+	User     *store.User
+}
+
+func (ReactionAdded) Name() string { return "reaction.added" }
+
+type UserFollowed struct {
+	Follower   *store.User
+	FollowedID int64
+}
+
+func (UserFollowed) Name() string { return "user.followed" }
+
+type FollowRequested struct {
+	Follower   *store.User
+	FollowedID int64
+}
+
+func (FollowRequested) Name() string { return "follow.requested" }
+
+type FollowRequestResolved struct {
+	UserID      int64
+	RequesterID int64
+	Approved    bool
+}
+
+func (FollowRequestResolved) Name() string { return "follow.resolved" }
+
+type UserUnfollowed struct {
+	UserID       int64
+	UnfollowedID int64
+}
+
+func (UserUnfollowed) Name() string { return "user.unfollowed" }
+
+// MessageSent carries the members of the conversation other than the
+// sender.
+type MessageSent struct {
+	Message      *store.Message
+	Sender       *store.User
+	RecipientIDs []int64
+}
+
+func (MessageSent) Name() string { return "message.sent" }
+
+// ReportResolved is published once a moderator resolved a report and its
+// action was applied.
+type ReportResolved struct {
+	Report    *store.Report
+	Moderator *store.User
+}
+
+func (ReportResolved) Name() string { return "report.resolved" }
+
+// EmailChangeRequested carries the plain verification token of an email
+// change, which is only stored hashed.
+type EmailChangeRequested struct {
+	User  *store.User
+	Email string
+	Token string
+}
+
+func (EmailChangeRequested) Name() string { return "email.change_requested" }
+
+type UserActivated struct {
+	User *store.User
+}
+
+func (UserActivated) Name() string { return "user.activated" }
+
+// subscribeEvents registers the side effects of the domain events. Cached
+// timelines and live streams are updated before the response is sent, so
+// clients see their own changes; notifications and mail happen in the
+// background. Webhook deliveries are queued in the transaction of the change,
+// so that neither is saved without the other.
+func (app *application) subscribeEvents() {
+	bus := app.events
+
+	events.Subscribe(bus, "timeline", events.Sync, func(ctx context.Context, e PostCreated) error {
+		app.enqueueTimelineJob(ctx, timelineJob{postID: e.Post.ID, authorID: e.Author.ID})
+		return nil
+	})
+	events.Subscribe(bus, "timeline", events.Sync, func(ctx context.Context, e UserFollowed) error {
+		app.invalidateTimeline(ctx, e.Follower.ID)
+		return nil
+	})
+	events.Subscribe(bus, "timeline", events.Sync, func(ctx context.Context, e UserUnfollowed) error {
+		app.invalidateTimeline(ctx, e.UserID)
+		return nil
+	})
+	events.Subscribe(bus, "timeline", events.Sync, func(ctx context.Context, e FollowRequestResolved) error {
+		app.invalidateTimeline(ctx, e.RequesterID)
+		return nil
+	})
+
+	events.Subscribe(bus, "stream", events.Sync, func(ctx context.Context, e PostCreated) error {
+		app.publishPost(ctx, e.Post, e.Author)
+		return nil
+	})
+	events.Subscribe(bus, "stream", events.Sync, func(ctx context.Context, e CommentCreated) error {
+		if e.Post.UserId != e.Author.ID {
+			app.publishEvent(ctx, e.Post.UserId, stream.EventComment, e.Comment)
+		}
+		app.publishGateway("post", e.Post.ID, stream.EventComment, e.Comment)
+		return nil
+	})
+	events.Subscribe(bus, "stream", events.Sync, func(ctx context.Context, e UserFollowed) error {
+		app.publishEvent(ctx, e.FollowedID, stream.EventFollow, followEvent{UserID: e.Follower.ID, Username: e.Follower.Username})
+		return nil
+	})
+	events.Subscribe(bus, "stream", events.Sync, func(ctx context.Context, e FollowRequested) error {
+		app.publishEvent(ctx, e.FollowedID, stream.EventFollowRequest, followEvent{UserID: e.Follower.ID, Username: e.Follower.Username})
+		return nil
+	})
+	events.Subscribe(bus, "stream", events.Sync, func(ctx context.Context, e MessageSent) error {
+		event := messageEvent{
+			ConversationID: e.Message.ConversationID,
+			MessageID:      e.Message.ID,
+			SenderID:       e.Sender.ID,
+			Username:       e.Sender.Username,
+			Body:           e.Message.Body,
+			CreatedAt:      e.Message.CreatedAt,
+		}
+		for _, id := range e.RecipientIDs {
+			app.publishEvent(ctx, id, stream.EventMessage, event)
+		}
+		return nil
+	})
+
+	events.Subscribe(bus, "notifications", events.Async, func(ctx context.Context, e PostCreated) error {
+		app.notifyMentions(ctx, e.Post, e.Author, nil)
+		return nil
+	})
+	events.Subscribe(bus, "notifications", events.Async, func(ctx context.Context, e PostEdited) error {
+		if e.Post.UserId == e.Editor.ID {
+			app.notifyMentions(ctx, e.Post, e.Editor, e.Mentioned)
+		}
+		app.notifyModeration(ctx, e.Post, e.Editor, "edited")
+		return nil
+	})
+	events.Subscribe(bus, "notifications", events.Async, func(ctx context.Context, e PostDeleted) error {
+		app.notifyModeration(ctx, e.Post, e.DeletedBy, "removed")
+		return nil
+	})
+	events.Subscribe(bus, "notifications", events.Async, func(ctx context.Context, e CommentCreated) error {
+		app.notify(ctx, store.NewNotification{Type: store.NotificationComment, PostID: e.Post.ID}, e.Author, e.Post.UserId)
+
+		participants, err := app.store.Comments.GetParticipantIDs(ctx, e.Post.ID)
+		if err != nil {
+			return err
+		}
+		participants = slices.DeleteFunc(participants, func(id int64) bool { return id == e.Post.UserId })
+		app.notify(ctx, store.NewNotification{Type: store.NotificationReply, PostID: e.Post.ID}, e.Author, participants...)
+		return nil
+	})
+	events.Subscribe(bus, "notifications", events.Async, func(ctx context.Context, e ReactionAdded) error {
+		app.notify(ctx, store.NewNotification{
+			Type:   store.NotificationReaction,
+			PostID: e.Post.ID,
+			Data:   map[string]string{"kind": e.Reaction.Kind},
+		}, e.User, e.Post.UserId)
+		return nil
+	})
+	events.Subscribe(bus, "notifications", events.Async, func(ctx context.Context, e UserFollowed) error {
+		app.notify(ctx, store.NewNotification{Type: store.NotificationFollow}, e.Follower, e.FollowedID)
+		return nil
+	})
+	events.Subscribe(bus, "notifications", events.Async, func(ctx context.Context, e FollowRequested) error {
+		app.notify(ctx, store.NewNotification{Type: store.NotificationFollowRequest}, e.Follower, e.FollowedID)
+		return nil
+	})
+	events.Subscribe(bus, "notifications", events.Async, func(ctx context.Context, e ReportResolved) error {
+		app.notifyReportResolution(ctx, e.Report)
+		return nil
+	})
+
+	events.Subscribe(bus, "mail", events.Async, func(ctx context.Context, e EmailChangeRequested) error {
+		return app.sendEmailVerification(e)
+	})
+
+	events.Subscribe(bus, "webhooks", events.InTx, func(ctx context.Context, e PostCreated) error {
+		return app.enqueueWebhook(ctx, webhook.EventPostCreated, []int64{e.Author.ID}, e.Post)
+	})
+	events.Subscribe(bus, "webhooks", events.InTx, func(ctx context.Context, e PostDeleted) error {
+		return app.enqueueWebhook(ctx, webhook.EventPostDeleted, []int64{e.Post.UserId}, postDeletedWebhookData{
+			ID:     e.Post.ID,
+			UserID: e.Post.UserId,
+		})
+	})
+	events.Subscribe(bus, "webhooks", events.InTx, func(ctx context.Context, e CommentCreated) error {
+		return app.enqueueWebhook(ctx, webhook.EventCommentCreated, []int64{e.Post.UserId, e.Author.ID}, e.Comment)
+	})
+	events.Subscribe(bus, "webhooks", events.InTx, func(ctx context.Context, e UserFollowed) error {
+		return app.enqueueFollowedWebhook(ctx, e.FollowedID, e.Follower.ID)
+	})
+	events.Subscribe(bus, "webhooks", events.InTx, func(ctx context.Context, e FollowRequestResolved) error {
+		if !e.Approved {
+			return nil
+		}
+		return app.enqueueFollowedWebhook(ctx, e.UserID, e.RequesterID)
+	})
+	events.Subscribe(bus, "webhooks", events.InTx, func(ctx context.Context, e UserActivated) error {
+		return app.enqueueWebhook(ctx, webhook.EventUserActivated, []int64{e.User.ID}, userWebhookData{
+			ID:       e.User.ID,
+			Username: e.User.Username,
+		})
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
+	"project/internal/cursor"
 	"project/internal/store"
 	"time"
 )
@@ -10,23 +11,74 @@ import (
 // Get user feed godoc
 //
 //	@Summary		Fetches user feed
-//	@Description	Fetches user feed
+//	@Description	Fetches the posts of the current user and of the users they follow
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
-//	@Param			since	query		string	false	"Since"
-//	@Param			until	query		string	false	"Until"
+//	@Param			since	query		string	false	"First day, YYYY-MM-DD. Defaults to a week ago"
+//	@Param			until	query		string	false	"Last day, YYYY-MM-DD. Defaults to today"
 //	@Param			limit	query		int		false	"Limit"
-//	@Param			sort	query		string	false	"Sort"
-//	@Param			tags	query		string	false	"Tags"
+//	@Param			cursor	query		string	false	"Cursor from the next or prev field of a previous page"
+//	@Param			offset	query		int		false	"Offset, cannot be combined with cursor"
+//	@Param			sort	query		string	false	"Sort by creation time: asc or desc (default)"
+//	@Param			tags	query		string	false	"Comma separated tags the posts must all carry"
 //	@Param			search	query		string	false	"Search"
+//	@Param			mode	query		string	false	"chronological (default) or ranked. The ranked feed mixes in popular posts and only supports limit and offset"
 //	@Success		200		{object}	[]store.PostWithMetadata
 //	@Failure		400		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	filterQuery, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+
 	ctx := r.Context()
+	user := getUserFromContext(r)
+	if filterQuery.Mode == "ranked" {
+		if r.URL.Query().Has("cursor") || filterQuery.Search != "" || len(filterQuery.Tags) > 0 || filterQuery.SortBy != "desc" {
+			app.badRequestError(w, r, errors.New("the ranked feed only supports limit and offset"))
+			return
+		}
+		posts, err := app.getRankedFeed(ctx, user.ID, filterQuery)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.writeFeedPage(w, r, posts, "", "")
+		return
+	}
+
+	// Ask for one post more than the page holds to learn whether another
+	// page follows in the direction we are reading.
+	limit := filterQuery.Limit
+	filterQuery.Limit++
+	var posts []store.PostWithMetadata
+	var err error
+	cached := false
+	if app.config.timeline.enabled && timelineServes(filterQuery, r.URL.Query().Has("until")) {
+		posts, cached, err = app.readTimeline(ctx, user.ID, filterQuery)
+		if err != nil {
+			app.logger.Warnw("failed to read cached timeline", "user", user.ID, "error", err)
+			cached = false
+		}
+	}
+	if !cached {
+		posts, err = app.store.Posts.GetUserFeed(ctx, user.ID, filterQuery)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	app.writeFeed(w, r, filterQuery, limit, posts)
+}
+
+// readFeedQuery parses the filters and cursor of a feed request, answering
+// malformed ones itself.
+func (app *application) readFeedQuery(w http.ResponseWriter, r *http.Request) (store.PaginatedFeedQuery, bool) {
 	now := time.Now().Format("2006-01-02")
 	dateWeekBefore := time.Now().AddDate(0, 0, -7).Format("2006-01-02")
 	filterDefault := store.PaginatedFeedQuery{
@@ -36,28 +88,101 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		Since:  dateWeekBefore,
 		Until:  now,
 		Tags:   []string{},
+		Mode:   "chronological",
 	}
 	filterQuery, err := filterDefault.Parse(r)
 	if err != nil {
 		app.badRequestError(w, r, err)
-		return
+		return filterQuery, false
 	}
 
 	if err := Validate.Struct(filterQuery); err != nil {
 		app.badRequestError(w, r, err)
-		return
+		return filterQuery, false
 	}
-	if filterQuery.Since == "" || filterQuery.Until == "" {
-		app.badRequestError(w, r, errors.New("Since or Until provided in bad format"))
-		return
+	if filterQuery.Since > filterQuery.Until {
+		app.badRequestError(w, r, errors.New("since must not be after until"))
+		return filterQuery, false
 	}
-	posts, err := app.store.Posts.GetUserFeed(ctx, int64(9), filterQuery)
-	if err != nil {
+
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		if filterQuery.Offset != 0 {
+			app.badRequestError(w, r, errors.New("cursor and offset cannot be combined"))
+			return filterQuery, false
+		}
+		cur, err := app.cursors.Decode(token)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return filterQuery, false
+		}
+		position := &store.FeedCursor{CreatedAt: cur.CreatedAt, ID: cur.ID}
+		if cur.Backward {
+			filterQuery.Before = position
+		} else {
+			filterQuery.After = position
+		}
+	}
+	return filterQuery, true
+}
+
+// writeFeed writes a page of posts read with filterQuery, which asked for
+// one post more than limit, along with the cursors of its neighbours.
+func (app *application) writeFeed(w http.ResponseWriter, r *http.Request, filterQuery store.PaginatedFeedQuery, limit int, posts []store.PostWithMetadata) {
+	more := len(posts) > limit
+	if more {
+		if filterQuery.Before != nil {
+			posts = posts[1:]
+		} else {
+			posts = posts[:limit]
+		}
+	}
+
+	var next, prev string
+	var err error
+	if len(posts) > 0 {
+		backward := filterQuery.Before != nil
+		if more || backward {
+			next, err = app.feedCursor(posts[len(posts)-1], false)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+		if (more && backward) || (!backward && (filterQuery.After != nil || filterQuery.Offset > 0)) {
+			prev, err = app.feedCursor(posts[0], true)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+	}
+
+	app.writeFeedPage(w, r, posts, next, prev)
+}
+
+func (app *application) writeFeedPage(w http.ResponseWriter, r *http.Request, posts []store.PostWithMetadata, next, prev string) {
+	list := make([]*store.Post, len(posts))
+	for i := range posts {
+		list[i] = &posts[i].Post
+	}
+	if err := app.loadMentions(r.Context(), list...); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	if err := app.jsonResponse(w, 200, posts); err != nil {
+	if err := app.loadPolls(r.Context(), getUserFromContext(r).ID, list...); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, posts, next, prev); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) feedCursor(post store.PostWithMetadata, backward bool) (string, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+	return app.cursors.Encode(cursor.Cursor{CreatedAt: createdAt, ID: post.ID, Backward: backward}), nil
 }
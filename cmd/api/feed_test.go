@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"project/internal/cursor"
+	"testing"
+	"time"
+)
+
+func TestFeedCursor(t *testing.T) {
+	app := newTestApp(t, config{})
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	get := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should reject malformed parameters", func(t *testing.T) {
+		for _, query := range []string{
+			"limit=ten",
+			"offset=-",
+			"limit=0",
+			"sort=newest",
+			"since=yesterday",
+			"since=2024-05-02&until=2024-05-01",
+			"tags=go,%23",
+			"mode=popular",
+			"mode=ranked&tags=go",
+			"mode=ranked&sort=asc",
+		} {
+			rr := get(t, "/v1/users/feed?"+query)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected %d, got %d", query, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should reject forged cursors", func(t *testing.T) {
+		forged := cursor.NewCodec("other").Encode(cursor.Cursor{CreatedAt: time.Now(), ID: 1})
+		rr := get(t, "/v1/users/feed?cursor="+forged)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should reject cursor with offset", func(t *testing.T) {
+		token := app.cursors.Encode(cursor.Cursor{CreatedAt: time.Now(), ID: 1})
+		rr := get(t, "/v1/users/feed?offset=20&cursor="+token)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestJSONPageResponse(t *testing.T) {
+	app := newTestApp(t, config{})
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/feed?limit=5&offset=10", nil)
+	rr := httptest.NewRecorder()
+
+	if err := app.jsonPageResponse(rr, req, http.StatusOK, []int{}, "n", "p"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `</v1/users/feed?cursor=n&limit=5>; rel="next", </v1/users/feed?cursor=p&limit=5>; rel="prev"`
+	if link := rr.Header().Get("Link"); link != expected {
+		t.Errorf("expected Link %q, got %q", expected, link)
+	}
+	if body := rr.Body.String(); body != `{"data":[],"next":"n","prev":"p"}`+"\n" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/store"
+	"strconv"
+)
+
+// Get followers godoc
+//
+//	@Summary		Fetches user followers
+//	@Description	Fetches the users following a user, newest first. The followers of private accounts are only
+//	@Description	listed to their followers
+//	@Tags			users
+//	@Produce		json
+//	@Param			id		path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.FollowListItem
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/followers [get]
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.followListHandler(w, r, app.store.Followers.GetFollowers)
+}
+
+// Get following godoc
+//
+//	@Summary		Fetches followed users
+//	@Description	Fetches the users a user follows, newest first. Private accounts only list them to their followers
+//	@Tags			users
+//	@Produce		json
+//	@Param			id		path		int	true	"User ID"
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.FollowListItem
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/following [get]
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.followListHandler(w, r, app.store.Followers.GetFollowing)
+}
+
+type followListFunc func(ctx context.Context, userID, viewerID int64, pq store.PaginationQuery) ([]store.FollowListItem, error)
+
+func (app *application) followListHandler(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	viewer := getUserFromContext(r)
+	ctx := r.Context()
+	visible, err := app.canViewContentOf(ctx, viewer, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !visible {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	items, err := list(ctx, userID, viewer.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, items); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get relationship godoc
+//
+//	@Summary		Checks mutual follow
+//	@Description	Reports whether the current user and a user follow each other, unless either blocked the other
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		200	{object}	store.Relationship
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/mutual [get]
+func (app *application) getMutualFollowHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	viewer := getUserFromContext(r)
+	ctx := r.Context()
+	blocked, err := app.store.Blocks.IsBlocked(ctx, viewer.ID, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if blocked {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	rel, err := app.store.Followers.GetRelationship(ctx, viewer.ID, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, rel); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get follow requests godoc
+//
+//	@Summary		Fetches pending follow requests
+//	@Description	Fetches the pending requests to follow the current user, oldest first
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.FollowRequest
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests [get]
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	requests, err := app.store.Followers.GetFollowRequests(r.Context(), user.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, requests); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Approve follow request godoc
+//
+//	@Summary		Approve follow request
+//	@Description	Approves a pending follow request by requester ID
+//	@Tags			users
+//	@Produce		json
+//	@Param			requesterID	path		int	true	"Requester ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{requesterID}/approve [put]
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.resolveFollowRequest(w, r, true)
+}
+
+// Reject follow request godoc
+//
+//	@Summary		Reject follow request
+//	@Description	Rejects a pending follow request by requester ID
+//	@Tags			users
+//	@Produce		json
+//	@Param			requesterID	path		int	true	"Requester ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{requesterID}/reject [put]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.resolveFollowRequest(w, r, false)
+}
+
+func (app *application) resolveFollowRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	resolve := app.store.Followers.RejectRequest
+	if approve {
+		resolve = app.store.Followers.ApproveRequest
+	}
+
+	user := getUserFromContext(r)
+	err = app.store.InTx(r.Context(), func(ctx context.Context) error {
+		if err := resolve(ctx, user.ID, requesterID); err != nil {
+			return err
+		}
+		app.events.Publish(ctx, FollowRequestResolved{UserID: user.ID, RequesterID: requesterID, Approved: approve})
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"project/internal/store"
+	"project/internal/store/cache"
+	"testing"
+)
+
+func TestGetFollowers(t *testing.T) {
+	app := newTestApp(t, config{})
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	t.Run("should list followers", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/followers?limit=10", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should reject malformed pagination", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/following?limit=abc", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should check mutual follow", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/mutual", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
+
+// stubFollowerStore answers follows with status and resolves follow
+// requests with err.
+type stubFollowerStore struct {
+	store.MockFollowerStore
+	status store.FollowStatus
+	err    error
+}
+
+func (s *stubFollowerStore) Follow(ctx context.Context, followerID, userID int64) (store.FollowStatus, error) {
+	return s.status, s.err
+}
+
+func (s *stubFollowerStore) ApproveRequest(ctx context.Context, userID, requesterID int64) error {
+	return s.err
+}
+
+func (s *stubFollowerStore) RejectRequest(ctx context.Context, userID, requesterID int64) error {
+	return s.err
+}
+
+// privateUserStore makes every user but the test user private.
+type privateUserStore struct {
+	store.MockUserStore
+}
+
+func (s *privateUserStore) GetByID(ctx context.Context, id int64) (*store.User, error) {
+	return &store.User{ID: id, IsPrivate: id != 0}, nil
+}
+
+// evictingUserCache records the users evicted from the cache.
+type evictingUserCache struct {
+	cache.MockUserStorage
+	evicted []int64
+}
+
+func (c *evictingUserCache) Delete(ctx context.Context, id int64) {
+	c.evicted = append(c.evicted, id)
+}
+
+func TestPrivateAccounts(t *testing.T) {
+	app := newTestApp(t, config{redisConfig: redisConfig{enabled: true}})
+	followers := &stubFollowerStore{status: store.FollowStatusFollowing}
+	users := &evictingUserCache{}
+	mockStore := app.store
+	mockStore.Followers = followers
+	mockStore.Users = &privateUserStore{}
+	app.store = mockStore
+	app.cacheStorage.Users = users
+	do := newTestClient(app, app.mount())
+
+	t.Run("should accept follow requests to private accounts", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/1/follow", "").StatusCode)
+
+		followers.status = store.FollowStatusPending
+		defer func() { followers.status = store.FollowStatusFollowing }()
+		res := do(t, http.MethodPut, "/v1/users/1/follow", "")
+		checkResponseCode(t, http.StatusAccepted, res.StatusCode)
+		var body struct {
+			Data FollowStatusResponse `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.Status != store.FollowStatusPending {
+			t.Errorf("expected a pending follow, got %q", body.Data.Status)
+		}
+	})
+
+	t.Run("should approve and reject follow requests", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/me/follow-requests/1/approve", "").StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/me/follow-requests/1/reject", "").StatusCode)
+
+		followers.err = store.ErrNotFound
+		defer func() { followers.err = nil }()
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodPut, "/v1/users/me/follow-requests/1/approve", "").StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodPut, "/v1/users/me/follow-requests/1/reject", "").StatusCode)
+	})
+
+	t.Run("should switch privacy and evict the cached user", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/me/privacy", `{"is_private": true}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPut, "/v1/users/me/privacy", `{}`).StatusCode)
+		if len(users.evicted) != 1 || users.evicted[0] != 0 {
+			t.Errorf("expected the test user to be evicted once, got %v", users.evicted)
+		}
+	})
+
+	t.Run("should hide the follower lists of private accounts", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodGet, "/v1/users/1/followers", "").StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodGet, "/v1/users/1/following", "").StatusCode)
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/users/0/followers", "").StatusCode)
+	})
+}
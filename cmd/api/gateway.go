@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"project/internal/gateway"
+	"project/internal/store"
+	"time"
+)
+
+// maxGatewayMessageBytes bounds the messages clients may send.
+const maxGatewayMessageBytes = 4096
+
+// wsConn adapts a WebSocket to the gateway with one JSON message per frame.
+type wsConn struct {
+	*websocket.Conn
+}
+
+func (c wsConn) ReadMessage(m *gateway.Message) error {
+	return websocket.JSON.Receive(c.Conn, m)
+}
+
+func (c wsConn) WriteMessage(m *gateway.Message) error {
+	return websocket.JSON.Send(c.Conn, m)
+}
+
+// Gateway godoc
+//
+//	@Summary		Opens a WebSocket to the real-time gateway
+//	@Description	Upgrades to a WebSocket exchanging JSON messages. Send {"type":"subscribe","topic":"post:<id>"} to follow
+//	@Description	the comments of a post, "user:<id>" to follow the posts of a user, {"type":"unsubscribe"} to stop and
+//	@Description	{"type":"typing","topic":...} to show subscribers you are typing. Answer {"type":"ping"} with
+//	@Description	{"type":"pong"}: silent connections are closed, and so are connections that cannot keep up
+//	@Tags			stream
+//	@Param			Upgrade	header	string	true	"websocket"
+//	@Success		101		"Switching Protocols"
+//	@Failure		401		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/ws [get]
+func (app *application) gatewayHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	server := websocket.Server{
+		// Clients authenticate with a bearer token rather than cookies, so
+		// cross-site pages cannot open sockets on their behalf.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = maxGatewayMessageBytes
+			app.gateway.Serve(r.Context(), wsConn{ws}, user.ID)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// authorizeTopic lets users subscribe to the comments of the posts and to
+// the posts of the users they can see.
+func (app *application) authorizeTopic(ctx context.Context, userID int64, kind string, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	viewer, err := app.getUserFromCache(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	authorID := id
+	if kind == "post" {
+		post, err := app.store.Posts.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return gateway.ErrForbidden
+			}
+			return err
+		}
+		authorID = post.UserId
+
+		visible, err := app.canSeePost(ctx, viewer, post)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return gateway.ErrForbidden
+		}
+	}
+
+	ok, err := app.canViewContentOf(ctx, viewer, authorID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return gateway.ErrForbidden
+	}
+	return nil
+}
+
+// publishGateway sends an event to the gateway subscribers of a topic.
+func (app *application) publishGateway(kind string, id int64, event string, data any) {
+	if err := app.gateway.PublishEvent(gateway.Topic(kind, id), event, data); err != nil {
+		app.logger.Warnw("failed to publish gateway event", "topic", gateway.Topic(kind, id), "error", err)
+	}
+}
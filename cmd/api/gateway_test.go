@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/http/httptest"
+	"project/internal/gateway"
+	"strings"
+	"testing"
+)
+
+func TestGateway(t *testing.T) {
+	app := newTestApp(t, config{})
+	app.gateway.Authorize = func(context.Context, int64, string, int64) error { return nil }
+	srv := httptest.NewServer(app.mount())
+	defer srv.Close()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws"
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		cfg, err := websocket.NewConfig(url, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := websocket.DialConfig(cfg); err == nil {
+			t.Fatal("expected the handshake to fail")
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/ws", nil)
+		rr := executeRequest(req, app.mount())
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should deliver comments of subscribed posts", func(t *testing.T) {
+		cfg, err := websocket.NewConfig(url, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Header.Set("Authorization", "Bearer "+testToken)
+		ws, err := websocket.DialConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		var m gateway.Message
+		if err := websocket.JSON.Send(ws, gateway.Message{Type: gateway.TypeSubscribe, Topic: "post:1"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := websocket.JSON.Receive(ws, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != gateway.TypeSubscribed {
+			t.Fatalf("expected to subscribe, got %+v", m)
+		}
+
+		app.publishGateway("post", 1, "comment", map[string]string{"content": "hi"})
+		if err := websocket.JSON.Receive(ws, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != gateway.TypeEvent || m.Event != "comment" || m.Topic != "post:1" {
+			t.Errorf("unexpected message %+v", m)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"project/internal/stream"
+	"time"
+)
+
+// startBackgroundJobs launches the periodic jobs of the API. They stop once
+// ctx is cancelled; app.jobs tracks them so shutdown can wait for them.
+func (app *application) startBackgroundJobs(ctx context.Context) {
+	app.runPeriodic(ctx, "account-purge", time.Hour, false, app.purgeDeletedAccounts)
+	// the trending endpoints have nothing to serve until the first run
+	app.runPeriodic(ctx, "trending-refresh", app.config.trending.refreshInterval, true, app.refreshTrending)
+	app.runPeriodic(ctx, "email-digest", app.config.digest.interval, false, app.sendDigests)
+	app.runPeriodic(ctx, "webhook-delivery", app.config.webhook.interval, false, app.deliverWebhooks)
+	app.runPeriodic(ctx, "poll-freeze", app.config.polls.interval, false, app.freezePolls)
+	app.startTimelineWorkers(ctx)
+
+	app.jobs.Add(1)
+	go func() {
+		defer app.jobs.Done()
+		app.events.Run(ctx)
+	}()
+
+	if hub, ok := app.hub.(*stream.RedisHub); ok {
+		app.jobs.Add(1)
+		go func() {
+			defer app.jobs.Done()
+			hub.Run(ctx, func(err error) {
+				app.logger.Errorw("stream subscription failed", "error", err)
+			})
+		}()
+	}
+}
+
+// runPeriodic runs fn on every tick of interval, and also right away when
+// runAtStart is set.
+func (app *application) runPeriodic(ctx context.Context, name string, interval time.Duration, runAtStart bool, fn func(context.Context) error) {
+	app.jobs.Add(1)
+	go func() {
+		defer app.jobs.Done()
+
+		run := func() {
+			if err := runJob(ctx, fn); err != nil {
+				app.logger.Errorw("background job failed", "job", name, "error", err)
+			}
+		}
+		if runAtStart {
+			run()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+}
+
+func runJob(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
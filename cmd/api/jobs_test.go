@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunPeriodic(t *testing.T) {
+	app := newTestApp(t, config{})
+
+	for _, runAtStart := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var runs atomic.Int32
+		app.runPeriodic(ctx, "test", time.Hour, runAtStart, func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		})
+
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		app.jobs.Wait()
+
+		want := int32(0)
+		if runAtStart {
+			want = 1
+		}
+		if got := runs.Load(); got != want {
+			t.Errorf("runAtStart %t: expected %d runs before the first tick, got %d", runAtStart, want, got)
+		}
+	}
+}
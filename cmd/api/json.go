@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/go-playground/validator/v10"
 	"net/http"
+	"strings"
 )
 
 var Validate *validator.Validate
@@ -33,3 +35,40 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 	}
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+// jsonPageResponse writes a page of a cursor-paginated list. The cursors of
+// the next and previous pages go both into the envelope and, as links to
+// the current URL with the cursor swapped, into the Link header. An empty
+// cursor means there is no such page.
+func (app *application) jsonPageResponse(w http.ResponseWriter, r *http.Request, status int, data any, next, prev string) error {
+	type envelope struct {
+		Data any     `json:"data"`
+		Next *string `json:"next"`
+		Prev *string `json:"prev"`
+	}
+	env := &envelope{Data: data}
+
+	var links []string
+	if next != "" {
+		env.Next = &next
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, next)))
+	}
+	if prev != "" {
+		env.Prev = &prev
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r, prev)))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	return writeJSON(w, status, env)
+}
+
+func pageURL(r *http.Request, cursor string) string {
+	q := r.URL.Query()
+	q.Del("offset")
+	q.Set("cursor", cursor)
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/store"
+	"strconv"
+)
+
+type listKey string
+
+const listCtx listKey = "list"
+
+type CreateListPayload struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	IsPrivate   bool   `json:"is_private"`
+}
+
+type UpdateListPayload struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=500"`
+	IsPrivate   *bool   `json:"is_private"`
+}
+
+// Create list godoc
+//
+//	@Summary		Creates a list
+//	@Description	Creates a named list of accounts whose posts can be read as a feed. Private lists are only visible to their owner
+//	@Tags			lists
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateListPayload	true	"List payload"
+//	@Success		201		{object}	store.List
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists [post]
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateListPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	list := &store.List{
+		UserID:      user.ID,
+		Name:        payload.Name,
+		Description: payload.Description,
+		IsPrivate:   payload.IsPrivate,
+	}
+	if err := app.store.Lists.Create(r.Context(), list); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, list); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get lists godoc
+//
+//	@Summary		Lists the lists of the current user
+//	@Description	Lists the public and private lists of the current user, newest first
+//	@Tags			lists
+//	@Produce		json
+//	@Success		200	{object}	[]store.List
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists [get]
+func (app *application) getListsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	app.writeLists(w, r, user.ID)
+}
+
+// Get user lists godoc
+//
+//	@Summary		Lists the lists of a user
+//	@Description	Lists the public lists of a user, newest first
+//	@Tags			lists
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	[]store.List
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/lists [get]
+func (app *application) getUserListsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	app.writeLists(w, r, userID)
+}
+
+func (app *application) writeLists(w http.ResponseWriter, r *http.Request, userID int64) {
+	user := getUserFromContext(r)
+	lists, err := app.store.Lists.GetByUserID(r.Context(), userID, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, lists); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get list godoc
+//
+//	@Summary		Fetches a list
+//	@Tags			lists
+//	@Produce		json
+//	@Param			listID	path		int	true	"List ID"
+//	@Success		200		{object}	store.List
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID} [get]
+func (app *application) getListHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getListFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Update list godoc
+//
+//	@Summary		Updates a list
+//	@Description	Updates the name, description or privacy of a list of the current user
+//	@Tags			lists
+//	@Accept			json
+//	@Produce		json
+//	@Param			listID	path		int					true	"List ID"
+//	@Param			payload	body		UpdateListPayload	true	"List payload"
+//	@Success		200		{object}	store.List
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID} [patch]
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+	if list.UserID != getUserFromContext(r).ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	var payload UpdateListPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.Name != nil {
+		list.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		list.Description = *payload.Description
+	}
+	if payload.IsPrivate != nil {
+		list.IsPrivate = *payload.IsPrivate
+	}
+
+	if err := app.store.Lists.Update(r.Context(), list); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, list); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Delete list godoc
+//
+//	@Summary		Deletes a list
+//	@Tags			lists
+//	@Param			listID	path	int	true	"List ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID} [delete]
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+	user := getUserFromContext(r)
+	if list.UserID != user.ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := app.store.Lists.Delete(r.Context(), list.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get list members godoc
+//
+//	@Summary		Lists the members of a list
+//	@Description	Lists the members of a list, most recently added first
+//	@Tags			lists
+//	@Produce		json
+//	@Param			listID	path		int	true	"List ID"
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.ListMember
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID}/members [get]
+func (app *application) getListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	list := getListFromCtx(r)
+	user := getUserFromContext(r)
+	members, err := app.store.Lists.GetMembers(r.Context(), list.ID, user.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, members); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Add list member godoc
+//
+//	@Summary		Adds a member to a list
+//	@Description	Adds an account to a list of the current user. Adding a member twice has no effect
+//	@Tags			lists
+//	@Param			listID	path	int	true	"List ID"
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID}/members/{userID} [put]
+func (app *application) addListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeListMember(w, r, app.store.Lists.AddMember)
+}
+
+// Remove list member godoc
+//
+//	@Summary		Removes a member from a list
+//	@Tags			lists
+//	@Param			listID	path	int	true	"List ID"
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID}/members/{userID} [delete]
+func (app *application) removeListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeListMember(w, r, app.store.Lists.RemoveMember)
+}
+
+func (app *application) changeListMember(w http.ResponseWriter, r *http.Request,
+	change func(ctx context.Context, listID, ownerID, userID int64) error) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	list := getListFromCtx(r)
+	user := getUserFromContext(r)
+	if list.UserID != user.ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := change(r.Context(), list.ID, user.ID, userID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get list feed godoc
+//
+//	@Summary		Fetches a list feed
+//	@Description	Fetches the posts of the members of a list, with the same filters and pagination as the user feed
+//	@Tags			lists
+//	@Produce		json
+//	@Param			listID	path		int		true	"List ID"
+//	@Param			since	query		string	false	"First day, YYYY-MM-DD. Defaults to a week ago"
+//	@Param			until	query		string	false	"Last day, YYYY-MM-DD. Defaults to today"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor from the next or prev field of a previous page"
+//	@Param			offset	query		int		false	"Offset, cannot be combined with cursor"
+//	@Param			sort	query		string	false	"Sort by creation time: asc or desc (default)"
+//	@Param			tags	query		string	false	"Comma separated tags the posts must all carry"
+//	@Param			search	query		string	false	"Search"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID}/feed [get]
+func (app *application) getListFeedHandler(w http.ResponseWriter, r *http.Request) {
+	filterQuery, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	if filterQuery.Mode != "chronological" {
+		app.badRequestError(w, r, errors.New("list feeds are only chronological"))
+		return
+	}
+
+	list := getListFromCtx(r)
+	user := getUserFromContext(r)
+	limit := filterQuery.Limit
+	filterQuery.Limit++
+	posts, err := app.store.Lists.GetFeed(r.Context(), list.ID, user.ID, filterQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.writeFeed(w, r, filterQuery, limit, posts)
+}
+
+func (app *application) listsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		ctx := r.Context()
+
+		user := getUserFromContext(r)
+		list, err := app.store.Lists.GetByID(ctx, id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, listCtx, list)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getListFromCtx(r *http.Request) *store.List {
+	return r.Context().Value(listCtx).(*store.List)
+}
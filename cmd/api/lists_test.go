@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"project/internal/store"
+	"testing"
+)
+
+// ownedListStore returns every list as one of owner, or of the viewer when
+// owner is not set. Its lists have 30 posts.
+type ownedListStore struct {
+	store.MockListStore
+	owner int64
+}
+
+func (s *ownedListStore) GetByID(ctx context.Context, id, viewerID int64) (*store.List, error) {
+	if s.owner != 0 {
+		return &store.List{ID: id, UserID: s.owner}, nil
+	}
+	return &store.List{ID: id, UserID: viewerID}, nil
+}
+
+func (s *ownedListStore) GetFeed(ctx context.Context, listID, viewerID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	var posts []store.PostWithMetadata
+	for _, item := range cursorPage(fq.Limit, fq.After) {
+		var p store.PostWithMetadata
+		p.ID = item.ID
+		p.CreatedAt = item.CreatedAt
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
+
+// mentionlessPostStore lets feeds be written without a database.
+type mentionlessPostStore struct {
+	*store.PostsStore
+}
+
+func (s *mentionlessPostStore) GetMentions(ctx context.Context, postIDs []int64) (map[int64][]store.Mention, error) {
+	return map[int64][]store.Mention{}, nil
+}
+
+func TestLists(t *testing.T) {
+	app := newTestApp(t, config{})
+	mockStore := app.store
+	lists := &ownedListStore{}
+	mockStore.Lists = lists
+	mockStore.Posts = &mentionlessPostStore{}
+	app.store = mockStore
+	do := newTestClient(app, app.mount())
+
+	t.Run("should create lists", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, do(t, http.MethodPost, "/v1/lists", `{"name": "Go devs", "is_private": true}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/lists", `{"name": ""}`).StatusCode)
+	})
+
+	t.Run("should only let owners change lists", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPatch, "/v1/lists/1", `{"name": "Team"}`).StatusCode)
+
+		lists.owner = 5
+		defer func() { lists.owner = 0 }()
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodPatch, "/v1/lists/1", `{"name": "Team"}`).StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodDelete, "/v1/lists/1", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodPut, "/v1/lists/1/members/4", "").StatusCode)
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/lists/1/members", "").StatusCode)
+	})
+
+	t.Run("should manage members", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/lists/1/members/4", "").StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodDelete, "/v1/lists/1/members/4", "").StatusCode)
+	})
+
+	t.Run("should paginate list feeds", func(t *testing.T) {
+		type page struct {
+			Data []store.PostWithMetadata `json:"data"`
+			Next *string                  `json:"next"`
+		}
+		res := do(t, http.MethodGet, "/v1/lists/1/feed?limit=20", "")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+		var first page
+		if err := json.NewDecoder(res.Body).Decode(&first); err != nil {
+			t.Fatal(err)
+		}
+		if len(first.Data) != 20 || first.Next == nil {
+			t.Fatalf("unexpected first page: %d posts, next %v", len(first.Data), first.Next)
+		}
+
+		res = do(t, http.MethodGet, "/v1/lists/1/feed?limit=20&cursor="+*first.Next, "")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+		var second page
+		if err := json.NewDecoder(res.Body).Decode(&second); err != nil {
+			t.Fatal(err)
+		}
+		if len(second.Data) != 10 || second.Data[0].ID != 10 || second.Next != nil {
+			t.Errorf("unexpected second page: %d posts, next %v", len(second.Data), second.Next)
+		}
+
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/lists/1/feed?mode=ranked", "").StatusCode)
+	})
+}
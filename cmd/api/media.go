@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"project/internal/blob"
+	"project/internal/media"
+	"project/internal/store"
+)
+
+// UploadMedia godoc
+//
+//	@Summary		Upload media
+//	@Description	Uploads an image that can be attached to posts. A thumbnail is generated alongside it
+//	@Tags			media
+//	@Accept			mpfd
+//	@Produce		json
+//	@Param			file	formData	file	true	"Image file"
+//	@Success		201		{object}	store.Media
+//	@Failure		400		{object}	error
+//	@Failure		413		{object}	error
+//	@Failure		415		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media [post]
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	img, ok := app.readUploadedImage(w, r)
+	if !ok {
+		return
+	}
+
+	thumb, err := media.Thumbnail(img, app.config.upload.thumbnailSize)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	name := uuid.New().String()
+	m := &store.Media{
+		UserID:       user.ID,
+		Key:          fmt.Sprintf("media/%d/%s%s", user.ID, name, img.Ext),
+		ThumbnailKey: fmt.Sprintf("media/%d/%s_thumb%s", user.ID, name, thumb.Ext),
+		ContentType:  img.ContentType,
+		Size:         int64(len(img.Data)),
+		Width:        img.Width,
+		Height:       img.Height,
+	}
+
+	if err := app.putBlob(ctx, m.Key, img); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.putBlob(ctx, m.ThumbnailKey, thumb); err != nil {
+		app.deleteBlobs(ctx, m.Key)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Media.Create(ctx, m); err != nil {
+		app.deleteBlobs(ctx, m.Key, m.ThumbnailKey)
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.setMediaURLs(m)
+
+	if err := app.jsonResponse(w, http.StatusCreated, m); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UploadAvatar godoc
+//
+//	@Summary		Upload avatar
+//	@Description	Uploads an image and makes a resized copy of it the current user's avatar
+//	@Tags			users
+//	@Accept			mpfd
+//	@Produce		json
+//	@Param			file	formData	file	true	"Image file"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		413		{object}	error
+//	@Failure		415		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [put]
+func (app *application) uploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	img, ok := app.readUploadedImage(w, r)
+	if !ok {
+		return
+	}
+
+	avatar, err := media.Thumbnail(img, app.config.upload.avatarSize)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	key := fmt.Sprintf("avatars/%d/%s%s", user.ID, uuid.New().String(), avatar.Ext)
+	if err := app.putBlob(ctx, key, avatar); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user.AvatarURL = app.blobStore.URL(key)
+	if err := app.store.Users.UpdateProfile(ctx, user, app.config.profile.usernameCooldown, nil); err != nil {
+		app.deleteBlobs(ctx, key)
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.invalidateUserCache(ctx, user.ID)
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ServeMedia godoc
+//
+//	@Summary		Download media
+//	@Description	Serves an uploaded file from the blob store to signed in users
+//	@Tags			media
+//	@Produce		octet-stream
+//	@Param			key	path		string	true	"Blob key"
+//	@Success		200	{file}		file
+//	@Failure		401	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media/files/{key} [get]
+func (app *application) serveMediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+	rc, err := app.blobStore.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound), errors.Is(err, blob.ErrInvalidKey):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer rc.Close()
+
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	// keys are random and never reused, so the content never changes, but
+	// shared caches must not hand it out without authentication
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, rc); err != nil {
+		app.logger.Warnw("failed to serve media", "key", key, "error", err)
+	}
+}
+
+// readUploadedImage reads the "file" part of a multipart request and checks
+// its size, type and dimensions. It writes the error response itself and
+// reports whether the caller should carry on.
+func (app *application) readUploadedImage(w http.ResponseWriter, r *http.Request) (*media.Image, bool) {
+	maxBytes := app.config.upload.maxBytes
+	// leave some room for the multipart envelope around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			app.payloadTooLargeError(w, r, err)
+			return nil, false
+		}
+		app.badRequestError(w, r, err)
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return nil, false
+	}
+	if int64(len(data)) > maxBytes {
+		app.payloadTooLargeError(w, r, fmt.Errorf("file exceeds %d bytes", maxBytes))
+		return nil, false
+	}
+
+	img, err := media.Inspect(data, media.Limits{
+		MinDimension: app.config.upload.minDimension,
+		MaxDimension: app.config.upload.maxDimension,
+		MaxPixels:    app.config.upload.maxPixels,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrUnsupportedType):
+			app.unsupportedMediaTypeError(w, r, err)
+		default:
+			app.badRequestError(w, r, err)
+		}
+		return nil, false
+	}
+	return img, true
+}
+
+func (app *application) putBlob(ctx context.Context, key string, img *media.Image) error {
+	return app.blobStore.Put(ctx, key, bytes.NewReader(img.Data), int64(len(img.Data)), img.ContentType)
+}
+
+// deleteBlobs removes files that were stored for a request that failed
+// later on, so that they do not linger without a row referencing them.
+func (app *application) deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := app.blobStore.Delete(ctx, key); err != nil {
+			app.logger.Warnw("failed to delete orphaned blob", "key", key, "error", err)
+		}
+	}
+}
+
+func (app *application) setMediaURLs(items ...*store.Media) {
+	for _, m := range items {
+		m.URL = app.blobStore.URL(m.Key)
+		m.ThumbnailURL = app.blobStore.URL(m.ThumbnailKey)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"project/internal/blob"
+	"project/internal/store"
+	"testing"
+)
+
+// failingMediaStore fails to save uploads, as a lost database connection
+// would.
+type failingMediaStore struct{}
+
+func (s *failingMediaStore) Create(ctx context.Context, m *store.Media) error {
+	return errors.New("connection lost")
+}
+
+func (s *failingMediaStore) GetByIDs(ctx context.Context, userID int64, ids []int64) ([]store.Media, error) {
+	return []store.Media{}, nil
+}
+
+func (s *failingMediaStore) GetByPostID(ctx context.Context, postID int64) ([]store.Media, error) {
+	return []store.Media{}, nil
+}
+
+func (s *failingMediaStore) GetKeysByUserID(ctx context.Context, userID int64) ([]string, error) {
+	return []string{}, nil
+}
+
+func TestMedia(t *testing.T) {
+	app := newTestApp(t, config{upload: uploadConfig{
+		maxBytes:      1 << 20,
+		minDimension:  16,
+		maxDimension:  1000,
+		maxPixels:     200_000,
+		thumbnailSize: 32,
+	}})
+	root := t.TempDir()
+	blobStore, err := blob.NewLocalStore(root, "http://localhost:8080/v1/media/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobStore = blobStore
+	app.store.Media = &failingMediaStore{}
+	mux := app.mount()
+	do := newTestClient(app, mux)
+
+	t.Run("should delete the stored files when saving the upload fails", func(t *testing.T) {
+		body := new(bytes.Buffer)
+		form := multipart.NewWriter(body)
+		part, err := form.CreateFormFile("file", "image.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(part, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+			t.Fatal(err)
+		}
+		form.Close()
+
+		token, _ := app.authenticator.GenerateToken(nil)
+		req, err := http.NewRequest(http.MethodPost, "/v1/media", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		checkResponseCode(t, http.StatusInternalServerError, executeRequest(req, mux).Code)
+
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				t.Errorf("expected no files left, found %s", path)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should only serve files to signed in users", func(t *testing.T) {
+		if err := os.MkdirAll(filepath.Join(root, "media", "1"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "media", "1", "a.png"), []byte("png"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/media/files/media/1/a.png", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, mux).Code)
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/media/files/media/1/a.png", "").StatusCode)
+	})
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/cursor"
+	"project/internal/store"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type messagesConfig struct {
+	// maxGroupSize is how many members a conversation can have, its
+	// creator included
+	maxGroupSize int
+}
+
+type StartConversationPayload struct {
+	UserIDs []int64 `json:"user_ids" validate:"required,min=1"`
+	// Message is sent right away when set.
+	Message string `json:"message" validate:"max=2000"`
+}
+
+type SendMessagePayload struct {
+	Body string `json:"body" validate:"required,max=2000"`
+}
+
+type MessagingSettings struct {
+	FollowersOnly *bool `json:"followers_only" validate:"required"`
+}
+
+type messageEvent struct {
+	ConversationID int64  `json:"conversation_id"`
+	MessageID      int64  `json:"message_id"`
+	SenderID       int64  `json:"sender_id"`
+	Username       string `json:"username"`
+	Body           string `json:"body"`
+	CreatedAt      string `json:"created_at"`
+}
+
+func getConversationID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+}
+
+// messageError answers the errors of starting conversations and sending
+// messages. Both sides of a block, and users outside the followers of a
+// recipient that only accepts their messages, are forbidden.
+func (app *application) messageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundError(w, r, err)
+	case errors.Is(err, store.ErrBlocked), errors.Is(err, store.ErrMessagesRestricted):
+		app.forbiddenResponse(w, r)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// sendMessage stores a message and publishes it to the other members.
+func (app *application) sendMessage(r *http.Request, m *store.Message) error {
+	ctx := r.Context()
+	recipients, err := app.store.Messages.Send(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	app.events.Publish(ctx, MessageSent{Message: m, Sender: getUserFromContext(r), RecipientIDs: recipients})
+	return nil
+}
+
+// Start conversation godoc
+//
+//	@Summary		Starts a conversation
+//	@Description	Starts a one-to-one conversation, or returns the existing one with that user, or a group
+//	@Description	conversation with several users. No two members may have blocked each other, and members that
+//	@Description	only accept messages from people they follow must follow all the others
+//	@Tags			messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		StartConversationPayload	true	"Conversation payload"
+//	@Success		200		{object}	store.Conversation			"Existing conversation"
+//	@Success		201		{object}	store.Conversation			"New conversation"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [post]
+func (app *application) startConversationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload StartConversationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	members := slices.Clone(payload.UserIDs)
+	slices.Sort(members)
+	members = slices.Compact(members)
+	members = slices.DeleteFunc(members, func(id int64) bool { return id == user.ID })
+	if len(members) == 0 {
+		app.badRequestError(w, r, errors.New("cannot start a conversation with yourself"))
+		return
+	}
+	if len(members)+1 > app.config.messages.maxGroupSize {
+		app.badRequestError(w, r, fmt.Errorf("conversations have at most %d members", app.config.messages.maxGroupSize))
+		return
+	}
+
+	ctx := r.Context()
+	id, created, err := app.store.Messages.Start(ctx, user.ID, members)
+	if err != nil {
+		app.messageError(w, r, err)
+		return
+	}
+
+	if payload.Message != "" {
+		if err := app.sendMessage(r, &store.Message{ConversationID: id, SenderID: user.ID, Body: payload.Message}); err != nil {
+			app.messageError(w, r, err)
+			return
+		}
+	}
+
+	conversation, err := app.store.Messages.GetConversation(ctx, id, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	if err := app.jsonResponse(w, status, conversation); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get conversations godoc
+//
+//	@Summary		Lists conversations
+//	@Description	Lists the conversations of the current user, latest activity first, with their last message and
+//	@Description	how many messages are unread
+//	@Tags			messages
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.Conversation
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [get]
+func (app *application) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	conversations, err := app.store.Messages.GetByUserID(r.Context(), user.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, conversations); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Unread messages godoc
+//
+//	@Summary		Counts unread messages
+//	@Description	Counts the messages sent to the current user that they did not read yet
+//	@Tags			messages
+//	@Produce		json
+//	@Success		200	{object}	UnreadCountResponse
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/unread-count [get]
+func (app *application) getUnreadMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	count, err := app.store.Messages.UnreadCount(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, UnreadCountResponse{Count: count}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get conversation godoc
+//
+//	@Summary		Gets a conversation
+//	@Tags			messages
+//	@Produce		json
+//	@Param			conversationID	path		int	true	"Conversation ID"
+//	@Success		200				{object}	store.Conversation
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID} [get]
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getConversationID(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	conversation, err := app.store.Messages.GetConversation(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, conversation); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get messages godoc
+//
+//	@Summary		Lists messages
+//	@Description	Lists the messages of a conversation, latest first, paginated with the cursors of the response
+//	@Tags			messages
+//	@Produce		json
+//	@Param			conversationID	path		int		true	"Conversation ID"
+//	@Param			limit			query		int		false	"Limit"
+//	@Param			cursor			query		string	false	"Cursor of the next or previous page"
+//	@Success		200				{object}	[]store.Message
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [get]
+func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getConversationID(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if pq.Offset != 0 {
+		app.badRequestError(w, r, errors.New("messages are paginated with cursors"))
+		return
+	}
+
+	q := store.MessageQuery{Limit: pq.Limit}
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cur, err := app.cursors.Decode(token)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		position := &store.FeedCursor{CreatedAt: cur.CreatedAt, ID: cur.ID}
+		if cur.Backward {
+			q.Before = position
+		} else {
+			q.After = position
+		}
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	if _, err := app.store.Messages.GetConversation(ctx, id, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// Ask for one message more than the page holds to learn whether
+	// another page follows in the direction we are reading.
+	q.Limit++
+	messages, err := app.store.Messages.GetMessages(ctx, id, user.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	more := len(messages) > pq.Limit
+	backward := q.Before != nil
+	if more {
+		if backward {
+			messages = messages[1:]
+		} else {
+			messages = messages[:pq.Limit]
+		}
+	}
+
+	var next, prev string
+	if len(messages) > 0 {
+		if more || backward {
+			next, err = app.messageCursor(messages[len(messages)-1], false)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+		if (more && backward) || (!backward && q.After != nil) {
+			prev, err = app.messageCursor(messages[0], true)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, messages, next, prev); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) messageCursor(m store.Message, backward bool) (string, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, m.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+	return app.cursors.Encode(cursor.Cursor{CreatedAt: createdAt, ID: m.ID, Backward: backward}), nil
+}
+
+// Send message godoc
+//
+//	@Summary		Sends a message
+//	@Description	Sends a message to a conversation and streams it to the other members. Members blocked since the
+//	@Description	conversation started do not receive it, and direct conversations with them are closed
+//	@Tags			messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int					true	"Conversation ID"
+//	@Param			payload			body		SendMessagePayload	true	"Message payload"
+//	@Success		201				{object}	store.Message
+//	@Failure		400				{object}	error
+//	@Failure		403				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [post]
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getConversationID(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var payload SendMessagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	message := &store.Message{ConversationID: id, SenderID: user.ID, Body: payload.Body}
+	if err := app.sendMessage(r, message); err != nil {
+		app.messageError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, message); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Mark conversation read godoc
+//
+//	@Summary		Marks a conversation as read
+//	@Tags			messages
+//	@Param			conversationID	path		int	true	"Conversation ID"
+//	@Success		204				{object}	nil
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/read [put]
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getConversationID(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if err := app.store.Messages.MarkRead(r.Context(), id, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get messaging settings godoc
+//
+//	@Summary		Gets messaging settings
+//	@Description	Reports whether the current user only accepts messages from people they follow
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	MessagingSettings
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/messaging [get]
+func (app *application) getMessagingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	followersOnly, err := app.store.Messages.GetFollowersOnly(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, MessagingSettings{FollowersOnly: &followersOnly}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Update messaging settings godoc
+//
+//	@Summary		Updates messaging settings
+//	@Description	Restricts who can message the current user to the people they follow, or lifts the restriction
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MessagingSettings	true	"Messaging settings"
+//	@Success		200		{object}	MessagingSettings
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/messaging [put]
+func (app *application) updateMessagingSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MessagingSettings
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if err := app.store.Messages.SetFollowersOnly(r.Context(), user.ID, *payload.FollowersOnly); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, payload); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
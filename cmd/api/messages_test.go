@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"project/internal/store"
+	"testing"
+)
+
+// pagedMessageStore holds 30 messages in every conversation, and already
+// has a direct conversation with everyone.
+type pagedMessageStore struct {
+	store.MockMessageStore
+}
+
+func (s *pagedMessageStore) Start(ctx context.Context, creatorID int64, memberIDs []int64) (int64, bool, error) {
+	return 1, len(memberIDs) > 1, nil
+}
+
+func (s *pagedMessageStore) GetMessages(ctx context.Context, conversationID, userID int64, q store.MessageQuery) ([]store.Message, error) {
+	var messages []store.Message
+	for _, item := range cursorPage(q.Limit, q.After) {
+		messages = append(messages, store.Message{
+			ID:             item.ID,
+			ConversationID: conversationID,
+			Body:           item.Text,
+			CreatedAt:      item.CreatedAt,
+		})
+	}
+	return messages, nil
+}
+
+func TestMessages(t *testing.T) {
+	app := newTestApp(t, config{messages: messagesConfig{maxGroupSize: 3}})
+	mockStore := app.store
+	mockStore.Messages = &pagedMessageStore{}
+	app.store = mockStore
+	do := newTestClient(app, app.mount())
+
+	t.Run("should start conversations", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPost, "/v1/conversations", `{"user_ids": [4, 4]}`).StatusCode)
+		checkResponseCode(t, http.StatusCreated, do(t, http.MethodPost, "/v1/conversations", `{"user_ids": [4, 5], "message": "hi"}`).StatusCode)
+	})
+
+	t.Run("should reject invalid members", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/conversations", `{"user_ids": []}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/conversations", `{"user_ids": [0]}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/conversations", `{"user_ids": [4, 5, 6]}`).StatusCode)
+	})
+
+	t.Run("should send messages", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, do(t, http.MethodPost, "/v1/conversations/1/messages", `{"body": "hello"}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/conversations/1/messages", `{"body": ""}`).StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/conversations/1/read", "").StatusCode)
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/conversations/unread-count", "").StatusCode)
+	})
+
+	t.Run("should paginate messages with cursors", func(t *testing.T) {
+		type page struct {
+			Data []store.Message `json:"data"`
+			Next *string         `json:"next"`
+			Prev *string         `json:"prev"`
+		}
+		read := func(t *testing.T, path string) page {
+			t.Helper()
+			res := do(t, http.MethodGet, path, "")
+			checkResponseCode(t, http.StatusOK, res.StatusCode)
+			var p page
+			if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			return p
+		}
+
+		first := read(t, "/v1/conversations/1/messages?limit=20")
+		if len(first.Data) != 20 || first.Data[0].ID != 30 || first.Next == nil || first.Prev != nil {
+			t.Fatalf("unexpected first page: %d messages, next %v, prev %v", len(first.Data), first.Next, first.Prev)
+		}
+
+		second := read(t, "/v1/conversations/1/messages?limit=20&cursor="+*first.Next)
+		if len(second.Data) != 10 || second.Data[0].ID != 10 || second.Next != nil || second.Prev == nil {
+			t.Errorf("unexpected second page: %d messages, next %v, prev %v", len(second.Data), second.Next, second.Prev)
+		}
+
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/conversations/1/messages?cursor=forged", "").StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/conversations/1/messages?offset=20", "").StatusCode)
+	})
+
+	t.Run("should update messaging settings", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPut, "/v1/users/me/messaging", `{"followers_only": true}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPut, "/v1/users/me/messaging", `{}`).StatusCode)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"project/internal/store"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (app *application) BasicAuthMiddleWare() func(http.Handler) http.Handler {
@@ -78,6 +79,10 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			app.unAuthResponse(w, r, err)
 			return
 		}
+		if user.SuspendedUntil != nil && time.Now().Before(*user.SuspendedUntil) {
+			app.forbiddenResponse(w, r)
+			return
+		}
 		ctx = context.WithValue(ctx, userCtx, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -93,6 +98,27 @@ func (app *application) checkPostOwnership(role string, next http.HandlerFunc) h
 			return
 		}
 
+		// community moderators look after the posts of their community, as
+		// long as they outrank the author there
+		if post.CommunityID != nil {
+			member, err := app.communityMember(r.Context(), *post.CommunityID, user.ID)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if member.HasRole(store.CommunityRoleModerator) {
+				author, err := app.communityMember(r.Context(), *post.CommunityID, post.UserId)
+				if err != nil {
+					app.internalServerError(w, r, err)
+					return
+				}
+				if member.Outranks(author) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
 		//check the role for user
 		//app.logger.Info(user.Role)
 		allowed, err := app.checkRole(r.Context(), user, role)
@@ -110,6 +136,25 @@ func (app *application) checkPostOwnership(role string, next http.HandlerFunc) h
 	}
 }
 
+// requireRole lets through users whose global role is role or a higher one.
+func (app *application) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.checkRole(r.Context(), getUserFromContext(r), role)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *application) checkRole(ctx context.Context, user *store.User, requiredRole string) (bool, error) {
 	role, err := app.store.Roles.GetByName(ctx, requiredRole)
 
@@ -140,6 +185,13 @@ func (app *application) getUserFromCache(ctx context.Context, userID int64) (*st
 	return user, nil
 }
 
+func (app *application) invalidateUserCache(ctx context.Context, userID int64) {
+	if !app.config.redisConfig.enabled {
+		return
+	}
+	app.cacheStorage.Users.Delete(ctx, userID)
+}
+
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.rateLimiter.Enabled {
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/store"
+	"project/internal/stream"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type notificationEvent struct {
+	Type   string                   `json:"type"`
+	Actor  *store.NotificationActor `json:"actor"`
+	PostID int64                    `json:"post_id,omitempty"`
+}
+
+type UnreadCountResponse struct {
+	Count int `json:"count"`
+}
+
+// notify records a notification for recipients and streams it to those
+// that receive it. actor is nil for moderation. Like publishEvent, failing
+// to notify must not fail the request that caused it.
+func (app *application) notify(ctx context.Context, n store.NewNotification, actor *store.User, recipientIDs ...int64) {
+	if len(recipientIDs) == 0 {
+		return
+	}
+
+	event := notificationEvent{Type: n.Type, PostID: n.PostID}
+	if actor != nil {
+		n.ActorID = actor.ID
+		event.Actor = &store.NotificationActor{ID: actor.ID, Username: actor.Username}
+	}
+
+	notified, err := app.store.Notifications.Create(ctx, n, recipientIDs)
+	if err != nil {
+		app.logger.Warnw("failed to notify", "type", n.Type, "error", err)
+		return
+	}
+	for _, id := range notified {
+		app.publishEvent(ctx, id, stream.EventNotification, event)
+	}
+}
+
+// notifyMentions notifies the users mentioned in a post that were not
+// mentioned before and can see it.
+func (app *application) notifyMentions(ctx context.Context, post *store.Post, author *store.User, before []store.Mention) {
+	var recipients []int64
+	for _, m := range post.Mentions {
+		if slices.ContainsFunc(before, func(b store.Mention) bool { return b.UserID == m.UserID }) ||
+			slices.Contains(recipients, m.UserID) {
+			continue
+		}
+
+		viewer, err := app.store.Users.GetByID(ctx, m.UserID)
+		if err != nil {
+			app.logger.Warnw("failed to notify mention", "post", post.ID, "error", err)
+			continue
+		}
+		ok, err := app.canViewContentOf(ctx, viewer, author.ID)
+		if err != nil {
+			app.logger.Warnw("failed to notify mention", "post", post.ID, "error", err)
+			continue
+		}
+		if ok {
+			recipients = append(recipients, m.UserID)
+		}
+	}
+
+	app.notify(ctx, store.NewNotification{Type: store.NotificationMention, PostID: post.ID}, author, recipients...)
+}
+
+// notifyModeration tells the author of a post that someone else with a
+// moderating role changed it.
+func (app *application) notifyModeration(ctx context.Context, post *store.Post, moderator *store.User, action string) {
+	if post.UserId == moderator.ID {
+		return
+	}
+
+	n := store.NewNotification{
+		Type: store.NotificationModeration,
+		Data: map[string]string{"action": action, "title": post.Title},
+	}
+	if action != "removed" {
+		n.PostID = post.ID
+	}
+	app.notify(ctx, n, nil, post.UserId)
+}
+
+// notificationMessage summarizes a notification group, e.g. "alice and 4
+// others reacted to your post".
+func notificationMessage(n store.Notification) string {
+	if n.Type == store.NotificationModeration {
+		var data struct {
+			Action string `json:"action"`
+			Title  string `json:"title"`
+			Target string `json:"target"`
+		}
+		_ = json.Unmarshal(n.Data, &data)
+		switch {
+		case data.Title != "":
+			return fmt.Sprintf("A moderator %s your post %q", data.Action, data.Title)
+		case data.Target != "":
+			return fmt.Sprintf("A moderator %s your %s", data.Action, data.Target)
+		}
+		return fmt.Sprintf("A moderator %s you", data.Action)
+	}
+
+	var actors string
+	switch {
+	case len(n.Actors) == 0:
+		actors = "Someone"
+	case n.ActorCount == 1:
+		actors = n.Actors[0].Username
+	case n.ActorCount == 2 && len(n.Actors) == 2:
+		actors = n.Actors[0].Username + " and " + n.Actors[1].Username
+	case n.ActorCount == 2:
+		actors = n.Actors[0].Username + " and 1 other"
+	default:
+		actors = fmt.Sprintf("%s and %d others", n.Actors[0].Username, n.ActorCount-1)
+	}
+
+	var action string
+	switch n.Type {
+	case store.NotificationFollow:
+		action = "followed you"
+	case store.NotificationFollowRequest:
+		action = "requested to follow you"
+	case store.NotificationComment:
+		action = "commented on your post"
+	case store.NotificationReply:
+		action = "replied to a post you commented on"
+	case store.NotificationReaction:
+		action = "reacted to your post"
+	case store.NotificationMention:
+		action = "mentioned you in a post"
+	default:
+		action = strings.ReplaceAll(n.Type, "_", " ")
+	}
+	return actors + " " + action
+}
+
+// Get notifications godoc
+//
+//	@Summary		Lists notifications
+//	@Description	Lists the notifications of the current user, latest first. Follows, follow requests and the comments,
+//	@Description	replies and reactions on a post are grouped, naming up to three of their latest actors
+//	@Tags			notifications
+//	@Produce		json
+//	@Param			unread	query		bool	false	"Only groups with unread notifications"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.Notification
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications [get]
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var unreadOnly bool
+	if v := r.URL.Query().Get("unread"); v != "" {
+		unreadOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid unread %q", v))
+			return
+		}
+	}
+
+	user := getUserFromContext(r)
+	notifications, err := app.store.Notifications.GetByUserID(r.Context(), user.ID, unreadOnly, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for i := range notifications {
+		notifications[i].Message = notificationMessage(notifications[i])
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, notifications); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Unread notifications godoc
+//
+//	@Summary		Counts unread notifications
+//	@Description	Counts the notification groups with unread notifications
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	UnreadCountResponse
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/unread-count [get]
+func (app *application) getUnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	count, err := app.store.Notifications.UnreadCount(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, UnreadCountResponse{Count: count}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Mark notification read godoc
+//
+//	@Summary		Marks a notification as read
+//	@Description	Marks a notification as read along with the earlier ones of its group
+//	@Tags			notifications
+//	@Param			notificationID	path		int	true	"Notification ID"
+//	@Success		204				{object}	nil
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/{notificationID}/read [put]
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if err := app.store.Notifications.MarkRead(r.Context(), user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Mark all notifications read godoc
+//
+//	@Summary		Marks all notifications as read
+//	@Tags			notifications
+//	@Success		204	{object}	nil
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/read [put]
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if err := app.store.Notifications.MarkAllRead(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get notification preferences godoc
+//
+//	@Summary		Gets notification preferences
+//	@Description	Reports which notification types the current user receives
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	map[string]bool
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [get]
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	prefs, err := app.store.Notifications.GetPreferences(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Update notification preferences godoc
+//
+//	@Summary		Updates notification preferences
+//	@Description	Turns notification types on or off. Types left out keep their setting
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		map[string]bool	true	"Enabled state by type"
+//	@Success		200		{object}	map[string]bool
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [patch]
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]bool
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	for t := range payload {
+		if !slices.Contains(store.NotificationTypes, t) {
+			app.badRequestError(w, r, fmt.Errorf("unknown notification type %q", t))
+			return
+		}
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	if err := app.store.Notifications.SetPreferences(ctx, user.ID, payload); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	prefs, err := app.store.Notifications.GetPreferences(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"project/internal/store"
+	"testing"
+)
+
+func TestNotifications(t *testing.T) {
+	app := newTestApp(t, config{})
+	do := newTestClient(app, app.mount())
+
+	t.Run("should list notifications", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/notifications?unread=true&limit=10", "").StatusCode)
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/notifications/unread-count", "").StatusCode)
+	})
+
+	t.Run("should reject malformed parameters", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/notifications?unread=maybe", "").StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/notifications?limit=500", "").StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPut, "/v1/notifications/abc/read", "").StatusCode)
+	})
+
+	t.Run("should mark notifications read", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/notifications/1/read", "").StatusCode)
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/notifications/read", "").StatusCode)
+	})
+
+	t.Run("should update preferences of known types only", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPatch, "/v1/notifications/preferences", `{"reaction": false}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPatch, "/v1/notifications/preferences", `{"likes": false}`).StatusCode)
+	})
+}
+
+func TestNotificationMessage(t *testing.T) {
+	alice := store.NotificationActor{ID: 1, Username: "alice"}
+	bob := store.NotificationActor{ID: 2, Username: "bob"}
+	carol := store.NotificationActor{ID: 3, Username: "carol"}
+
+	tests := []struct {
+		n    store.Notification
+		want string
+	}{
+		{store.Notification{Type: store.NotificationFollow, Actors: []store.NotificationActor{alice}, ActorCount: 1}, "alice followed you"},
+		{store.Notification{Type: store.NotificationComment, Actors: []store.NotificationActor{alice, bob}, ActorCount: 2}, "alice and bob commented on your post"},
+		{store.Notification{Type: store.NotificationReaction, Actors: []store.NotificationActor{alice, bob, carol}, ActorCount: 5}, "alice and 4 others reacted to your post"},
+		{store.Notification{Type: store.NotificationModeration, Data: json.RawMessage(`{"action":"removed","title":"Hi"}`)}, `A moderator removed your post "Hi"`},
+	}
+	for _, tt := range tests {
+		if got := notificationMessage(tt.n); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
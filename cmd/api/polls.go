@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/store"
+	"time"
+)
+
+type pollsConfig struct {
+	// minDuration and maxDuration bound how long polls stay open
+	minDuration time.Duration
+	maxDuration time.Duration
+	// interval is how often closed polls get their results frozen
+	interval  time.Duration
+	batchSize int
+}
+
+type CreatePollPayload struct {
+	Options  []string  `json:"options" validate:"required,min=2,max=6,unique,dive,required,max=100"`
+	Multiple bool      `json:"multiple"`
+	ClosesAt time.Time `json:"closes_at" validate:"required"`
+}
+
+type VotePollPayload struct {
+	OptionIDs []int64 `json:"option_ids" validate:"required,min=1,max=6,unique"`
+}
+
+// newPoll builds the poll of a post being created, checking that it closes
+// within the bounds of the config.
+func (app *application) newPoll(payload *CreatePollPayload) (*store.Poll, error) {
+	cfg := app.config.polls
+	open := time.Until(payload.ClosesAt)
+	if open < cfg.minDuration || open > cfg.maxDuration {
+		return nil, fmt.Errorf("polls must close between %s and %s from now", cfg.minDuration, cfg.maxDuration)
+	}
+
+	poll := &store.Poll{
+		Multiple: payload.Multiple,
+		ClosesAt: payload.ClosesAt.UTC().Format(time.RFC3339),
+		Options:  make([]store.PollOption, len(payload.Options)),
+	}
+	for i, text := range payload.Options {
+		poll.Options[i].Text = text
+	}
+	return poll, nil
+}
+
+// loadPolls fills in the polls of posts, as seen by viewerID, with one
+// query.
+func (app *application) loadPolls(ctx context.Context, viewerID int64, posts ...*store.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	polls, err := app.store.Polls.GetByPostIDs(ctx, viewerID, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		p.Poll = polls[p.ID]
+	}
+	return nil
+}
+
+// Get poll godoc
+//
+//	@Summary		Fetches the poll of a post
+//	@Description	Fetches the poll of a post. Vote counts are only shown to users who voted, or once the poll closed
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postId	path		int	true	"Post ID"
+//	@Success		200		{object}	store.Poll
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/poll [get]
+func (app *application) getPollHandler(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.readPoll(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post.Poll); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Vote poll godoc
+//
+//	@Summary		Votes in the poll of a post
+//	@Description	Votes for one option of a poll, or several if it is multiple choice. Each user votes once,
+//	@Description	until the poll closes. Returns the poll with its results
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postId	path		int				true	"Post ID"
+//	@Param			payload	body		VotePollPayload	true	"Vote payload"
+//	@Success		200		{object}	store.Poll
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postId}/poll/votes [post]
+func (app *application) votePollHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VotePollPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	post, ok := app.readPoll(w, r)
+	if !ok {
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	if err := app.store.Polls.Vote(ctx, post.ID, user.ID, payload.OptionIDs); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, errors.New("already voted"))
+		case errors.Is(err, store.ErrPollClosed), errors.Is(err, store.ErrInvalidVote):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loadPolls(ctx, user.ID, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, post.Poll); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// readPoll loads the poll of the post of the request, answering with a 404
+// when the post has none or its author is hidden from the user.
+func (app *application) readPoll(w http.ResponseWriter, r *http.Request) (*store.Post, bool) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	visible, err := app.canViewContentOf(ctx, user, post.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	if !visible {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return nil, false
+	}
+
+	if err := app.loadPolls(ctx, user.ID, post); err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	if post.Poll == nil {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return nil, false
+	}
+	return post, true
+}
+
+// freezePolls stores the final results of the polls that closed.
+func (app *application) freezePolls(ctx context.Context) error {
+	for {
+		n, err := app.store.Polls.Freeze(ctx, app.config.polls.batchSize)
+		if err != nil {
+			return err
+		}
+		if n < int64(app.config.polls.batchSize) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"project/internal/store"
+	"testing"
+	"time"
+)
+
+// pollPostStore holds posts of the test user; all but post 4 have a poll.
+type pollPostStore struct {
+	mentionlessPostStore
+}
+
+func (s *pollPostStore) Create(ctx context.Context, post *store.Post) error {
+	post.ID = 1
+	return nil
+}
+
+func (s *pollPostStore) GetByID(ctx context.Context, id int64) (*store.Post, error) {
+	return &store.Post{ID: id}, nil
+}
+
+// closingPollStore holds an open poll on post 1, a closed one on post 2
+// and one the test user voted in on post 3.
+type closingPollStore struct {
+	store.MockPollStore
+}
+
+func (s *closingPollStore) GetByPostIDs(ctx context.Context, viewerID int64, postIDs []int64) (map[int64]*store.Poll, error) {
+	polls := make(map[int64]*store.Poll)
+	for _, id := range postIDs {
+		if id < 4 {
+			polls[id] = &store.Poll{Options: []store.PollOption{{ID: 1}, {ID: 2}}}
+		}
+	}
+	return polls, nil
+}
+
+func (s *closingPollStore) Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error {
+	switch postID {
+	case 2:
+		return store.ErrPollClosed
+	case 3:
+		return store.ErrConflict
+	}
+	return nil
+}
+
+func TestPolls(t *testing.T) {
+	app := newTestApp(t, config{polls: pollsConfig{minDuration: time.Minute, maxDuration: time.Hour * 24}})
+	mockStore := app.store
+	mockStore.Posts = &pollPostStore{}
+	mockStore.Polls = &closingPollStore{}
+	app.store = mockStore
+	do := newTestClient(app, app.mount())
+	post := func(t *testing.T, options string, closesIn time.Duration) int {
+		t.Helper()
+		body := fmt.Sprintf(`{"title": "Lunch?", "content": "Where to", "poll": {"options": %s, "closes_at": %q}}`,
+			options, time.Now().Add(closesIn).Format(time.RFC3339))
+		return do(t, http.MethodPost, "/v1/posts", body).StatusCode
+	}
+
+	t.Run("should create posts with polls", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, post(t, `["pizza", "sushi"]`, time.Hour))
+	})
+
+	t.Run("should validate polls", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, post(t, `["pizza"]`, time.Hour))
+		checkResponseCode(t, http.StatusBadRequest, post(t, `["a", "b", "c", "d", "e", "f", "g"]`, time.Hour))
+		checkResponseCode(t, http.StatusBadRequest, post(t, `["pizza", "pizza"]`, time.Hour))
+		checkResponseCode(t, http.StatusBadRequest, post(t, `["pizza", "sushi"]`, time.Hour*48))
+		checkResponseCode(t, http.StatusBadRequest, post(t, `["pizza", "sushi"]`, -time.Hour))
+	})
+
+	t.Run("should vote once while polls are open", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPost, "/v1/posts/1/poll/votes", `{"option_ids": [1]}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/posts/1/poll/votes", `{"option_ids": []}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/posts/2/poll/votes", `{"option_ids": [1]}`).StatusCode)
+		checkResponseCode(t, http.StatusConflict, do(t, http.MethodPost, "/v1/posts/3/poll/votes", `{"option_ids": [1]}`).StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodPost, "/v1/posts/4/poll/votes", `{"option_ids": [1]}`).StatusCode)
+	})
+
+	t.Run("should fetch polls", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/posts/1/poll", "").StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodGet, "/v1/posts/4/poll", "").StatusCode)
+	})
+}
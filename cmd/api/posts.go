@@ -3,16 +3,23 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	"project/internal/richtext"
 	"project/internal/store"
 	"strconv"
+	"strings"
 )
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=5000"`
-	Tags    []string `json:"tags"`
+	Title         string   `json:"title" validate:"required,max=100"`
+	Content       string   `json:"content" validate:"required,max=5000"`
+	Tags          []string `json:"tags" validate:"max=10"`
+	AttachmentIDs []int64  `json:"attachment_ids" validate:"omitempty,unique"`
+	// CommunityID posts in a community the author is an active member of.
+	CommunityID *int64             `json:"community_id"`
+	Poll        *CreatePollPayload `json:"poll" validate:"omitempty"`
 }
 
 type postKey string
@@ -22,13 +29,16 @@ const postCtx postKey = "post"
 // Create post godoc
 //
 //	@Summary		Create post
-//	@Description	Follow a user by ID
+//	@Description	Create a post. #hashtags in the content are added to its tags and @mentions of existing users are linked.
+//	@Description	Posts can be made in a community the author is a member of. An uploaded file can only be attached to one post
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreatePostPayload	true	"Post payload"
 //	@Success		201		{object}	store.Post
 //	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		409		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/posts [post]
@@ -44,16 +54,77 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		app.badRequestError(w, r, err)
 		return
 	}
+	if err := checkTags(payload.Tags); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if len(payload.AttachmentIDs) > app.config.upload.maxAttachments {
+		app.badRequestError(w, r, fmt.Errorf("a post can have at most %d attachments", app.config.upload.maxAttachments))
+		return
+	}
+
 	user := getUserFromContext(r)
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserId:  user.ID,
+		Title:       payload.Title,
+		Content:     payload.Content,
+		Tags:        richtext.Tags(payload.Tags, payload.Content),
+		UserId:      user.ID,
+		Language:    app.config.search.language,
+		CommunityID: payload.CommunityID,
 	}
 	ctx := r.Context()
-	if err := app.store.Posts.Create(ctx, post); err != nil {
-		app.internalServerError(w, r, err)
+
+	if payload.Poll != nil {
+		poll, err := app.newPoll(payload.Poll)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		post.Poll = poll
+	}
+
+	if payload.CommunityID != nil {
+		member, err := app.communityMember(ctx, *payload.CommunityID, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !member.HasRole(store.CommunityRoleMember) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	if len(payload.AttachmentIDs) > 0 {
+		attachments, err := app.store.Media.GetByIDs(ctx, user.ID, payload.AttachmentIDs)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if len(attachments) != len(payload.AttachmentIDs) {
+			app.badRequestError(w, r, errors.New("unknown attachment"))
+			return
+		}
+		post.Attachments = attachments
+	}
+
+	err := app.store.InTx(ctx, func(ctx context.Context) error {
+		if err := app.store.Posts.Create(ctx, post); err != nil {
+			return err
+		}
+		for i := range post.Attachments {
+			app.setMediaURLs(&post.Attachments[i])
+		}
+		app.events.Publish(ctx, PostCreated{Post: post, Author: user})
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, errors.New("attachment already used by another post"))
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -95,7 +166,18 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	comments, err := app.store.Comments.GetByPostID(ctx, id)
+	viewer := getUserFromContext(r)
+	visible, err := app.canViewContentOf(ctx, viewer, post.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !visible {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	comments, err := app.store.Comments.GetByPostID(ctx, id, viewer.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -103,6 +185,25 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post.Comments = comments
 
+	if err := app.loadMentions(ctx, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.loadPolls(ctx, viewer.ID, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	attachments, err := app.store.Media.GetByPostID(ctx, id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	post.Attachments = attachments
+	for i := range post.Attachments {
+		app.setMediaURLs(&post.Attachments[i])
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -110,8 +211,9 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=5000"`
+	Title   *string   `json:"title" validate:"omitempty,max=100"`
+	Content *string   `json:"content" validate:"omitempty,max=5000"`
+	Tags    *[]string `json:"tags" validate:"omitempty,max=10"`
 }
 
 // Update post godoc
@@ -142,18 +244,54 @@ func (app *application) patchPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if payload.Content != nil {
-		post.Content = *payload.Content
+	if payload.Content != nil || payload.Tags != nil {
+		// Without new client tags, keep the current ones except those that
+		// only came from hashtags in the old content.
+		var tags []string
+		if payload.Tags != nil {
+			if err := checkTags(*payload.Tags); err != nil {
+				app.badRequestError(w, r, err)
+				return
+			}
+			tags = *payload.Tags
+		} else {
+			parsed := map[string]bool{}
+			for _, h := range richtext.Parse(post.Content).Hashtags {
+				parsed[h.Value] = true
+			}
+			for _, t := range post.Tags {
+				if !parsed[t] {
+					tags = append(tags, t)
+				}
+			}
+		}
+		if payload.Content != nil {
+			post.Content = *payload.Content
+		}
+		post.Tags = richtext.Tags(tags, post.Content)
 	}
 
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
 
-	if err := app.store.Posts.Edit(r.Context(), post); err != nil {
+	ctx := r.Context()
+	if err := app.loadMentions(ctx, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	mentioned := post.Mentions
+	if err := app.store.Posts.Edit(ctx, post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.conflictError(w, r, errors.New("post was modified concurrently, reload it and try again"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.events.Publish(ctx, PostEdited{Post: post, Editor: getUserFromContext(r), Mentioned: mentioned})
 
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -181,8 +319,13 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		app.internalServerError(w, r, err)
 		return
 	}
-	ctx := r.Context()
-	err = app.store.Posts.Delete(ctx, id)
+	err = app.store.InTx(r.Context(), func(ctx context.Context) error {
+		if err := app.store.Posts.Delete(ctx, id); err != nil {
+			return err
+		}
+		app.events.Publish(ctx, PostDeleted{Post: getPostFromCtx(r), DeletedBy: getUserFromContext(r)})
+		return nil
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
@@ -192,9 +335,63 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Search posts godoc
+//
+//	@Summary		Search posts
+//	@Description	Full-text search over post titles, contents and tags. Supports "quoted phrases", OR and -exclusion.
+//	@Description	Highlights are HTML: the post text is escaped and matches are wrapped in <mark> tags
+//	@Tags			posts
+//	@Produce		json
+//	@Param			q		query		string	true	"Search query"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.PostSearchResult
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/search [get]
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	sq := store.PostSearchQuery{
+		Query:  strings.TrimSpace(r.URL.Query().Get("q")),
+		Limit:  pq.Limit,
+		Offset: pq.Offset,
+	}
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	viewer := getUserFromContext(r)
+	results, err := app.store.Posts.Search(r.Context(), viewer.ID, sq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	list := make([]*store.Post, len(results))
+	for i := range results {
+		list[i] = &results[i].Post
+	}
+	if err := app.loadMentions(r.Context(), list...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		postId := chi.URLParam(r, "postId")
@@ -215,12 +412,31 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			}
 			return
 		}
+		// A hidden post is gone to everyone but its author and moderators.
+		visible, err := app.canSeePost(ctx, getUserFromContext(r), post)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !visible {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
 
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// canSeePost reports whether viewer may see a post that a moderator may have
+// hidden: only its author and moderators still see hidden posts.
+func (app *application) canSeePost(ctx context.Context, viewer *store.User, post *store.Post) (bool, error) {
+	if !post.Hidden || post.UserId == viewer.ID {
+		return true, nil
+	}
+	return app.checkRole(ctx, viewer, "moderator")
+}
+
 func getPostFromCtx(r *http.Request) *store.Post {
 	post := r.Context().Value(postCtx).(*store.Post)
 	return post
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"net/http"
+	"project/internal/mailer"
+	"project/internal/store"
+	"strings"
+)
+
+type UpdateProfilePayload struct {
+	Username    *string `json:"username" validate:"omitempty,min=3,max=100"`
+	Email       *string `json:"email" validate:"omitempty,email,max=255"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	Website     *string `json:"website" validate:"omitempty,url,max=255"`
+	Location    *string `json:"location" validate:"omitempty,max=100"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitempty,url"`
+}
+
+type ProfileResponse struct {
+	*store.User
+	PendingEmail string `json:"pending_email,omitempty"`
+}
+
+// UpdateProfile godoc
+//
+//	@Summary		Update profile
+//	@Description	Updates the current user's profile. A new email only takes effect once confirmed through the emailed link
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfilePayload	true	"Profile payload"
+//	@Success		200		{object}	ProfileResponse
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if payload.Username != nil {
+		user.Username = strings.TrimSpace(*payload.Username)
+	}
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+	if payload.Website != nil {
+		user.Website = *payload.Website
+	}
+	if payload.Location != nil {
+		user.Location = *payload.Location
+	}
+	if payload.AvatarURL != nil {
+		user.AvatarURL = *payload.AvatarURL
+	}
+
+	var (
+		change     *store.EmailChange
+		plainToken string
+	)
+	if payload.Email != nil && !strings.EqualFold(*payload.Email, user.Email) {
+		plainToken = uuid.New().String()
+		hash := sha256.Sum256([]byte(plainToken))
+		change = &store.EmailChange{
+			Email: *payload.Email,
+			Token: hex.EncodeToString(hash[:]),
+			Exp:   app.config.mail.exp,
+		}
+	}
+
+	ctx := r.Context()
+	if err := app.store.Users.UpdateProfile(ctx, user, app.config.profile.usernameCooldown, change); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateUsername), errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrUsernameCooldown):
+			app.badRequestError(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.invalidateUserCache(ctx, user.ID)
+
+	response := ProfileResponse{User: user}
+	if change != nil {
+		app.events.Publish(ctx, EmailChangeRequested{User: user, Email: change.Email, Token: plainToken})
+		response.PendingEmail = change.Email
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// sendEmailVerification mails the link confirming a requested email change
+// to the new address.
+func (app *application) sendEmailVerification(e EmailChangeRequested) error {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username        string
+		ConfirmationURL string
+	}{
+		Username:        e.User.Username,
+		ConfirmationURL: fmt.Sprintf("%s/confirm-email/%s", app.config.frontendURL, e.Token),
+	}
+	_, err := app.mailer.Send(mailer.EmailVerificationTemplate, e.User.Username, e.Email, vars, !isProdEnv)
+	return err
+}
+
+// ConfirmEmail godoc
+//
+//	@Summary		Confirm email change
+//	@Description	Moves the account to the new email address the token was sent to
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	path		string	true	"Verification token"
+//	@Success		204		{string}	string	"Email confirmed"
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/email/confirm/{token} [put]
+func (app *application) confirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	ctx := r.Context()
+
+	user, err := app.store.Users.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.invalidateUserCache(ctx, user.ID)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"project/internal/store"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// emailChangeUserStore remembers the email change saved with the profile.
+// The address taken@example.com belongs to another account.
+type emailChangeUserStore struct {
+	store.MockUserStore
+	change *store.EmailChange
+}
+
+func (s *emailChangeUserStore) UpdateProfile(ctx context.Context, user *store.User, usernameCooldown time.Duration, change *store.EmailChange) error {
+	if change != nil && change.Email == "taken@example.com" {
+		return store.ErrDuplicateEmail
+	}
+	s.change = change
+	return nil
+}
+
+func TestUpdateProfile(t *testing.T) {
+	app := newTestApp(t, config{frontendURL: "http://localhost:4000"})
+	users := &emailChangeUserStore{}
+	app.store.Users = users
+	mailer := &renderingMailer{}
+	app.mailer = mailer
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	t.Run("should update profile fields", func(t *testing.T) {
+		body := strings.NewReader(`{"display_name": "Gopher", "bio": "Writes Go"}`)
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if !strings.Contains(rr.Body.String(), `"display_name":"Gopher"`) {
+			t.Errorf("expected updated display name in response, got %s", rr.Body.String())
+		}
+		if users.change != nil || mailer.body != "" {
+			t.Error("expected no email change without a new email")
+		}
+	})
+
+	t.Run("should reject invalid website", func(t *testing.T) {
+		body := strings.NewReader(`{"website": "not a url"}`)
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should save the email change with the profile and mail the link", func(t *testing.T) {
+		body := strings.NewReader(`{"bio": "Moved", "email": "new@example.com"}`)
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if !strings.Contains(rr.Body.String(), `"pending_email":"new@example.com"`) {
+			t.Errorf("expected the pending email in response, got %s", rr.Body.String())
+		}
+		if users.change == nil || users.change.Email != "new@example.com" {
+			t.Fatalf("expected the email change to be saved, got %+v", users.change)
+		}
+
+		match := regexp.MustCompile(`http://localhost:4000/confirm-email/([0-9a-f-]+)`).FindStringSubmatch(mailer.body)
+		if match == nil {
+			t.Fatalf("expected a confirmation link in the email, got %s", mailer.body)
+		}
+		hash := sha256.Sum256([]byte(match[1]))
+		if hex.EncodeToString(hash[:]) != users.change.Token {
+			t.Error("expected the mailed token to match the stored hash")
+		}
+	})
+
+	t.Run("should not mail a taken email", func(t *testing.T) {
+		mailer.body = ""
+		body := strings.NewReader(`{"email": "taken@example.com"}`)
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusConflict, rr.Code)
+		if mailer.body != "" {
+			t.Error("expected no email for a rejected change")
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"project/internal/ranking"
+	"project/internal/store"
+	"time"
+)
+
+// newRanker builds the ranker of the "for you" feed from cfg, scoring
+// against the now clock.
+func newRanker(cfg rankingConfig, now func() time.Time) ranking.Ranker {
+	return ranking.Ranker{
+		Scorers: []ranking.Weighted{
+			{Scorer: ranking.Recency{HalfLife: cfg.halfLife}, Weight: cfg.weights.recency},
+			{Scorer: ranking.Engagement{Comment: 2, Reaction: 1, Repost: 3, Saturation: 100}, Weight: cfg.weights.engagement},
+			{Scorer: ranking.AuthorAffinity{}, Weight: cfg.weights.authorAffinity},
+			{Scorer: ranking.TagAffinity{}, Weight: cfg.weights.tagAffinity},
+		},
+		MaxPerAuthor: cfg.maxPerAuthor,
+		Now:          now,
+	}
+}
+
+// getRankedFeed returns the page of the "for you" feed of userID selected
+// by fq.Limit and fq.Offset. Candidates are the recent posts of followed
+// users plus the posts trending over the last day. The ranking is computed
+// afresh on every request, so posts can move between pages as it changes.
+func (app *application) getRankedFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	cfg := app.config.ranking
+	now := app.ranker.Now()
+
+	popular, err := app.cacheStorage.Trending.GetPosts(ctx, "24h", cfg.popular)
+	if err != nil {
+		return nil, err
+	}
+	popularIDs := make([]int64, len(popular))
+	for i, p := range popular {
+		popularIDs[i] = p.PostID
+	}
+
+	candidates, err := app.store.Ranking.GetCandidates(ctx, userID, now.Add(-cfg.window), cfg.candidates, popularIDs)
+	if err != nil {
+		return nil, err
+	}
+	signals, err := app.store.Ranking.GetSignals(ctx, userID, now.Add(-cfg.affinityWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := app.ranker.Rank(candidates, signals, fq.Limit)
+	if fq.Offset >= len(ranked) {
+		return []store.PostWithMetadata{}, nil
+	}
+	ranked = ranked[fq.Offset:min(fq.Offset+fq.Limit, len(ranked))]
+
+	ids := make([]int64, len(ranked))
+	for i, r := range ranked {
+		ids[i] = r.PostID
+	}
+	hydrated, err := app.store.Posts.GetByIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]store.PostWithMetadata, len(hydrated))
+	for _, p := range hydrated {
+		byID[p.ID] = p
+	}
+
+	posts := make([]store.PostWithMetadata, 0, len(ids))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			posts = append(posts, p)
+		}
+	}
+	return posts, nil
+}
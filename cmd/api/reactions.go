@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"project/internal/store"
+)
+
+type ReactPayload struct {
+	Kind string `json:"kind" validate:"required,oneof=like love laugh wow sad angry"`
+}
+
+// React to post godoc
+//
+//	@Summary		React to post
+//	@Description	Sets the current user's reaction on a post, replacing any previous one
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"Post ID"
+//	@Param			payload	body		ReactPayload	true	"Reaction payload"
+//	@Success		200		{object}	store.Reaction
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/reactions [put]
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ReactPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+
+	visible, err := app.canViewContentOf(ctx, user, post.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !visible {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	reaction := &store.Reaction{
+		PostID: post.ID,
+		UserID: user.ID,
+		Kind:   payload.Kind,
+	}
+	if err := app.store.Reactions.React(ctx, reaction); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.events.Publish(ctx, ReactionAdded{Post: post, Reaction: reaction, User: user})
+
+	if err := app.jsonResponse(w, http.StatusOK, reaction); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Remove reaction godoc
+//
+//	@Summary		Remove reaction
+//	@Description	Removes the current user's reaction from a post
+//	@Tags			posts
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		204	{object}	nil
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/reactions [delete]
+func (app *application) deleteReactionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+
+	if err := app.store.Reactions.Unreact(r.Context(), post.ID, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
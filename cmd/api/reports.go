@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/store"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type reportKey string
+
+const reportCtx reportKey = "report"
+
+type CreateReportPayload struct {
+	TargetType string `json:"target_type" validate:"required,oneof=post comment user"`
+	TargetID   int64  `json:"target_id" validate:"required,min=1"`
+	Reason     string `json:"reason" validate:"required"`
+	Details    string `json:"details" validate:"max=1000"`
+}
+
+type ResolveReportPayload struct {
+	Action string `json:"action" validate:"required,oneof=dismiss hide warn suspend"`
+	Note   string `json:"note" validate:"max=1000"`
+	// SuspendDays is how long a suspended user stays suspended.
+	SuspendDays int `json:"suspend_days" validate:"required_if=Action suspend,omitempty,min=1,max=365"`
+}
+
+type reportCreated struct {
+	ID int64 `json:"id"`
+}
+
+// ReportWithEntries is a report along with the individual reports it
+// aggregates.
+type ReportWithEntries struct {
+	store.Report
+	Entries []store.ReportEntry `json:"entries"`
+}
+
+// Create report godoc
+//
+//	@Summary		Reports a post, comment or user
+//	@Description	Reports a post, comment or user to the moderators. Reports of the same target are aggregated
+//	@Description	until a moderator resolves them; each user reports a target once
+//	@Tags			reports
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateReportPayload	true	"Report payload"
+//	@Success		201		{object}	reportCreated
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/reports [post]
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if !slices.Contains(store.ReportReasons, payload.Reason) {
+		app.badRequestError(w, r, errors.New("unknown report reason"))
+		return
+	}
+
+	user := getUserFromContext(r)
+	if payload.TargetType == "user" && payload.TargetID == user.ID {
+		app.badRequestError(w, r, errors.New("cannot report yourself"))
+		return
+	}
+
+	id, err := app.store.Reports.Create(r.Context(), store.NewReport{
+		ReporterID: user.ID,
+		TargetType: payload.TargetType,
+		TargetID:   payload.TargetID,
+		Reason:     payload.Reason,
+		Details:    payload.Details,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, errors.New("already reported"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, reportCreated{id}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get reports godoc
+//
+//	@Summary		Fetches the moderation queue
+//	@Description	Fetches the reports with a status, the most reported targets first. Moderators and above only
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			status	query		string	false	"open (default), claimed or resolved"
+//	@Param			type	query		string	false	"post, comment or user"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.Report
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports [get]
+func (app *application) getReportsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = store.ReportOpen
+	case store.ReportOpen, store.ReportClaimed, store.ReportResolved:
+	default:
+		app.badRequestError(w, r, errors.New("status must be open, claimed or resolved"))
+		return
+	}
+	targetType := r.URL.Query().Get("type")
+	if targetType != "" && !slices.Contains(store.ReportTargets, targetType) {
+		app.badRequestError(w, r, errors.New("type must be post, comment or user"))
+		return
+	}
+
+	reports, err := app.store.Reports.GetAll(r.Context(), status, targetType, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, reports); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get report godoc
+//
+//	@Summary		Fetches a report
+//	@Description	Fetches a report along with the individual reports it aggregates. Moderators and above only
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			reportID	path		int	true	"Report ID"
+//	@Param			limit		query		int	false	"Limit"
+//	@Param			offset		query		int	false	"Offset"
+//	@Success		200			{object}	ReportWithEntries
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID} [get]
+func (app *application) getReportHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	report := getReportFromCtx(r)
+	entries, err := app.store.Reports.GetEntries(r.Context(), report.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, ReportWithEntries{*report, entries}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Claim report godoc
+//
+//	@Summary		Claims a report
+//	@Description	Assigns an open report to the current moderator, so other moderators leave it to them
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			reportID	path		int	true	"Report ID"
+//	@Success		200			{object}	store.Report
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID}/claim [put]
+func (app *application) claimReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := app.store.Reports.Claim(r.Context(), getReportFromCtx(r).ID, getUserFromContext(r).ID)
+	if err != nil {
+		app.reportDecisionError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Resolve report godoc
+//
+//	@Summary		Resolves a report
+//	@Description	Resolves a report with an action: dismiss it, hide the reported post or comment, or warn or
+//	@Description	suspend the user behind the target. Warned and suspended users are notified. Every decision
+//	@Description	is recorded in the moderation log. Moderators cannot resolve reports about themselves, nor act
+//	@Description	against users of the same or a higher role
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reportID	path		int						true	"Report ID"
+//	@Param			payload		body		ResolveReportPayload	true	"Resolution payload"
+//	@Success		200			{object}	store.Report
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID}/resolve [put]
+func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResolveReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	moderator := getUserFromContext(r)
+	ctx := r.Context()
+	report, err := app.store.Reports.Resolve(ctx, getReportFromCtx(r).ID, moderator.ID, store.Resolution{
+		Action:     payload.Action,
+		Note:       payload.Note,
+		SuspendFor: time.Duration(payload.SuspendDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		app.reportDecisionError(w, r, err)
+		return
+	}
+
+	if payload.Action == "suspend" && report.TargetUserID != nil {
+		app.invalidateUserCache(ctx, *report.TargetUserID)
+	}
+	app.events.Publish(ctx, ReportResolved{Report: report, Moderator: moderator})
+
+	if err := app.jsonResponse(w, http.StatusOK, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) reportDecisionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundError(w, r, err)
+	case errors.Is(err, store.ErrConflict):
+		app.conflictError(w, r, errors.New("report is resolved or claimed by another moderator"))
+	case errors.Is(err, store.ErrInvalidAction):
+		app.badRequestError(w, r, err)
+	case errors.Is(err, store.ErrOutranked):
+		app.forbiddenResponse(w, r)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get moderation actions godoc
+//
+//	@Summary		Fetches the moderation log
+//	@Description	Fetches the decisions of moderators, latest first, about one target when target_type and
+//	@Description	target_id are set. Moderators and above only
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			target_type	query		string	false	"post, comment or user"
+//	@Param			target_id	query		int		false	"Target ID"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Success		200			{object}	[]store.ModerationAction
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/actions [get]
+func (app *application) getModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	targetType := r.URL.Query().Get("target_type")
+	var targetID int64
+	if targetType != "" {
+		if !slices.Contains(store.ReportTargets, targetType) {
+			app.badRequestError(w, r, errors.New("target_type must be post, comment or user"))
+			return
+		}
+		targetID, err = strconv.ParseInt(r.URL.Query().Get("target_id"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, errors.New("target_id is required with target_type"))
+			return
+		}
+	}
+
+	actions, err := app.store.Reports.GetActions(r.Context(), targetType, targetID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, actions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// notifyReportResolution tells the user behind a reported target that a
+// moderator hid their content, warned or suspended them.
+func (app *application) notifyReportResolution(ctx context.Context, report *store.Report) {
+	if report.TargetUserID == nil || report.Action == nil {
+		return
+	}
+
+	data := map[string]string{}
+	switch *report.Action {
+	case "hide":
+		data["action"] = "hid"
+		data["target"] = report.TargetType
+	case "warn":
+		data["action"] = "warned"
+	case "suspend":
+		data["action"] = "suspended"
+	default:
+		return
+	}
+	app.notify(ctx, store.NewNotification{Type: store.NotificationModeration, Data: data}, nil, *report.TargetUserID)
+}
+
+func (app *application) reportsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "reportID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		ctx := r.Context()
+
+		report, err := app.store.Reports.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, reportCtx, report)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getReportFromCtx(r *http.Request) *store.Report {
+	return r.Context().Value(reportCtx).(*store.Report)
+}
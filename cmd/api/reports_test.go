@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"project/internal/gateway"
+	"project/internal/store"
+	"testing"
+	"time"
+)
+
+// rolesUserStore returns the test user with a role level and, when set, a
+// suspension.
+type rolesUserStore struct {
+	store.MockUserStore
+	level          string
+	suspendedUntil *time.Time
+}
+
+func (s *rolesUserStore) GetByID(ctx context.Context, id int64) (*store.User, error) {
+	return &store.User{ID: id, Role: store.Role{Level: s.level}, SuspendedUntil: s.suspendedUntil}, nil
+}
+
+func TestReports(t *testing.T) {
+	app := newTestApp(t, config{})
+	users := &rolesUserStore{level: "3"}
+	mockStore := app.store
+	mockStore.Users = users
+	mockStore.Roles = &levelRoleStore{}
+	app.store = mockStore
+	do := newTestClient(app, app.mount())
+
+	t.Run("should validate reports", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, do(t, http.MethodPost, "/v1/reports", `{"target_type": "post", "target_id": 1, "reason": "spam"}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/reports", `{"target_type": "post", "target_id": 1, "reason": "boring"}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/reports", `{"target_type": "tag", "target_id": 1, "reason": "spam"}`).StatusCode)
+	})
+
+	t.Run("should let moderators work the queue", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/moderation/reports?status=claimed&type=comment", "").StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/moderation/reports?status=closed", "").StatusCode)
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/moderation/reports/1", "").StatusCode)
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/moderation/actions?target_type=post&target_id=1", "").StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/moderation/actions?target_type=post", "").StatusCode)
+	})
+
+	t.Run("should claim and resolve reports", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPut, "/v1/moderation/reports/1/claim", "").StatusCode)
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPut, "/v1/moderation/reports/1/resolve", `{"action": "suspend", "suspend_days": 7}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPut, "/v1/moderation/reports/1/resolve", `{"action": "suspend"}`).StatusCode)
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPut, "/v1/moderation/reports/1/resolve", `{"action": "ban"}`).StatusCode)
+	})
+
+	t.Run("should keep the queue from regular users", func(t *testing.T) {
+		users.level = ""
+		defer func() { users.level = "3" }()
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodGet, "/v1/moderation/reports", "").StatusCode)
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodPut, "/v1/moderation/reports/1/claim", "").StatusCode)
+	})
+
+	t.Run("should lock out suspended users", func(t *testing.T) {
+		until := time.Now().Add(time.Hour)
+		users.suspendedUntil = &until
+		defer func() { users.suspendedUntil = nil }()
+		checkResponseCode(t, http.StatusForbidden, do(t, http.MethodPost, "/v1/reports", `{"target_type": "post", "target_id": 1, "reason": "spam"}`).StatusCode)
+
+		over := time.Now().Add(-time.Hour)
+		users.suspendedUntil = &over
+		checkResponseCode(t, http.StatusCreated, do(t, http.MethodPost, "/v1/reports", `{"target_type": "post", "target_id": 1, "reason": "spam"}`).StatusCode)
+	})
+}
+
+func TestHiddenPosts(t *testing.T) {
+	app := newTestApp(t, config{})
+	users := &rolesUserStore{}
+	mockStore := app.store
+	mockStore.Users = users
+	mockStore.Roles = &levelRoleStore{}
+	// Post 1 of user 9 and post 2 of the test user, whose ID is 42, were
+	// hidden by a moderator.
+	mockStore.Posts = &communityPostStore{posts: map[int64]*store.Post{
+		1: {ID: 1, UserId: 9, Hidden: true},
+		2: {ID: 2, UserId: 42, Hidden: true},
+	}}
+	app.store = mockStore
+	do := newTestClient(app, app.mount())
+	ctx := context.Background()
+
+	t.Run("should hide hidden posts from other users", func(t *testing.T) {
+		routes := []struct{ method, path, body string }{
+			{http.MethodGet, "/v1/posts/1", ""},
+			{http.MethodPatch, "/v1/posts/1", `{"title": "mine"}`},
+			{http.MethodDelete, "/v1/posts/1", ""},
+			{http.MethodPost, "/v1/posts/1/comments", `{"content": "hi"}`},
+			{http.MethodPut, "/v1/posts/1/reactions", `{"kind": "like"}`},
+			{http.MethodDelete, "/v1/posts/1/reactions", ""},
+			{http.MethodGet, "/v1/posts/1/poll", ""},
+			{http.MethodPost, "/v1/posts/1/poll/votes", `{"option_ids": [1]}`},
+			{http.MethodPut, "/v1/posts/1/repost", ""},
+			{http.MethodDelete, "/v1/posts/1/repost", ""},
+		}
+		for _, route := range routes {
+			res := do(t, route.method, route.path, route.body)
+			if res.StatusCode != http.StatusNotFound {
+				t.Errorf("%s %s: expected status %d, got %d", route.method, route.path, http.StatusNotFound, res.StatusCode)
+			}
+		}
+
+		if err := app.authorizeTopic(ctx, 42, "post", 1); !errors.Is(err, gateway.ErrForbidden) {
+			t.Errorf("expected the subscription to be forbidden, got %v", err)
+		}
+	})
+
+	t.Run("should still show hidden posts to their author", func(t *testing.T) {
+		if err := app.authorizeTopic(ctx, 42, "post", 2); err != nil {
+			t.Errorf("expected the author to subscribe, got %v", err)
+		}
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodDelete, "/v1/posts/2", "").StatusCode)
+	})
+
+	t.Run("should still show hidden posts to moderators", func(t *testing.T) {
+		users.level = "3"
+		defer func() { users.level = "" }()
+
+		if err := app.authorizeTopic(ctx, 42, "post", 1); err != nil {
+			t.Errorf("expected moderators to subscribe, got %v", err)
+		}
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodDelete, "/v1/posts/1", "").StatusCode)
+	})
+}
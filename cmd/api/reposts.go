@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"project/internal/store"
+)
+
+// Repost godoc
+//
+//	@Summary		Repost a post
+//	@Description	Shares a post of a public account with the current user's followers
+//	@Tags			posts
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		204	{object}	nil
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/repost [put]
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+
+	visible, err := app.canViewContentOf(ctx, user, post.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !visible {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	// Posts of private accounts must not reach users outside their
+	// followers.
+	author, err := app.store.Users.GetByID(ctx, post.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if author.IsPrivate {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := app.store.Reposts.Repost(ctx, post.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Undo repost godoc
+//
+//	@Summary		Undo repost
+//	@Description	Removes the current user's repost of a post
+//	@Tags			posts
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		204	{object}	nil
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/repost [delete]
+func (app *application) deleteRepostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+
+	if err := app.store.Reposts.Unrepost(r.Context(), post.ID, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/store"
+	"project/internal/stream"
+	"strconv"
+	"time"
+)
+
+type postEvent struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Title     string `json:"title"`
+	CreatedAt string `json:"created_at"`
+}
+
+type followEvent struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// Stream godoc
+//
+//	@Summary		Streams real-time events
+//	@Description	Server-Sent Events stream of new posts from followed users (post), comments on your posts (comment),
+//	@Description	new followers (follow) and follow requests (follow_request). Send the Last-Event-ID header when
+//	@Description	reconnecting to receive the events missed meanwhile. Comment lines are sent as heartbeats
+//	@Tags			stream
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		int		false	"ID of the last event received"
+//	@Success		200				{string}	string	"Event stream"
+//	@Failure		400				{object}	error
+//	@Failure		429				{object}	error
+//	@Failure		503				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/stream [get]
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	var lastEventID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid Last-Event-ID %q", v))
+			return
+		}
+		lastEventID = id
+	}
+
+	user := getUserFromContext(r)
+	sub, replay, err := app.hub.Subscribe(user.ID, lastEventID)
+	if err != nil {
+		switch {
+		case errors.Is(err, stream.ErrTooManyConnections):
+			app.tooManyRequestsError(w, r, err)
+		case errors.Is(err, stream.ErrClosed):
+			app.serviceUnavailableError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer sub.Close()
+
+	// The server write timeout is meant for ordinary requests.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range replay {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e stream.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+	return err
+}
+
+// publishEvent sends an event to the live streams of userID. Failing to do
+// so must not fail the request that caused it.
+func (app *application) publishEvent(ctx context.Context, userID int64, eventType string, data any) {
+	if err := app.hub.Publish(ctx, userID, eventType, data); err != nil {
+		app.logger.Warnw("failed to publish event", "user", userID, "type", eventType, "error", err)
+	}
+}
+
+// publishPost streams a new post to the followers of its author in the
+// background, and to the gateway subscribers of the author. Followers who
+// muted the author are left out, as in their feeds.
+func (app *application) publishPost(ctx context.Context, post *store.Post, author *store.User) {
+	event := postEvent{
+		ID:        post.ID,
+		UserID:    author.ID,
+		Username:  author.Username,
+		Title:     post.Title,
+		CreatedAt: post.CreatedAt,
+	}
+	app.publishGateway("user", author.ID, stream.EventPost, event)
+
+	ctx = context.WithoutCancel(ctx)
+	app.jobs.Add(1)
+	go func() {
+		defer app.jobs.Done()
+
+		followers, err := app.store.Followers.GetFollowerIDs(ctx, author.ID)
+		if err != nil {
+			app.logger.Warnw("failed to publish post", "post", post.ID, "error", err)
+			return
+		}
+		for _, id := range followers {
+			app.publishEvent(ctx, id, stream.EventPost, event)
+		}
+	}()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"project/internal/stream"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	app := newTestApp(t, config{stream: streamConfig{heartbeat: time.Hour}})
+	srv := httptest.NewServer(app.mount())
+	defer srv.Close()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	connect := func(t *testing.T, lastEventID string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// readEvent returns the lines of the next event on the stream.
+	readEvent := func(t *testing.T, r *bufio.Reader) []string {
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return lines
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	ctx := context.Background()
+	_ = app.hub.Publish(ctx, 0, stream.EventFollow, followEvent{UserID: 2, Username: "gopher"})
+
+	res := connect(t, "")
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+
+	t.Run("should push published events", func(t *testing.T) {
+		_ = app.hub.Publish(ctx, 0, stream.EventComment, map[string]int{"id": 1})
+
+		got := strings.Join(readEvent(t, bufio.NewReader(res.Body)), "\n")
+		if want := "id: 2\nevent: comment\ndata: {\"id\":1}"; got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("should limit connections per user", func(t *testing.T) {
+		second := connect(t, "")
+		second.Body.Close()
+		checkResponseCode(t, http.StatusTooManyRequests, second.StatusCode)
+	})
+
+	t.Run("should replay events after Last-Event-ID", func(t *testing.T) {
+		res.Body.Close()
+		// The hub frees the slot once the handler sees the client leave.
+		var resumed *http.Response
+		for i := 0; i < 50; i++ {
+			resumed = connect(t, "1")
+			if resumed.StatusCode == http.StatusOK {
+				break
+			}
+			resumed.Body.Close()
+			time.Sleep(10 * time.Millisecond)
+		}
+		defer resumed.Body.Close()
+		checkResponseCode(t, http.StatusOK, resumed.StatusCode)
+
+		lines := readEvent(t, bufio.NewReader(resumed.Body))
+		if len(lines) == 0 || lines[0] != "id: 2" {
+			t.Errorf("expected event 2 to be replayed, got %q", lines)
+		}
+	})
+
+	t.Run("should end streams when the hub closes", func(t *testing.T) {
+		app.hub.Close()
+		rejected := connect(t, "")
+		rejected.Body.Close()
+		checkResponseCode(t, http.StatusServiceUnavailable, rejected.StatusCode)
+	})
+}
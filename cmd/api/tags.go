@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"project/internal/richtext"
+	"project/internal/store"
+)
+
+// Get tag posts godoc
+//
+//	@Summary		Fetches posts with a tag
+//	@Description	Fetches the posts tagged with tag, newest first. The tag is matched case-insensitively, with or without its leading #
+//	@Tags			tags
+//	@Produce		json
+//	@Param			tag		path		string	true	"Tag"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/posts [get]
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag := richtext.NormalizeTag(chi.URLParam(r, "tag"))
+	if tag == "" {
+		app.badRequestError(w, r, errors.New("invalid tag"))
+		return
+	}
+
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	viewer := getUserFromContext(r)
+	posts, err := app.store.Posts.GetByTag(ctx, tag, viewer.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	list := make([]*store.Post, len(posts))
+	for i := range posts {
+		list[i] = &posts[i].Post
+	}
+	if err := app.loadMentions(ctx, list...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// checkTags rejects client supplied tags that would not survive
+// normalization, rather than dropping them silently.
+func checkTags(tags []string) error {
+	for _, t := range tags {
+		if richtext.NormalizeTag(t) == "" {
+			return fmt.Errorf("invalid tag %q: tags need a letter and can only contain letters, digits and underscores", t)
+		}
+	}
+	return nil
+}
+
+// loadMentions fills in the resolved mentions of posts with one query.
+func (app *application) loadMentions(ctx context.Context, posts ...*store.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	mentions, err := app.store.Posts.GetMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		p.Mentions = mentions[p.ID]
+		if p.Mentions == nil {
+			p.Mentions = []store.Mention{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPostTags(t *testing.T) {
+	app := newTestApp(t, config{})
+	do := newTestClient(app, app.mount())
+
+	t.Run("should reject invalid tags instead of dropping them", func(t *testing.T) {
+		for _, tag := range []string{"", "2024", "go-lang", "#"} {
+			body := `{"title": "t", "content": "c", "tags": ["golang", "` + tag + `"]}`
+			res := do(t, http.MethodPost, "/v1/posts", body)
+			if res.StatusCode != http.StatusBadRequest {
+				t.Errorf("expected tag %q to be rejected, got %d", tag, res.StatusCode)
+			}
+		}
+	})
+
+	t.Run("should accept tags with a leading #", func(t *testing.T) {
+		if err := checkTags([]string{"#Golang", "go_2"}); err != nil {
+			t.Error(err)
+		}
+	})
+}
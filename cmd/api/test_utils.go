@@ -1,14 +1,22 @@
 package main
 
 import (
+	"fmt"
 	"go.uber.org/zap"
 	"net/http"
 	"net/http/httptest"
 	"project/internal/auth"
+	"project/internal/cursor"
+	"project/internal/digest"
+	"project/internal/events"
+	"project/internal/gateway"
 	"project/internal/ratelimiter"
 	"project/internal/store"
 	"project/internal/store/cache"
+	"project/internal/stream"
+	"strings"
 	"testing"
+	"time"
 )
 
 func newTestApp(t *testing.T, cfg config) *application {
@@ -18,14 +26,34 @@ func newTestApp(t *testing.T, cfg config) *application {
 	testAuth := &auth.TestAuth{}
 	logger := zap.NewNop().Sugar()
 	rateLimiter := ratelimiter.NewFixedWindowLimiter(cfg.rateLimiter.RequestPerTimeFrame, cfg.rateLimiter.TimeFrame)
-	return &application{
+	app := &application{
 		logger:        logger,
 		store:         mockStore,
 		cacheStorage:  mockCache,
 		authenticator: testAuth,
 		config:        cfg,
 		rateLimiter:   rateLimiter,
+		cursors:       cursor.NewCodec("test"),
+		digestSigner:  digest.NewSigner("test"),
+		hub:           stream.NewMemoryHub(stream.Config{MaxConnsPerUser: 1, Buffer: 8, Replay: time.Minute}),
 	}
+	app.gateway = &gateway.Gateway{
+		Hub: gateway.NewHub(),
+		Config: gateway.Config{
+			Buffer:       8,
+			MaxTopics:    4,
+			PingInterval: time.Minute,
+			ReadTimeout:  time.Minute,
+			WriteTimeout: time.Second,
+		},
+		Authorize: app.authorizeTopic,
+	}
+	// Without workers, asynchronous subscribers run before Publish returns.
+	app.events = events.New(events.Config{}, func(event, subscriber string, err error) {
+		t.Errorf("%s subscriber of %s failed: %v", subscriber, event, err)
+	})
+	app.subscribeEvents()
+	return app
 }
 
 func executeRequest(req *http.Request, mux http.Handler) *httptest.ResponseRecorder {
@@ -39,3 +67,44 @@ func checkResponseCode(t *testing.T, expected, actual int) {
 		t.Errorf("Expected response code %d. Got %d\n", expected, actual)
 	}
 }
+
+// newTestClient returns a function that sends a request to mux as the test
+// user.
+func newTestClient(app *application, mux http.Handler) func(t *testing.T, method, path, body string) *http.Response {
+	token, _ := app.authenticator.GenerateToken(nil)
+	return func(t *testing.T, method, path, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return executeRequest(req, mux).Result()
+	}
+}
+
+// testPageItem is an entry of the history cursorPage pages through.
+type testPageItem struct {
+	ID        int64
+	CreatedAt string
+	Text      string
+}
+
+// cursorPage returns up to limit entries of a history of 30, newest first,
+// continuing past after when it is set. Entry n was created n minutes after
+// the first one.
+func cursorPage(limit int, after *store.FeedCursor) []testPageItem {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var items []testPageItem
+	for id := int64(30); id > 0 && len(items) < limit; id-- {
+		if after != nil && id >= after.ID {
+			continue
+		}
+		items = append(items, testPageItem{
+			ID:        id,
+			CreatedAt: start.Add(time.Duration(id) * time.Minute).Format(time.RFC3339),
+			Text:      fmt.Sprint("entry ", id),
+		})
+	}
+	return items
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"expvar"
+	"project/internal/store"
+	"project/internal/store/cache"
+	"slices"
+	"time"
+)
+
+// timelineJob either fans a new post out to the cached timelines of its
+// author's followers or, with fillUserID set, rebuilds the timeline of that
+// user.
+type timelineJob struct {
+	postID     int64
+	authorID   int64
+	fillUserID int64
+}
+
+// timelineBatch bounds how many timelines one Redis round trip updates.
+const timelineBatch = 500
+
+// startTimelineWorkers runs the fan-out workers until ctx is cancelled. Jobs
+// still queued then are finished before the workers return, so posts made
+// right before a shutdown reach the cached timelines.
+func (app *application) startTimelineWorkers(ctx context.Context) {
+	if !app.config.timeline.enabled {
+		return
+	}
+
+	for i := 0; i < app.config.timeline.workers; i++ {
+		app.jobs.Add(1)
+		go func() {
+			defer app.jobs.Done()
+			for {
+				select {
+				case job := <-app.timelineJobs:
+					app.runTimelineJob(ctx, job)
+				case <-ctx.Done():
+					drainCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					for {
+						select {
+						case job := <-app.timelineJobs:
+							app.runTimelineJob(drainCtx, job)
+						default:
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+}
+
+// timelineJobsDropped counts the jobs shed because the workers were behind.
+var timelineJobsDropped = expvar.NewInt("timeline_jobs_dropped")
+
+// enqueueTimelineJob hands job to the workers. When they are behind, the job
+// is dropped rather than run on the caller's goroutine, which would slow
+// down requests exactly when the API is under load. A dropped fill is
+// retried on the next read; the followers of a dropped fan-out see the post
+// once their timelines are rebuilt.
+func (app *application) enqueueTimelineJob(ctx context.Context, job timelineJob) {
+	if !app.config.timeline.enabled {
+		return
+	}
+
+	select {
+	case app.timelineJobs <- job:
+	default:
+		timelineJobsDropped.Add(1)
+		app.logger.Warnw("timeline queue full, dropping job", "post", job.postID, "user", job.fillUserID)
+	}
+}
+
+func (app *application) runTimelineJob(ctx context.Context, job timelineJob) {
+	err := runJob(ctx, func(ctx context.Context) error {
+		if job.fillUserID != 0 {
+			return app.fillTimeline(ctx, job.fillUserID)
+		}
+		return app.fanOutPost(ctx, job.postID, job.authorID)
+	})
+	if err != nil {
+		app.logger.Errorw("timeline job failed", "post", job.postID, "user", job.fillUserID, "error", err)
+	}
+}
+
+// fanOutPost pushes a post into the timelines of its author and, unless the
+// author is a large account read on demand, of their followers.
+func (app *application) fanOutPost(ctx context.Context, postID, authorID int64) error {
+	author, err := app.store.Users.GetByID(ctx, authorID)
+	if err != nil {
+		return err
+	}
+
+	recipients := []int64{authorID}
+	if author.FollowersCount < app.config.timeline.largeAccountFollowers {
+		followers, err := app.store.Followers.GetFollowerIDs(ctx, authorID)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, followers...)
+	}
+
+	for batch := range slices.Chunk(recipients, timelineBatch) {
+		if err := app.cacheStorage.Timelines.Push(ctx, batch, postID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *application) fillTimeline(ctx context.Context, userID int64) error {
+	ids, err := app.store.Posts.GetTimelineIDs(ctx, userID, app.config.timeline.largeAccountFollowers, cache.TimelineSize+1)
+	if err != nil {
+		return err
+	}
+
+	complete := len(ids) <= cache.TimelineSize
+	if !complete {
+		ids = ids[:cache.TimelineSize]
+	}
+	return app.cacheStorage.Timelines.Fill(ctx, userID, ids, complete)
+}
+
+// invalidateTimeline drops the cached timeline of userID after the set of
+// accounts they follow changed.
+func (app *application) invalidateTimeline(ctx context.Context, userID int64) {
+	if !app.config.timeline.enabled {
+		return
+	}
+	if err := app.cacheStorage.Timelines.Delete(ctx, userID); err != nil {
+		app.logger.Warnw("failed to invalidate timeline", "user", userID, "error", err)
+	}
+}
+
+// timelineServes reports whether the cached timeline can answer fq: the
+// newest-first feed without search, tag or until filters, read forwards.
+func timelineServes(fq store.PaginatedFeedQuery, untilSet bool) bool {
+	return fq.Search == "" && len(fq.Tags) == 0 && fq.SortBy == "desc" &&
+		fq.Offset == 0 && fq.Before == nil && !untilSet
+}
+
+// readTimeline builds a feed page of up to fq.Limit posts from the cached
+// timeline of userID merged with the posts of the large accounts they
+// follow. ok is false when the cache cannot answer and the caller must
+// query the database; a missing timeline is then rebuilt in the background.
+//
+// Cached timelines are ordered by post ID, which follows creation order.
+func (app *application) readTimeline(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) (posts []store.PostWithMetadata, ok bool, err error) {
+	since, err := time.Parse("2006-01-02", fq.Since)
+	if err != nil {
+		return nil, false, err
+	}
+	var beforeID int64
+	if fq.After != nil {
+		beforeID = fq.After.ID
+	}
+
+	// Posts the viewer may no longer see are dropped while hydrating, so
+	// read a few batches before giving up on filling the page.
+	position, exhausted := beforeID, false
+	for batch := 0; batch < 3 && !exhausted && len(posts) < fq.Limit; batch++ {
+		ids, complete, found, err := app.cacheStorage.Timelines.Range(ctx, userID, position, fq.Limit)
+		if err != nil {
+			return nil, false, err
+		}
+		if !found {
+			app.enqueueTimelineJob(ctx, timelineJob{fillUserID: userID})
+			return nil, false, nil
+		}
+		if len(ids) < fq.Limit && !complete {
+			// Older posts were trimmed from the timeline.
+			return nil, false, nil
+		}
+		exhausted = complete
+		if len(ids) == 0 {
+			break
+		}
+		position = ids[len(ids)-1]
+
+		hydrated, err := app.store.Posts.GetByIDs(ctx, userID, ids)
+		if err != nil {
+			return nil, false, err
+		}
+		byID := make(map[int64]store.PostWithMetadata, len(hydrated))
+		for _, p := range hydrated {
+			byID[p.ID] = p
+		}
+		for _, id := range ids {
+			p, visible := byID[id]
+			if !visible {
+				continue
+			}
+			createdAt, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+			if err != nil {
+				return nil, false, err
+			}
+			if createdAt.Before(since) {
+				exhausted = true
+				break
+			}
+			posts = append(posts, p)
+		}
+	}
+	if !exhausted && len(posts) < fq.Limit {
+		return nil, false, nil
+	}
+
+	large, err := app.store.Posts.GetLargeAccountPosts(ctx, userID, app.config.timeline.largeAccountFollowers, beforeID, fq.Since, fq.Limit)
+	if err != nil {
+		return nil, false, err
+	}
+	posts = append(posts, large...)
+	slices.SortFunc(posts, func(a, b store.PostWithMetadata) int {
+		return cmp.Compare(b.ID, a.ID)
+	})
+	posts = slices.CompactFunc(posts, func(a, b store.PostWithMetadata) bool {
+		return a.ID == b.ID
+	})
+	if len(posts) > fq.Limit {
+		posts = posts[:fq.Limit]
+	}
+	return posts, true, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"project/internal/store/cache"
+	"testing"
+)
+
+type recordingTimelines struct {
+	cache.MockTimelineStorage
+	pushed map[int64][]int64
+}
+
+func (r *recordingTimelines) Push(ctx context.Context, userIDs []int64, postID int64) error {
+	for _, id := range userIDs {
+		r.pushed[id] = append(r.pushed[id], postID)
+	}
+	return nil
+}
+
+func TestTimelineFanOut(t *testing.T) {
+	app := newTestApp(t, config{timeline: timelineConfig{enabled: true, largeAccountFollowers: 100}})
+	timelines := &recordingTimelines{pushed: map[int64][]int64{}}
+	app.cacheStorage.Timelines = timelines
+
+	t.Run("should drop jobs when the queue is full", func(t *testing.T) {
+		app.timelineJobs = make(chan timelineJob)
+		dropped := timelineJobsDropped.Value()
+		app.enqueueTimelineJob(context.Background(), timelineJob{postID: 7, authorID: 3})
+
+		if got := timelines.pushed[3]; len(got) != 0 {
+			t.Errorf("expected the job not to run on the caller's goroutine, got %v", got)
+		}
+		if timelineJobsDropped.Value() != dropped+1 {
+			t.Error("expected the dropped job to be counted")
+		}
+	})
+
+	t.Run("should let workers finish queued jobs on shutdown", func(t *testing.T) {
+		app.timelineJobs = make(chan timelineJob, 2)
+		app.timelineJobs <- timelineJob{postID: 8, authorID: 4}
+		app.timelineJobs <- timelineJob{postID: 9, authorID: 4}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		app.config.timeline.workers = 1
+		app.startTimelineWorkers(ctx)
+		app.jobs.Wait()
+
+		if got := timelines.pushed[4]; len(got) != 2 {
+			t.Errorf("expected both posts in the author's timeline, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"project/internal/store"
+	"time"
+)
+
+type trendingPost struct {
+	store.PostWithMetadata
+	Score float64 `json:"score"`
+}
+
+// refreshTrending recomputes the trending tags and posts of every window and
+// replaces the cached rankings. When the rankings are shared through Redis,
+// it leaves the work to another instance that is already at it. Otherwise
+// each instance keeps its own rankings and always computes them.
+func (app *application) refreshTrending(ctx context.Context) error {
+	if !app.config.redisConfig.enabled {
+		return app.computeTrending(ctx)
+	}
+
+	ran, err := app.store.Trending.Exclusive(ctx, app.computeTrending)
+	if err == nil && !ran {
+		app.logger.Debugw("trending scores are being computed by another instance")
+	}
+	return err
+}
+
+func (app *application) computeTrending(ctx context.Context) error {
+	now := time.Now()
+	cfg := app.config.trending
+
+	for _, window := range store.TrendingWindows {
+		tags, err := app.store.Trending.TopTags(ctx, window, cfg.weights, now, cfg.size)
+		if err != nil {
+			return err
+		}
+		if err := app.cacheStorage.Trending.SetTags(ctx, window.Name, tags); err != nil {
+			return err
+		}
+
+		posts, err := app.store.Trending.TopPosts(ctx, window, cfg.weights, now, cfg.size)
+		if err != nil {
+			return err
+		}
+		if err := app.cacheStorage.Trending.SetPosts(ctx, window.Name, posts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type trendingQuery struct {
+	Window string `validate:"oneof=1h 24h 7d"`
+	Limit  int    `validate:"gte=1,lte=50"`
+}
+
+func parseTrendingQuery(r *http.Request) (trendingQuery, error) {
+	tq := trendingQuery{Window: "24h"}
+	if window := r.URL.Query().Get("window"); window != "" {
+		tq.Window = window
+	}
+
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		return tq, err
+	}
+	if pq.Offset != 0 {
+		return tq, fmt.Errorf("offset is not supported")
+	}
+	tq.Limit = pq.Limit
+
+	return tq, Validate.Struct(tq)
+}
+
+// Get trending tags godoc
+//
+//	@Summary		Fetches trending tags
+//	@Description	Fetches the tags with the most recent activity in a window. Older activity counts for less
+//	@Tags			trending
+//	@Produce		json
+//	@Param			window	query		string	false	"Window: 1h, 24h (default) or 7d"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]store.TrendingTag
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/trending/tags [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tq, err := parseTrendingQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	tags, err := app.cacheStorage.Trending.GetTags(r.Context(), tq.Window, tq.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get trending posts godoc
+//
+//	@Summary		Fetches trending posts
+//	@Description	Fetches the posts with the most recent comments, reactions and reposts in a window. Older activity counts for less
+//	@Tags			trending
+//	@Produce		json
+//	@Param			window	query		string	false	"Window: 1h, 24h (default) or 7d"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]trendingPost
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/trending/posts [get]
+func (app *application) getTrendingPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tq, err := parseTrendingQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// Read the whole cached ranking: posts the viewer may not see are
+	// dropped below and must not leave the page short.
+	ctx := r.Context()
+	ranked, err := app.cacheStorage.Trending.GetPosts(ctx, tq.Window, app.config.trending.size)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	result := []trendingPost{}
+	if len(ranked) > 0 {
+		ids := make([]int64, len(ranked))
+		for i, p := range ranked {
+			ids[i] = p.PostID
+		}
+
+		viewer := getUserFromContext(r)
+		posts, err := app.store.Posts.GetByIDs(ctx, viewer.ID, ids)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		byID := make(map[int64]store.PostWithMetadata, len(posts))
+		for _, p := range posts {
+			byID[p.ID] = p
+		}
+
+		for _, p := range ranked {
+			post, ok := byID[p.PostID]
+			if !ok {
+				continue
+			}
+			result = append(result, trendingPost{PostWithMetadata: post, Score: p.Score})
+			if len(result) == tq.Limit {
+				break
+			}
+		}
+
+		list := make([]*store.Post, len(result))
+		for i := range result {
+			list[i] = &result[i].Post
+		}
+		if err := app.loadMentions(ctx, list...); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, result); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"project/internal/store"
+	"testing"
+	"time"
+)
+
+func TestTrending(t *testing.T) {
+	app := newTestApp(t, config{trending: trendingConfig{size: 100}})
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	err := app.cacheStorage.Trending.SetTags(context.Background(), "24h", []store.TrendingTag{
+		{Tag: "golang", Score: 12.5},
+		{Tag: "postgres", Score: 4},
+		{Tag: "redis", Score: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(t *testing.T, url string) (int, []byte) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+		return rr.Code, rr.Body.Bytes()
+	}
+
+	t.Run("should serve cached tags in rank order", func(t *testing.T) {
+		code, body := get(t, "/v1/trending/tags?limit=2")
+		checkResponseCode(t, http.StatusOK, code)
+
+		var res struct {
+			Data []store.TrendingTag `json:"data"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 2 || res.Data[0].Tag != "golang" || res.Data[1].Tag != "postgres" {
+			t.Errorf("unexpected tags %+v", res.Data)
+		}
+	})
+
+	t.Run("should serve other windows separately", func(t *testing.T) {
+		code, body := get(t, "/v1/trending/tags?window=1h")
+		checkResponseCode(t, http.StatusOK, code)
+
+		var res struct {
+			Data []store.TrendingTag `json:"data"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 0 {
+			t.Errorf("expected no tags, got %+v", res.Data)
+		}
+	})
+
+	t.Run("should reject unknown windows", func(t *testing.T) {
+		code, _ := get(t, "/v1/trending/tags?window=30d")
+		checkResponseCode(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("should return no posts before the first refresh", func(t *testing.T) {
+		code, _ := get(t, "/v1/trending/posts")
+		checkResponseCode(t, http.StatusOK, code)
+	})
+}
+
+// lockedTrendingStore behaves as if another instance held the trending lock.
+type lockedTrendingStore struct{}
+
+func (s lockedTrendingStore) TopPosts(ctx context.Context, w store.TrendingWindow, weights store.TrendingWeights, now time.Time, limit int) ([]store.TrendingPost, error) {
+	return []store.TrendingPost{}, nil
+}
+
+func (s lockedTrendingStore) TopTags(ctx context.Context, w store.TrendingWindow, weights store.TrendingWeights, now time.Time, limit int) ([]store.TrendingTag, error) {
+	return []store.TrendingTag{{Tag: "golang", Score: 1}}, nil
+}
+
+func (s lockedTrendingStore) Exclusive(ctx context.Context, fn func(context.Context) error) (bool, error) {
+	return false, nil
+}
+
+func TestRefreshTrending(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should compute local rankings without the lock", func(t *testing.T) {
+		app := newTestApp(t, config{trending: trendingConfig{size: 10}})
+		app.store.Trending = lockedTrendingStore{}
+
+		if err := app.refreshTrending(ctx); err != nil {
+			t.Fatal(err)
+		}
+		tags, err := app.cacheStorage.Trending.GetTags(ctx, "24h", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 1 {
+			t.Errorf("expected the rankings to be computed, got %+v", tags)
+		}
+	})
+
+	t.Run("should leave shared rankings to the lock holder", func(t *testing.T) {
+		app := newTestApp(t, config{trending: trendingConfig{size: 10}, redisConfig: redisConfig{enabled: true}})
+		app.store.Trending = lockedTrendingStore{}
+
+		if err := app.refreshTrending(ctx); err != nil {
+			t.Fatal(err)
+		}
+		tags, err := app.cacheStorage.Trending.GetTags(ctx, "24h", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 0 {
+			t.Errorf("expected no rankings, got %+v", tags)
+		}
+	})
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 	"project/internal/store"
 	"strconv"
+	"strings"
 )
 
 type userKey string
@@ -15,7 +17,7 @@ const userCtx userKey = "user"
 // GetUser godoc
 //
 //	@Summary		Fetches a user profile
-//	@Description	Fetches a user profile by ID
+//	@Description	Fetches a user profile by ID. Users that blocked each other do not see each other's profile
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
@@ -34,6 +36,16 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
+	blocked, err := app.store.Blocks.IsBlocked(ctx, getUserFromContext(r).ID, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if blocked {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
 	user, err := app.store.Users.GetByID(ctx, userID)
 	if err != nil {
 		switch {
@@ -57,15 +69,20 @@ type FollowUser struct {
 	UserID int64 `json:"user_id"`
 }
 
+type FollowStatusResponse struct {
+	Status store.FollowStatus `json:"status"`
+}
+
 // Follow user godoc
 //
 //	@Summary		Follow user
-//	@Description	Follow a user by ID
+//	@Description	Follow a user by ID. Following a private account creates a pending request
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id		path		int			true	"User ID"
 //	@Param			user_id	body		FollowUser	true	"User ID"
+//	@Success		202		{object}	FollowStatusResponse
 //	@Success		204		{object}	nil
 //	@Failure		400		{object}	error
 //	@Failure		404		{object}	error
@@ -74,14 +91,26 @@ type FollowUser struct {
 //	@Router			/users/{id}/follow [put]
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
 	followerUser := getUserFromContext(r)
-	followedID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	followedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
-	ctx := r.Context()
-
-	if err := app.store.Followers.Follow(ctx, followerUser.ID, followedID); err != nil {
+	var status store.FollowStatus
+	err = app.store.InTx(r.Context(), func(ctx context.Context) error {
+		var err error
+		status, err = app.store.Followers.Follow(ctx, followerUser.ID, followedID)
+		if err != nil {
+			return err
+		}
+		if status == store.FollowStatusPending {
+			app.events.Publish(ctx, FollowRequested{Follower: followerUser, FollowedID: followedID})
+		} else {
+			app.events.Publish(ctx, UserFollowed{Follower: followerUser, FollowedID: followedID})
+		}
+		return nil
+	})
+	if err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.notFoundError(w, r, err)
@@ -89,12 +118,22 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		case store.ErrConflict:
 			app.conflictError(w, r, err)
 			return
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r)
+			return
 		default:
 			app.internalServerError(w, r, err)
 			return
 		}
 	}
 
+	if status == store.FollowStatusPending {
+		if err := app.jsonResponse(w, http.StatusAccepted, FollowStatusResponse{Status: status}); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -117,7 +156,7 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 //	@Router			/users/{id}/unfollow [put]
 func (app *application) unFollowUserHandler(w http.ResponseWriter, r *http.Request) {
 	unfollowerUser := getUserFromContext(r)
-	unfollowedID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	unfollowedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		app.badRequestError(w, r, err)
 		return
@@ -128,6 +167,7 @@ func (app *application) unFollowUserHandler(w http.ResponseWriter, r *http.Reque
 		app.badRequestError(w, r, err)
 		return
 	}
+	app.events.Publish(ctx, UserUnfollowed{UserID: unfollowerUser.ID, UnfollowedID: unfollowedID})
 
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
@@ -150,7 +190,14 @@ func (app *application) unFollowUserHandler(w http.ResponseWriter, r *http.Reque
 //	@Router			/users/activate/{token} [put]
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
-	err := app.store.Users.Activate(r.Context(), token)
+	err := app.store.InTx(r.Context(), func(ctx context.Context) error {
+		user, err := app.store.Users.Activate(ctx, token)
+		if err != nil {
+			return err
+		}
+		app.events.Publish(ctx, UserActivated{User: user})
+		return nil
+	})
 	if err != nil {
 		switch err {
 		case store.ErrNotFound:
@@ -166,7 +213,135 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type UpdatePrivacyPayload struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+// UpdatePrivacy godoc
+//
+//	@Summary		Update account privacy
+//	@Description	Makes the current account private or public. Going public approves all pending follow requests
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdatePrivacyPayload	true	"Privacy payload"
+//	@Success		204		{object}	nil
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/privacy [put]
+func (app *application) updatePrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdatePrivacyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	if err := app.store.Users.SetPrivacy(ctx, user.ID, *payload.IsPrivate); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.invalidateUserCache(ctx, user.ID)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// canViewContentOf reports whether viewer may see the posts of authorID.
+// Private accounts are only visible to themselves and approved followers, and
+// users that blocked each other never see each other's content.
+func (app *application) canViewContentOf(ctx context.Context, viewer *store.User, authorID int64) (bool, error) {
+	if viewer.ID == authorID {
+		return true, nil
+	}
+
+	blocked, err := app.store.Blocks.IsBlocked(ctx, viewer.ID, authorID)
+	if err != nil {
+		return false, err
+	}
+	if blocked {
+		return false, nil
+	}
+
+	author, err := app.store.Users.GetByID(ctx, authorID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !author.IsPrivate {
+		return true, nil
+	}
+
+	rel, err := app.store.Followers.GetRelationship(ctx, viewer.ID, authorID)
+	if err != nil {
+		return false, err
+	}
+	return rel.Following, nil
+}
+
 func getUserFromContext(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtx).(*store.User)
 	return user
 }
+
+type UserSearchQuery struct {
+	Q string `validate:"required,max=100"`
+}
+
+// SearchUsers godoc
+//
+//	@Summary		Search users
+//	@Description	Fuzzy search on username and display name, ranked by similarity. Followed accounts rank higher
+//	@Tags			users
+//	@Produce		json
+//	@Param			q		query		string	true	"Search query"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.UserSearchResult
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/search [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	sq := UserSearchQuery{Q: strings.TrimSpace(r.URL.Query().Get("q"))}
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	viewer := getUserFromContext(r)
+	results, err := app.store.Users.Search(r.Context(), sq.Q, viewer.ID, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
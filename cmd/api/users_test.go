@@ -32,3 +32,31 @@ func TestGetUser(t *testing.T) {
 			checkResponseCode(t, http.StatusOK, rr.Code)
 		})
 }
+
+func TestSearchUsers(t *testing.T) {
+	app := newTestApp(t, config{})
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	t.Run("should require a query", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/search", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should search users", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/search?q=gopher", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
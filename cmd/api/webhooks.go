@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"project/internal/store"
+	"project/internal/webhook"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type webhookConfig struct {
+	// interval is how often due deliveries are looked for
+	interval    time.Duration
+	batchSize   int
+	concurrency int
+	// lease is how long a claimed delivery is hidden from other workers
+	lease        time.Duration
+	timeout      time.Duration
+	maxAttempts  int
+	backoffBase  time.Duration
+	backoffMax   time.Duration
+	disableAfter int
+	// allowPrivate lets webhooks target private addresses, for development
+	allowPrivate bool
+}
+
+// webhookPayload is the body of every delivery.
+type webhookPayload struct {
+	Event     string `json:"event"`
+	CreatedAt string `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+type followedWebhookData struct {
+	UserID     int64 `json:"user_id"`
+	FollowerID int64 `json:"follower_id"`
+}
+
+type postDeletedWebhookData struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+}
+
+type userWebhookData struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1"`
+	Global bool     `json:"global"`
+}
+
+type UpdateWebhookPayload struct {
+	URL    *string   `json:"url" validate:"omitempty,url,max=2048"`
+	Events *[]string `json:"events" validate:"omitempty,min=1"`
+	Active *bool     `json:"active"`
+}
+
+// WebhookWithSecret is returned once, when a webhook is created.
+type WebhookWithSecret struct {
+	store.Webhook
+	Secret string `json:"secret"`
+}
+
+// enqueueWebhook queues an event for the webhooks of ownerIDs and the
+// global ones.
+func (app *application) enqueueWebhook(ctx context.Context, event string, ownerIDs []int64, data any) error {
+	payload, err := json.Marshal(webhookPayload{
+		Event:     event,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	return app.store.Webhooks.Enqueue(ctx, event, ownerIDs, payload)
+}
+
+// enqueueFollowedWebhook reports that followerID now follows userID, to the
+// webhooks of both.
+func (app *application) enqueueFollowedWebhook(ctx context.Context, userID, followerID int64) error {
+	return app.enqueueWebhook(ctx, webhook.EventUserFollowed, []int64{userID, followerID}, followedWebhookData{
+		UserID:     userID,
+		FollowerID: followerID,
+	})
+}
+
+// deliverWebhooks sends the due deliveries, batch after batch until none
+// is left.
+func (app *application) deliverWebhooks(ctx context.Context) error {
+	cfg := app.config.webhook
+	for {
+		deliveries, err := app.store.Webhooks.ClaimDeliveries(ctx, cfg.batchSize, cfg.lease)
+		if err != nil {
+			return err
+		}
+
+		sem := make(chan struct{}, cfg.concurrency)
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(d *store.WebhookDelivery) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				app.deliverWebhook(ctx, d)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+
+		if len(deliveries) < cfg.batchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (app *application) deliverWebhook(ctx context.Context, d *store.WebhookDelivery) {
+	cfg := app.config.webhook
+
+	code, err := app.webhookSender.Send(ctx, webhook.Delivery{
+		ID:      d.ID,
+		Event:   d.Event,
+		URL:     d.URL,
+		Secret:  d.Secret,
+		Payload: d.Payload,
+	})
+	if err == nil {
+		if err := app.store.Webhooks.RecordSuccess(ctx, d, code); err != nil {
+			app.logger.Errorw("failed to record webhook delivery", "delivery", d.ID, "error", err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if attempts := d.Attempts + 1; attempts < cfg.maxAttempts {
+		at := time.Now().Add(webhook.Backoff(attempts, cfg.backoffBase, cfg.backoffMax))
+		retryAt = &at
+	}
+	disabled, err := app.store.Webhooks.RecordFailure(ctx, d, code, err.Error(), retryAt, cfg.disableAfter)
+	if err != nil {
+		app.logger.Errorw("failed to record webhook delivery", "delivery", d.ID, "error", err)
+		return
+	}
+	if disabled {
+		app.logger.Infow("disabled failing webhook", "webhook", d.WebhookID)
+	}
+}
+
+func getWebhookID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+}
+
+func validWebhookEvents(events []string) error {
+	for _, e := range events {
+		if !slices.Contains(webhook.Events, e) {
+			return fmt.Errorf("unknown webhook event %q", e)
+		}
+	}
+	return nil
+}
+
+func validWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url %q", raw)
+	}
+	return nil
+}
+
+// Create webhook godoc
+//
+//	@Summary		Registers a webhook
+//	@Description	Subscribes a URL to events about the current user. Admins can register global webhooks that
+//	@Description	receive every event. Deliveries are signed with the returned secret, which is only shown once:
+//	@Description	X-Webhook-Signature is "sha256=" and the hex HMAC-SHA256 of X-Webhook-Timestamp, "." and the body
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateWebhookPayload	true	"Webhook payload"
+//	@Success		201		{object}	WebhookWithSecret
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [post]
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := validWebhookURL(payload.URL); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := validWebhookEvents(payload.Events); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	if payload.Global {
+		allowed, err := app.checkRole(ctx, user, "admin")
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	hook := &store.Webhook{
+		UserID: user.ID,
+		URL:    payload.URL,
+		Secret: hex.EncodeToString(secret),
+		Events: payload.Events,
+		Global: payload.Global,
+	}
+	if err := app.store.Webhooks.Create(ctx, hook); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, WebhookWithSecret{Webhook: *hook, Secret: hook.Secret}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Get webhooks godoc
+//
+//	@Summary		Lists webhooks
+//	@Description	Lists the webhooks of the current user
+//	@Tags			webhooks
+//	@Produce		json
+//	@Success		200	{object}	[]store.Webhook
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [get]
+func (app *application) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	webhooks, err := app.store.Webhooks.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, webhooks); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Update webhook godoc
+//
+//	@Summary		Updates a webhook
+//	@Description	Changes the URL or events of a webhook, or pauses it. Activating a webhook that was disabled for
+//	@Description	failing resets its failures and resumes its pending deliveries
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhookID	path		int						true	"Webhook ID"
+//	@Param			payload		body		UpdateWebhookPayload	true	"Webhook payload"
+//	@Success		200			{object}	store.Webhook
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID} [patch]
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getWebhookID(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var payload UpdateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	hook, err := app.store.Webhooks.GetByID(ctx, id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if payload.URL != nil {
+		if err := validWebhookURL(*payload.URL); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		hook.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		if err := validWebhookEvents(*payload.Events); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		hook.Events = *payload.Events
+	}
+	if payload.Active != nil {
+		hook.Active = *payload.Active
+	}
+
+	if err := app.store.Webhooks.Update(ctx, hook); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, hook); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// Delete webhook godoc
+//
+//	@Summary		Deletes a webhook
+//	@Description	Deletes a webhook along with its deliveries
+//	@Tags			webhooks
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Success		204			{object}	nil
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID} [delete]
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getWebhookID(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if err := app.store.Webhooks.Delete(r.Context(), id, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get webhook deliveries godoc
+//
+//	@Summary		Lists webhook deliveries
+//	@Description	Lists the deliveries of a webhook, latest first, with their status, attempts and last error
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Param			limit		query		int	false	"Limit"
+//	@Param			offset		query		int	false	"Offset"
+//	@Success		200			{object}	[]store.WebhookDelivery
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID}/deliveries [get]
+func (app *application) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := getWebhookID(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	pq, err := store.PaginationQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(pq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	if _, err := app.store.Webhooks.GetByID(ctx, id, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	deliveries, err := app.store.Webhooks.GetDeliveries(ctx, id, pq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, deliveries); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
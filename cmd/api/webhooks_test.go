@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"project/internal/events"
+	"project/internal/store"
+	"project/internal/webhook"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// queuedWebhookStore hands out its deliveries once and records how each
+// attempt went.
+type queuedWebhookStore struct {
+	store.MockWebhookStore
+	mu         sync.Mutex
+	queue      []store.WebhookDelivery
+	succeeded  []int64
+	failed     []int64
+	retryAt    []*time.Time
+	statusCode int
+}
+
+func (s *queuedWebhookStore) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]store.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := s.queue
+	s.queue = nil
+	return deliveries, nil
+}
+
+func (s *queuedWebhookStore) RecordSuccess(ctx context.Context, d *store.WebhookDelivery, statusCode int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.succeeded = append(s.succeeded, d.ID)
+	return nil
+}
+
+func (s *queuedWebhookStore) RecordFailure(ctx context.Context, d *store.WebhookDelivery, statusCode int, reason string, retryAt *time.Time, disableAfter int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = append(s.failed, d.ID)
+	s.retryAt = append(s.retryAt, retryAt)
+	s.statusCode = statusCode
+	return false, nil
+}
+
+func newWebhookTestApp(t *testing.T, hooks *queuedWebhookStore) *application {
+	t.Helper()
+	app := newTestApp(t, config{
+		webhook: webhookConfig{
+			batchSize:    10,
+			concurrency:  2,
+			lease:        time.Minute,
+			maxAttempts:  3,
+			backoffBase:  time.Second,
+			backoffMax:   time.Minute,
+			disableAfter: 5,
+		},
+	})
+	app.webhookSender = webhook.NewSender(time.Second, true)
+	mockStore := app.store
+	mockStore.Webhooks = hooks
+	app.store = mockStore
+	return app
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	const secret = "s3cret"
+	payload := []byte(`{"event":"post.created","data":{"id":1}}`)
+
+	t.Run("should sign deliveries", func(t *testing.T) {
+		var mu sync.Mutex
+		var verified []string
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			err := webhook.Verify(secret, r.Header.Get(webhook.HeaderTimestamp), r.Header.Get(webhook.HeaderSignature),
+				body, time.Minute, time.Now())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			mu.Lock()
+			verified = append(verified, r.Header.Get(webhook.HeaderEvent))
+			mu.Unlock()
+		}))
+		defer receiver.Close()
+
+		hooks := &queuedWebhookStore{queue: []store.WebhookDelivery{
+			{ID: 1, WebhookID: 1, Event: webhook.EventPostCreated, Payload: payload, URL: receiver.URL, Secret: secret},
+			{ID: 2, WebhookID: 1, Event: webhook.EventPostCreated, Payload: payload, URL: receiver.URL, Secret: secret},
+		}}
+		app := newWebhookTestApp(t, hooks)
+
+		if err := app.deliverWebhooks(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(hooks.succeeded) != 2 || len(hooks.failed) != 0 {
+			t.Fatalf("expected 2 successes, got %d successes and %d failures", len(hooks.succeeded), len(hooks.failed))
+		}
+		if len(verified) != 2 || verified[0] != webhook.EventPostCreated {
+			t.Errorf("expected 2 verified %s deliveries, got %v", webhook.EventPostCreated, verified)
+		}
+	})
+
+	t.Run("should retry failed deliveries until the last attempt", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer receiver.Close()
+
+		hooks := &queuedWebhookStore{queue: []store.WebhookDelivery{
+			{ID: 1, WebhookID: 1, Payload: payload, URL: receiver.URL, Secret: secret, Attempts: 0},
+		}}
+		app := newWebhookTestApp(t, hooks)
+
+		if err := app.deliverWebhooks(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(hooks.failed) != 1 || hooks.retryAt[0] == nil {
+			t.Fatalf("expected a failure to be retried, got %v", hooks.retryAt)
+		}
+		if hooks.statusCode != http.StatusInternalServerError {
+			t.Errorf("expected status code %d to be recorded, got %d", http.StatusInternalServerError, hooks.statusCode)
+		}
+
+		hooks.queue = []store.WebhookDelivery{
+			{ID: 1, WebhookID: 1, Payload: payload, URL: receiver.URL, Secret: secret, Attempts: 2},
+		}
+		if err := app.deliverWebhooks(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(hooks.failed) != 2 || hooks.retryAt[1] != nil {
+			t.Errorf("expected the last attempt to give up, got %v", hooks.retryAt)
+		}
+	})
+}
+
+func TestCreateWebhook(t *testing.T) {
+	app := newTestApp(t, config{})
+	mux := app.mount()
+
+	token, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should return the secret once", func(t *testing.T) {
+		rr := post(`{"url":"https://example.com/hook","events":["post.created","user.followed"]}`)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var body struct {
+			Data struct {
+				ID     int64    `json:"id"`
+				Secret string   `json:"secret"`
+				Events []string `json:"events"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Data.Secret) != 64 {
+			t.Errorf("expected a 64 character secret, got %q", body.Data.Secret)
+		}
+		if len(body.Data.Events) != 2 {
+			t.Errorf("expected 2 events, got %v", body.Data.Events)
+		}
+	})
+
+	t.Run("should reject unknown events", func(t *testing.T) {
+		rr := post(`{"url":"https://example.com/hook","events":["post.liked"]}`)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should reject non http urls", func(t *testing.T) {
+		rr := post(`{"url":"ftp://example.com/hook","events":["post.created"]}`)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should not list secrets", func(t *testing.T) {
+		data, err := json.Marshal(store.Webhook{ID: 1, Secret: "s3cret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "s3cret") {
+			t.Errorf("expected the secret to be left out, got %s", data)
+		}
+	})
+}
+
+// enqueueingWebhookStore records the events it queued, or fails with err.
+type enqueueingWebhookStore struct {
+	store.MockWebhookStore
+	err    error
+	events []string
+}
+
+func (s *enqueueingWebhookStore) Enqueue(ctx context.Context, event string, ownerIDs []int64, payload []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestEnqueueWebhooks(t *testing.T) {
+	app := newTestApp(t, config{})
+	hooks := &enqueueingWebhookStore{}
+	mockStore := app.store
+	mockStore.Webhooks = hooks
+	app.store = mockStore
+	// The failing enqueue is expected, so it is not reported as an error.
+	app.events = events.New(events.Config{}, nil)
+	app.subscribeEvents()
+	do := newTestClient(app, app.mount())
+
+	t.Run("should queue webhooks with the change", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/users/2/follow", "").StatusCode)
+		if len(hooks.events) != 1 || hooks.events[0] != webhook.EventUserFollowed {
+			t.Errorf("expected a queued %s webhook, got %v", webhook.EventUserFollowed, hooks.events)
+		}
+	})
+
+	t.Run("should fail the change when webhooks cannot be queued", func(t *testing.T) {
+		hooks.err = errors.New("connection refused")
+		defer func() { hooks.err = nil }()
+		checkResponseCode(t, http.StatusInternalServerError, do(t, http.MethodPut, "/v1/users/2/follow", "").StatusCode)
+	})
+}
@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS trg_posts_counters ON posts;
+DROP FUNCTION IF EXISTS posts_counters();
+
+DROP TRIGGER IF EXISTS trg_followers_counters ON followers;
+DROP FUNCTION IF EXISTS followers_counters();
+
+DROP INDEX IF EXISTS idx_followers_follower_id;
+
+ALTER TABLE users
+    DROP COLUMN posts_count,
+    DROP COLUMN following_count,
+    DROP COLUMN followers_count;
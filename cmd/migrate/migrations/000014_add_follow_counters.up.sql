@@ -0,0 +1,43 @@
+ALTER TABLE users
+    ADD COLUMN followers_count BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN following_count BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN posts_count BIGINT NOT NULL DEFAULT 0;
+
+UPDATE users u SET
+    followers_count = (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id),
+    following_count = (SELECT COUNT(*) FROM followers f WHERE f.follower_id = u.id),
+    posts_count = (SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
+
+CREATE OR REPLACE FUNCTION followers_counters() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET followers_count = followers_count + 1 WHERE id = NEW.user_id;
+        UPDATE users SET following_count = following_count + 1 WHERE id = NEW.follower_id;
+        RETURN NEW;
+    END IF;
+    UPDATE users SET followers_count = GREATEST(followers_count - 1, 0) WHERE id = OLD.user_id;
+    UPDATE users SET following_count = GREATEST(following_count - 1, 0) WHERE id = OLD.follower_id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_followers_counters
+    AFTER INSERT OR DELETE ON followers
+    FOR EACH ROW EXECUTE FUNCTION followers_counters();
+
+CREATE OR REPLACE FUNCTION posts_counters() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET posts_count = posts_count + 1 WHERE id = NEW.user_id;
+        RETURN NEW;
+    END IF;
+    UPDATE users SET posts_count = GREATEST(posts_count - 1, 0) WHERE id = OLD.user_id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_posts_counters
+    AFTER INSERT OR DELETE ON posts
+    FOR EACH ROW EXECUTE FUNCTION posts_counters();
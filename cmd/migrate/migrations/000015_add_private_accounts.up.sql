@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS follow_requests (
+  user_id bigint NOT NULL,
+  requester_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, requester_id),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (requester_id) REFERENCES users (id) ON DELETE CASCADE
+);
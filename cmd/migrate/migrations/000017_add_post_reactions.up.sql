@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS post_reactions (
+  post_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  kind varchar(20) NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (post_id, user_id),
+  FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS email_verifications;
+
+ALTER TABLE users
+    DROP COLUMN username_changed_at,
+    DROP COLUMN avatar_url,
+    DROP COLUMN location,
+    DROP COLUMN website,
+    DROP COLUMN bio,
+    DROP COLUMN display_name;
@@ -0,0 +1,16 @@
+ALTER TABLE users
+    ADD COLUMN display_name varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN bio text NOT NULL DEFAULT '',
+    ADD COLUMN website varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN location varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url text NOT NULL DEFAULT '',
+    ADD COLUMN username_changed_at timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email citext NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications (user_id);
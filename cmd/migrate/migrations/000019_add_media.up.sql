@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS media (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    storage_key text NOT NULL UNIQUE,
+    thumbnail_key text NOT NULL,
+    content_type varchar(100) NOT NULL,
+    size_bytes bigint NOT NULL,
+    width int NOT NULL,
+    height int NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_user_id ON media (user_id);
+
+CREATE TABLE IF NOT EXISTS post_attachments (
+    post_id bigint NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    media_id bigint NOT NULL REFERENCES media (id) ON DELETE CASCADE,
+    position smallint NOT NULL,
+
+    PRIMARY KEY (post_id, media_id)
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+ALTER TABLE posts DROP COLUMN search_vector;
+
+DROP FUNCTION IF EXISTS posts_tags_text(varchar[]);
+
+ALTER TABLE posts DROP COLUMN search_language;
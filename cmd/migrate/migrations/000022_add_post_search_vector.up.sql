@@ -0,0 +1,14 @@
+ALTER TABLE posts ADD COLUMN search_language regconfig NOT NULL DEFAULT 'english';
+
+-- array_to_string is only STABLE, generated columns need an IMMUTABLE expression
+CREATE OR REPLACE FUNCTION posts_tags_text(tags varchar[]) RETURNS text
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE
+    AS $$ SELECT coalesce(array_to_string(tags, ' '), '') $$;
+
+ALTER TABLE posts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector(search_language, coalesce(title, '')), 'A') ||
+    setweight(to_tsvector(search_language, coalesce(content, '')), 'B') ||
+    setweight(to_tsvector(search_language, posts_tags_text(tags)), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS post_mentions;
+
+DROP TABLE IF EXISTS post_tags;
+
+DROP TABLE IF EXISTS tags;
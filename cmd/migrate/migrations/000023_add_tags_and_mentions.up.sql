@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    name varchar(100) NOT NULL UNIQUE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id bigint NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+
+    PRIMARY KEY (post_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag_id ON post_tags (tag_id, post_id);
+
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id bigint NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    start_offset int NOT NULL,
+    end_offset int NOT NULL,
+
+    PRIMARY KEY (post_id, start_offset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions (user_id);
+
+-- backfill from the free-form tags column
+INSERT INTO tags (name)
+SELECT DISTINCT lower(t) FROM posts, unnest(tags) AS t
+WHERE t ~ '^[[:alnum:]_]+$' AND t ~ '[[:alpha:]]'
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO post_tags (post_id, tag_id)
+SELECT DISTINCT p.id, tg.id FROM posts p
+CROSS JOIN LATERAL unnest(p.tags) AS t
+JOIN tags tg ON tg.name = lower(t)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_posts_created_at;
+DROP INDEX IF EXISTS idx_post_reactions_created_at;
+DROP INDEX IF EXISTS idx_comments_created_at;
+
+DROP TABLE IF EXISTS reposts;
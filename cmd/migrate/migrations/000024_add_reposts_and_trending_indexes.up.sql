@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS reposts (
+  user_id bigint NOT NULL,
+  post_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, post_id),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+-- Trending scores are computed over recent activity only.
+CREATE INDEX IF NOT EXISTS idx_reposts_created_at ON reposts (created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments (created_at);
+CREATE INDEX IF NOT EXISTS idx_post_reactions_created_at ON post_reactions (created_at);
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at);
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts (user_id);
+DROP INDEX IF EXISTS idx_posts_user_id_created_at;
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
+DROP INDEX IF EXISTS idx_followers_follower_id_user_id;
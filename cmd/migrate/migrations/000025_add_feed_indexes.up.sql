@@ -0,0 +1,9 @@
+-- The feed first collects the authors the viewer follows, which an
+-- index-only scan on (follower_id, user_id) answers, then reads the newest
+-- posts of each author from (user_id, created_at, id) in feed order.
+-- Both replace indexes on their leading column alone.
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id_user_id ON followers (follower_id, user_id);
+DROP INDEX IF EXISTS idx_followers_follower_id;
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts (user_id, created_at DESC, id DESC);
+DROP INDEX IF EXISTS idx_posts_user_id;
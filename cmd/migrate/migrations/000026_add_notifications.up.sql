@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS notifications (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  actor_id bigint,
+  type varchar(20) NOT NULL,
+  post_id bigint,
+  -- Notifications sharing a group key are listed together, e.g. every
+  -- reaction to a post. Those without one are listed on their own.
+  group_key varchar(50),
+  data jsonb NOT NULL DEFAULT '{}',
+  read_at timestamp(0) with time zone,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_group_key ON notifications (user_id, group_key);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+-- Reacting again or re-following does not notify twice.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_once
+  ON notifications (user_id, group_key, actor_id) WHERE type IN ('reaction', 'follow');
+
+-- Types are enabled unless a row turns them off.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  user_id bigint NOT NULL,
+  type varchar(20) NOT NULL,
+  enabled boolean NOT NULL,
+
+  PRIMARY KEY (user_id, type),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+  user_id bigint PRIMARY KEY,
+  frequency varchar(10) NOT NULL CHECK (frequency IN ('off', 'daily', 'weekly')),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_digest_subscriptions_frequency ON digest_subscriptions (frequency)
+  WHERE frequency <> 'off';
+
+-- A digest is claimed by inserting its row before it is sent, so a period
+-- is never mailed twice, even by a restarted or concurrent job.
+CREATE TABLE IF NOT EXISTS digest_deliveries (
+  user_id bigint NOT NULL,
+  period_start timestamp(0) with time zone NOT NULL,
+  claimed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  sent_at timestamp(0) with time zone,
+
+  PRIMARY KEY (user_id, period_start),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
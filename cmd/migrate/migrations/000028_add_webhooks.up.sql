@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  url text NOT NULL,
+  secret varchar(64) NOT NULL,
+  events varchar(30)[] NOT NULL,
+  -- Global webhooks are registered by admins and receive every event;
+  -- the others only receive events about their owner.
+  global boolean NOT NULL DEFAULT FALSE,
+  active boolean NOT NULL DEFAULT TRUE,
+  failure_count int NOT NULL DEFAULT 0,
+  disabled_at timestamp(0) with time zone,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_events ON webhooks USING gin (events) WHERE active;
+
+-- Deliveries are the durable queue of the webhook workers: pending ones
+-- are picked up once next_attempt_at is due.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id bigserial PRIMARY KEY,
+  webhook_id bigint NOT NULL,
+  event varchar(30) NOT NULL,
+  payload jsonb NOT NULL,
+  status varchar(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+  attempts int NOT NULL DEFAULT 0,
+  next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  last_status_code int,
+  last_error text NOT NULL DEFAULT '',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  delivered_at timestamp(0) with time zone,
+
+  FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at)
+  WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id DESC);
@@ -0,0 +1,41 @@
+-- Users that turn this on only get messages from people they follow.
+ALTER TABLE users ADD COLUMN dm_followers_only BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS conversations (
+  id bigserial PRIMARY KEY,
+  -- One-to-one conversations are keyed by their two members, lowest ID
+  -- first, so each pair has a single conversation. Groups have none.
+  direct_key varchar(41) UNIQUE,
+  created_by bigint,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  last_message_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS conversation_members (
+  conversation_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  -- Messages up to this one were read.
+  last_read_message_id bigint NOT NULL DEFAULT 0,
+  joined_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (conversation_id, user_id),
+  FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user_id ON conversation_members (user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+  id bigserial PRIMARY KEY,
+  conversation_id bigint NOT NULL,
+  sender_id bigint NOT NULL,
+  body text NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE,
+  FOREIGN KEY (sender_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages (conversation_id, created_at DESC, id DESC);
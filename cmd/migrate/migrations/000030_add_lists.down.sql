@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS list_members;
+DROP TABLE IF EXISTS lists;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS lists (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  name varchar(100) NOT NULL,
+  description text NOT NULL DEFAULT '',
+  -- Private lists are only visible to their owner.
+  is_private boolean NOT NULL DEFAULT FALSE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_lists_user_id ON lists (user_id);
+
+CREATE TABLE IF NOT EXISTS list_members (
+  list_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (list_id, user_id),
+  FOREIGN KEY (list_id) REFERENCES lists (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
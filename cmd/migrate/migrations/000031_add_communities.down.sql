@@ -0,0 +1,4 @@
+ALTER TABLE posts DROP COLUMN community_id;
+
+DROP TABLE IF EXISTS community_members;
+DROP TABLE IF EXISTS communities;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS communities (
+  id bigserial PRIMARY KEY,
+  name citext UNIQUE NOT NULL,
+  description text NOT NULL DEFAULT '',
+  -- open: anyone joins, approval: moderators approve requests to join,
+  -- invite: only invited users join.
+  join_policy varchar(16) NOT NULL DEFAULT 'open' CHECK (join_policy IN ('open', 'approval', 'invite')),
+  created_by bigint,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS community_members (
+  community_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  role varchar(16) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'moderator', 'member')),
+  -- Pending members asked to join, invited ones were asked to. Only active
+  -- members hold their role.
+  status varchar(16) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'pending', 'invited')),
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (community_id, user_id),
+  FOREIGN KEY (community_id) REFERENCES communities (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_community_members_user_id ON community_members (user_id);
+
+ALTER TABLE posts ADD COLUMN community_id bigint REFERENCES communities (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_community_id ON posts (community_id, created_at DESC, id DESC)
+  WHERE community_id IS NOT NULL;
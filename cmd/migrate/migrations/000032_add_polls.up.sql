@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS polls (
+  post_id bigint PRIMARY KEY,
+  multiple boolean NOT NULL DEFAULT FALSE,
+  closes_at timestamp(0) with time zone NOT NULL,
+  -- The number of voters when the poll closed, set along with the final
+  -- votes of its options once its results are frozen.
+  final_voters bigint,
+
+  FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_polls_unfrozen ON polls (closes_at) WHERE final_voters IS NULL;
+
+CREATE TABLE IF NOT EXISTS poll_options (
+  id bigserial PRIMARY KEY,
+  post_id bigint NOT NULL,
+  position smallint NOT NULL,
+  text varchar(100) NOT NULL,
+  -- The votes the option had when the poll closed.
+  final_votes bigint,
+
+  UNIQUE (post_id, position),
+  FOREIGN KEY (post_id) REFERENCES polls (post_id) ON DELETE CASCADE
+);
+
+-- A ballot per voter makes each user vote once, whether they pick one
+-- option or several.
+CREATE TABLE IF NOT EXISTS poll_ballots (
+  post_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (post_id, user_id),
+  FOREIGN KEY (post_id) REFERENCES polls (post_id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+  post_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  option_id bigint NOT NULL,
+
+  PRIMARY KEY (post_id, user_id, option_id),
+  FOREIGN KEY (post_id, user_id) REFERENCES poll_ballots (post_id, user_id) ON DELETE CASCADE,
+  FOREIGN KEY (option_id) REFERENCES poll_options (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_votes_option_id ON poll_votes (option_id);
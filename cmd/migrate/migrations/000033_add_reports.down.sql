@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS moderation_actions;
+DROP TABLE IF EXISTS report_entries;
+DROP TABLE IF EXISTS reports;
+
+ALTER TABLE comments DROP COLUMN hidden_at;
+ALTER TABLE posts DROP COLUMN hidden_at;
+ALTER TABLE users DROP COLUMN suspended_until;
@@ -0,0 +1,57 @@
+ALTER TABLE users ADD COLUMN suspended_until timestamp(0) with time zone;
+ALTER TABLE posts ADD COLUMN hidden_at timestamp(0) with time zone;
+ALTER TABLE comments ADD COLUMN hidden_at timestamp(0) with time zone;
+
+-- Reports of the same target are aggregated into one until it is resolved.
+CREATE TABLE IF NOT EXISTS reports (
+  id bigserial PRIMARY KEY,
+  target_type varchar(16) NOT NULL CHECK (target_type IN ('post', 'comment', 'user')),
+  target_id bigint NOT NULL,
+  status varchar(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'resolved')),
+  reports_count int NOT NULL DEFAULT 0,
+  last_reported_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  claimed_by bigint,
+  claimed_at timestamp(0) with time zone,
+  resolved_by bigint,
+  resolved_at timestamp(0) with time zone,
+  action varchar(16) CHECK (action IN ('dismiss', 'hide', 'warn', 'suspend')),
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (claimed_by) REFERENCES users (id) ON DELETE SET NULL,
+  FOREIGN KEY (resolved_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_unresolved_target ON reports (target_type, target_id)
+  WHERE status <> 'resolved';
+CREATE INDEX IF NOT EXISTS idx_reports_status ON reports (status, reports_count DESC, last_reported_at DESC);
+
+CREATE TABLE IF NOT EXISTS report_entries (
+  id bigserial PRIMARY KEY,
+  report_id bigint NOT NULL,
+  reporter_id bigint NOT NULL,
+  reason varchar(32) NOT NULL,
+  details text NOT NULL DEFAULT '',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  UNIQUE (report_id, reporter_id),
+  FOREIGN KEY (report_id) REFERENCES reports (id) ON DELETE CASCADE,
+  FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Every moderation decision, kept for auditing even once its target is gone.
+CREATE TABLE IF NOT EXISTS moderation_actions (
+  id bigserial PRIMARY KEY,
+  report_id bigint,
+  moderator_id bigint,
+  action varchar(16) NOT NULL,
+  target_type varchar(16) NOT NULL,
+  target_id bigint NOT NULL,
+  note text NOT NULL DEFAULT '',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (report_id) REFERENCES reports (id) ON DELETE SET NULL,
+  FOREIGN KEY (moderator_id) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_report_id ON moderation_actions (report_id);
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_target ON moderation_actions (target_type, target_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_post_attachments_media_id;
@@ -0,0 +1,7 @@
+-- A file can only be attached to one post. Earlier duplicates keep the
+-- attachment to the oldest post.
+DELETE FROM post_attachments pa
+USING post_attachments earlier
+WHERE earlier.media_id = pa.media_id AND earlier.post_id < pa.post_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_post_attachments_media_id ON post_attachments (media_id);
@@ -0,0 +1,29 @@
+package cursor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCodec(t *testing.T) {
+	codec := NewCodec("secret")
+	cur := Cursor{CreatedAt: time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), ID: 42, Backward: true}
+
+	token := codec.Encode(cur)
+	got, err := codec.Decode(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(cur.CreatedAt) || got.ID != cur.ID || got.Backward != cur.Backward {
+		t.Errorf("expected %+v, got %+v", cur, got)
+	}
+
+	t.Run("rejects tampered cursors", func(t *testing.T) {
+		forged := NewCodec("other").Encode(Cursor{CreatedAt: cur.CreatedAt, ID: 1})
+		for _, token := range []string{"", "abc", token + "x", "x" + token, forged} {
+			if _, err := codec.Decode(token); err != ErrInvalid {
+				t.Errorf("Decode(%q): expected ErrInvalid, got %v", token, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package digest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriod(t *testing.T) {
+	// A Wednesday afternoon.
+	now := time.Date(2024, 5, 15, 14, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		frequency  string
+		start, end time.Time
+	}{
+		{Daily, time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)},
+		{Weekly, time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		start, end := Period(tt.frequency, now)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s: expected %v - %v, got %v - %v", tt.frequency, tt.start, tt.end, start, end)
+		}
+	}
+
+	t.Run("a week ending on Monday", func(t *testing.T) {
+		monday := time.Date(2024, 5, 13, 0, 30, 0, 0, time.UTC)
+		start, end := Period(Weekly, monday)
+		if !end.Equal(time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)) || !start.Equal(end.AddDate(0, 0, -7)) {
+			t.Errorf("unexpected week %v - %v", start, end)
+		}
+	})
+}
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner("secret")
+	token := signer.Token(42)
+
+	id, err := signer.UserID(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 {
+		t.Errorf("expected user 42, got %d", id)
+	}
+
+	t.Run("rejects tampered tokens", func(t *testing.T) {
+		forged := NewSigner("other").Token(42)
+		for _, token := range []string{"", "abc", token + "x", "x" + token, forged} {
+			if _, err := signer.UserID(token); err != ErrInvalidToken {
+				t.Errorf("UserID(%q): expected ErrInvalidToken, got %v", token, err)
+			}
+		}
+	})
+}
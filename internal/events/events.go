@@ -0,0 +1,274 @@
+// Package events is an in-process bus for domain events. Publishers emit
+// typed events without knowing what reacts to them. Subscribers register
+// for one event type and run either synchronously, on the publisher's
+// goroutine before Publish returns, or asynchronously on the bus workers.
+//
+// A subscriber that fails or panics is reported and counted, but never
+// affects the publisher or the other subscribers.
+//
+// Events published with a context returned by Begin are held until the
+// transaction commits and dropped if it rolls back. The store begins one
+// for each database transaction, so events published from inside it are
+// only seen once the data they describe is. InTx subscribers are the
+// exception: they run right away, inside the transaction, and their
+// failures roll it back.
+package events
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is something that happened in the domain. Event types are value
+// types whose Name does not depend on their fields.
+type Event interface {
+	Name() string
+}
+
+type Mode int
+
+const (
+	// Sync subscribers run before Publish returns, in the order they
+	// subscribed.
+	Sync Mode = iota
+	// Async subscribers run on the bus workers. When the queue is full they
+	// run on the publisher's goroutine rather than being lost.
+	Async
+	// InTx subscribers run before Publish returns, within the transaction
+	// of the publisher, which fails with them. Outside a transaction they
+	// run like Sync ones.
+	InTx
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Async:
+		return "async"
+	case InTx:
+		return "intx"
+	}
+	return "sync"
+}
+
+type Config struct {
+	Workers   int
+	QueueSize int
+	// DrainTimeout bounds how long queued events are still delivered
+	// once the bus is stopped.
+	DrainTimeout time.Duration
+}
+
+// ErrorFunc is told about subscribers that failed or panicked.
+type ErrorFunc func(event, subscriber string, err error)
+
+type subscriber struct {
+	name   string
+	mode   Mode
+	handle func(context.Context, Event) error
+
+	delivered atomic.Int64
+	failed    atomic.Int64
+	panicked  atomic.Int64
+}
+
+type job struct {
+	ctx   context.Context
+	sub   *subscriber
+	event Event
+}
+
+type Bus struct {
+	cfg     Config
+	onError ErrorFunc
+	queue   chan job
+
+	mu          sync.RWMutex
+	subscribers map[string][]*subscriber
+
+	published atomic.Int64
+	overflow  atomic.Int64
+}
+
+func New(cfg Config, onError ErrorFunc) *Bus {
+	return &Bus{
+		cfg:         cfg,
+		onError:     onError,
+		queue:       make(chan job, cfg.QueueSize),
+		subscribers: make(map[string][]*subscriber),
+	}
+}
+
+// Subscribe registers fn, named name in errors and stats, for the events
+// of type E.
+func Subscribe[E Event](b *Bus, name string, mode Mode, fn func(context.Context, E) error) {
+	var zero E
+	sub := &subscriber{
+		name: name,
+		mode: mode,
+		handle: func(ctx context.Context, e Event) error {
+			return fn(ctx, e.(E))
+		},
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[zero.Name()] = append(b.subscribers[zero.Name()], sub)
+}
+
+// Publish delivers e to its subscribers, or holds it until the transaction
+// of ctx commits. The InTx subscribers of a held event run right away, and
+// the first of them to fail fails the transaction.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if tx, ok := ctx.Value(txKey{}).(*Tx); ok && tx.hold(b, ctx, e) {
+		for _, sub := range b.subscribersOf(e) {
+			if sub.mode != InTx {
+				continue
+			}
+			if err := b.deliver(ctx, sub, e); err != nil {
+				tx.fail(fmt.Errorf("%s: %w", sub.name, err))
+			}
+		}
+		return
+	}
+	b.dispatch(ctx, e, true)
+}
+
+func (b *Bus) subscribersOf(e Event) []*subscriber {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.subscribers[e.Name()]
+}
+
+// dispatch delivers e to its subscribers, leaving out the InTx ones unless
+// withInTx is set because they already ran in the transaction.
+func (b *Bus) dispatch(ctx context.Context, e Event, withInTx bool) {
+	b.published.Add(1)
+
+	for _, sub := range b.subscribersOf(e) {
+		switch sub.mode {
+		case InTx:
+			if withInTx {
+				b.deliver(ctx, sub, e)
+			}
+			continue
+		case Sync:
+			b.deliver(ctx, sub, e)
+			continue
+		}
+
+		select {
+		case b.queue <- job{ctx: context.WithoutCancel(ctx), sub: sub, event: e}:
+		default:
+			b.overflow.Add(1)
+			b.deliver(context.WithoutCancel(ctx), sub, e)
+		}
+	}
+}
+
+func (b *Bus) deliver(ctx context.Context, sub *subscriber, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			sub.panicked.Add(1)
+			err = fmt.Errorf("panic: %v", r)
+			b.report(e, sub, err)
+		}
+	}()
+
+	if err := sub.handle(ctx, e); err != nil {
+		sub.failed.Add(1)
+		b.report(e, sub, err)
+		return err
+	}
+	sub.delivered.Add(1)
+	return nil
+}
+
+func (b *Bus) report(e Event, sub *subscriber, err error) {
+	if b.onError != nil {
+		b.onError(e.Name(), sub.name, err)
+	}
+}
+
+// Run delivers asynchronous events until ctx is cancelled. Events still
+// queued then are delivered within the drain timeout before Run returns.
+func (b *Bus) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < b.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case j := <-b.queue:
+					b.deliver(j.ctx, j.sub, j.event)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(b.cfg.DrainTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case j := <-b.queue:
+			b.deliver(j.ctx, j.sub, j.event)
+		default:
+			return
+		}
+	}
+}
+
+type SubscriberStats struct {
+	Event      string `json:"event"`
+	Subscriber string `json:"subscriber"`
+	Mode       string `json:"mode"`
+	Delivered  int64  `json:"delivered"`
+	Failed     int64  `json:"failed"`
+	Panicked   int64  `json:"panicked"`
+}
+
+type Stats struct {
+	Published int64 `json:"published"`
+	Queued    int   `json:"queued"`
+	// Overflow counts asynchronous deliveries run by the publisher because
+	// the queue was full.
+	Overflow    int64             `json:"overflow"`
+	Subscribers []SubscriberStats `json:"subscribers"`
+}
+
+func (b *Bus) Stats() Stats {
+	stats := Stats{
+		Published: b.published.Load(),
+		Queued:    len(b.queue),
+		Overflow:  b.overflow.Load(),
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for event, subs := range b.subscribers {
+		for _, sub := range subs {
+			stats.Subscribers = append(stats.Subscribers, SubscriberStats{
+				Event:      event,
+				Subscriber: sub.name,
+				Mode:       sub.mode.String(),
+				Delivered:  sub.delivered.Load(),
+				Failed:     sub.failed.Load(),
+				Panicked:   sub.panicked.Load(),
+			})
+		}
+	}
+	sort.Slice(stats.Subscribers, func(i, j int) bool {
+		a, b := stats.Subscribers[i], stats.Subscribers[j]
+		if a.Event != b.Event {
+			return a.Event < b.Event
+		}
+		return a.Subscriber < b.Subscriber
+	})
+	return stats
+}
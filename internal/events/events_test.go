@@ -0,0 +1,245 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type created struct{ ID int }
+
+func (created) Name() string { return "created" }
+
+type deleted struct{ ID int }
+
+func (deleted) Name() string { return "deleted" }
+
+// recorder collects the IDs its subscribers received.
+type recorder struct {
+	mu  sync.Mutex
+	ids []int
+}
+
+func (r *recorder) add(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, id)
+}
+
+func (r *recorder) get() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.ids...)
+}
+
+func TestPublish(t *testing.T) {
+	var errs []string
+	bus := New(Config{}, func(event, subscriber string, err error) {
+		errs = append(errs, event+"/"+subscriber+": "+err.Error())
+	})
+
+	var rec recorder
+	Subscribe(bus, "panics", Sync, func(ctx context.Context, e created) error {
+		panic("boom")
+	})
+	Subscribe(bus, "fails", Sync, func(ctx context.Context, e created) error {
+		return errors.New("failed")
+	})
+	Subscribe(bus, "records", Sync, func(ctx context.Context, e created) error {
+		rec.add(e.ID)
+		return nil
+	})
+
+	bus.Publish(context.Background(), created{ID: 1})
+	bus.Publish(context.Background(), deleted{ID: 2})
+
+	if got := rec.get(); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("expected only event 1 to be recorded, got %v", got)
+	}
+	if len(errs) != 2 || errs[0] != "created/panics: panic: boom" || errs[1] != "created/fails: failed" {
+		t.Errorf("expected the panic and failure to be reported, got %v", errs)
+	}
+
+	stats := bus.Stats()
+	if stats.Published != 2 {
+		t.Errorf("expected 2 published events, got %d", stats.Published)
+	}
+	want := map[string][3]int64{"fails": {0, 1, 0}, "panics": {0, 0, 1}, "records": {1, 0, 0}}
+	for _, s := range stats.Subscribers {
+		if got := [3]int64{s.Delivered, s.Failed, s.Panicked}; got != want[s.Subscriber] {
+			t.Errorf("%s: expected delivered, failed, panicked %v, got %v", s.Subscriber, want[s.Subscriber], got)
+		}
+	}
+}
+
+func TestAsync(t *testing.T) {
+	bus := New(Config{Workers: 2, QueueSize: 16, DrainTimeout: time.Second}, nil)
+
+	var rec recorder
+	Subscribe(bus, "records", Async, func(ctx context.Context, e created) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rec.add(e.ID)
+		return nil
+	})
+
+	t.Run("should deliver on the caller without workers", func(t *testing.T) {
+		unbuffered := New(Config{}, nil)
+		var got int
+		Subscribe(unbuffered, "records", Async, func(ctx context.Context, e created) error {
+			got = e.ID
+			return nil
+		})
+		unbuffered.Publish(context.Background(), created{ID: 7})
+		if got != 7 || unbuffered.Stats().Overflow != 1 {
+			t.Errorf("expected the overflowing event to be delivered inline, got %d", got)
+		}
+	})
+
+	t.Run("should outlive the publisher's context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		for i := 0; i < 10; i++ {
+			bus.Publish(ctx, created{ID: i})
+		}
+		cancel()
+
+		runCtx, stop := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			bus.Run(runCtx)
+			close(done)
+		}()
+
+		deadline := time.Now().Add(time.Second)
+		for len(rec.get()) < 10 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		stop()
+		<-done
+
+		if got := rec.get(); len(got) != 10 {
+			t.Errorf("expected 10 events, got %v", got)
+		}
+	})
+
+	t.Run("should stop draining at the deadline", func(t *testing.T) {
+		slow := New(Config{QueueSize: 8, DrainTimeout: 50 * time.Millisecond}, nil)
+		var rec recorder
+		Subscribe(slow, "records", Async, func(ctx context.Context, e created) error {
+			time.Sleep(20 * time.Millisecond)
+			rec.add(e.ID)
+			return nil
+		})
+		for i := 0; i < 8; i++ {
+			slow.Publish(context.Background(), created{ID: i})
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		slow.Run(ctx)
+
+		if got := rec.get(); len(got) == 0 || len(got) == 8 {
+			t.Errorf("expected part of the queue to be drained, got %v", got)
+		}
+		if queued := slow.Stats().Queued; queued == 0 {
+			t.Error("expected events left in the queue after the deadline")
+		}
+	})
+}
+
+func TestTx(t *testing.T) {
+	bus := New(Config{}, nil)
+	var rec recorder
+	Subscribe(bus, "records", Sync, func(ctx context.Context, e created) error {
+		rec.add(e.ID)
+		return nil
+	})
+
+	t.Run("should hold events until commit", func(t *testing.T) {
+		ctx, tx := Begin(context.Background())
+		bus.Publish(ctx, created{ID: 1})
+		bus.Publish(ctx, created{ID: 2})
+		if got := rec.get(); len(got) != 0 {
+			t.Fatalf("expected no events before commit, got %v", got)
+		}
+
+		tx.Commit()
+		tx.Rollback()
+		if got := rec.get(); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+			t.Fatalf("expected events 1 and 2 in order, got %v", got)
+		}
+
+		bus.Publish(ctx, created{ID: 3})
+		if got := rec.get(); len(got) != 3 {
+			t.Errorf("expected events after commit to be published right away, got %v", got)
+		}
+	})
+
+	t.Run("should drop events on rollback", func(t *testing.T) {
+		rec = recorder{}
+		ctx, tx := Begin(context.Background())
+		bus.Publish(ctx, created{ID: 1})
+		tx.Rollback()
+		tx.Commit()
+		if got := rec.get(); len(got) != 0 {
+			t.Errorf("expected no events, got %v", got)
+		}
+	})
+
+	t.Run("should run InTx subscribers in the transaction", func(t *testing.T) {
+		rec = recorder{}
+		inTx := New(Config{}, nil)
+		var enqueued recorder
+		Subscribe(inTx, "enqueues", InTx, func(ctx context.Context, e created) error {
+			if e.ID == 2 {
+				return errors.New("failed")
+			}
+			enqueued.add(e.ID)
+			return nil
+		})
+		Subscribe(inTx, "records", Sync, func(ctx context.Context, e created) error {
+			rec.add(e.ID)
+			return nil
+		})
+
+		ctx, tx := Begin(context.Background())
+		inTx.Publish(ctx, created{ID: 1})
+		if got := enqueued.get(); len(got) != 1 || tx.Err() != nil {
+			t.Fatalf("expected event 1 to be enqueued before commit, got %v, %v", got, tx.Err())
+		}
+		inTx.Publish(ctx, created{ID: 2})
+		if tx.Err() == nil {
+			t.Fatal("expected the failed subscriber to fail the transaction")
+		}
+		tx.Rollback()
+
+		ctx, tx = Begin(context.Background())
+		inTx.Publish(ctx, created{ID: 3})
+		tx.Commit()
+		if got := enqueued.get(); len(got) != 2 || got[1] != 3 {
+			t.Errorf("expected InTx subscribers to run once per event, got %v", got)
+		}
+		if got := rec.get(); len(got) != 1 || got[0] != 3 {
+			t.Errorf("expected only the committed event to be recorded, got %v", got)
+		}
+	})
+
+	t.Run("should wait for the outermost commit", func(t *testing.T) {
+		rec = recorder{}
+		ctx, outer := Begin(context.Background())
+		inner, tx := Begin(ctx)
+		bus.Publish(inner, created{ID: 1})
+		tx.Commit()
+		if got := rec.get(); len(got) != 0 {
+			t.Fatalf("expected no events before the outer commit, got %v", got)
+		}
+
+		outer.Rollback()
+		if got := rec.get(); len(got) != 0 {
+			t.Errorf("expected the outer rollback to drop inner events, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+type txKey struct{}
+
+type held struct {
+	bus   *Bus
+	ctx   context.Context
+	event Event
+}
+
+// Tx holds the events published with its context until it ends.
+type Tx struct {
+	parent *Tx
+
+	mu     sync.Mutex
+	events []held
+	done   bool
+	err    error
+}
+
+// Begin starts a transaction. Within another transaction, its events are
+// handed to the outer one on commit, so they wait for the outermost commit.
+func Begin(ctx context.Context) (context.Context, *Tx) {
+	tx := &Tx{}
+	if parent, ok := ctx.Value(txKey{}).(*Tx); ok {
+		tx.parent = parent
+	}
+	return context.WithValue(ctx, txKey{}, tx), tx
+}
+
+// hold keeps e for later, unless the transaction already ended, in which
+// case e is to be published right away.
+func (tx *Tx) hold(bus *Bus, ctx context.Context, e Event) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return false
+	}
+	tx.events = append(tx.events, held{bus: bus, ctx: ctx, event: e})
+	return true
+}
+
+// fail records the first failure of an InTx subscriber.
+func (tx *Tx) fail(err error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.err == nil {
+		tx.err = err
+	}
+}
+
+// Err returns the failure of an InTx subscriber, which the transaction has
+// to be rolled back for.
+func (tx *Tx) Err() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.err
+}
+
+func (tx *Tx) end() []held {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	events := tx.events
+	tx.events = nil
+	return events
+}
+
+// Commit publishes the held events in order. Ending a transaction twice
+// does nothing, so Rollback can be deferred.
+func (tx *Tx) Commit() {
+	for _, h := range tx.end() {
+		if tx.parent != nil && tx.parent.hold(h.bus, h.ctx, h.event) {
+			continue
+		}
+		h.bus.dispatch(h.ctx, h.event, false)
+	}
+}
+
+// Rollback drops the held events.
+func (tx *Tx) Rollback() {
+	tx.end()
+}
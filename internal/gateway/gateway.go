@@ -0,0 +1,218 @@
+// Package gateway implements the WebSocket protocol of interactive clients.
+//
+// Clients exchange JSON messages with a type field. They send:
+//
+//	{"type": "subscribe", "topic": "post:42"}    follow the comments of a post
+//	{"type": "subscribe", "topic": "user:7"}     follow the posts of a user
+//	{"type": "unsubscribe", "topic": "post:42"}
+//	{"type": "typing", "topic": "post:42"}       tell subscribers you are typing
+//	{"type": "ping"} / {"type": "pong"}
+//
+// and receive subscribed, unsubscribed, event, typing, ping, pong and
+// error messages. The server pings idle connections and drops those that
+// stay silent for longer than the read timeout.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TypeSubscribe    = "subscribe"
+	TypeUnsubscribe  = "unsubscribe"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeTyping       = "typing"
+	TypeEvent        = "event"
+	TypePing         = "ping"
+	TypePong         = "pong"
+	TypeError        = "error"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+type Message struct {
+	Type   string          `json:"type"`
+	Topic  string          `json:"topic,omitempty"`
+	UserID int64           `json:"user_id,omitempty"`
+	Event  string          `json:"event,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Conn is a message-oriented connection, such as a WebSocket.
+type Conn interface {
+	ReadMessage(*Message) error
+	WriteMessage(*Message) error
+	SetReadDeadline(time.Time) error
+	SetWriteDeadline(time.Time) error
+	Close() error
+}
+
+type Config struct {
+	// Buffer is how many messages may wait for a slow client.
+	Buffer int
+	// MaxTopics caps the subscriptions of one connection.
+	MaxTopics int
+	// PingInterval is how often the server pings the client.
+	PingInterval time.Duration
+	// ReadTimeout is how long a client may stay silent, pongs included.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// Authorizer decides whether userID may subscribe to topic. Topics are
+// "post:<id>" and "user:<id>".
+type Authorizer func(ctx context.Context, userID int64, kind string, id int64) error
+
+type Gateway struct {
+	Hub       *Hub
+	Config    Config
+	Authorize Authorizer
+}
+
+// Topic names the topic of the comments of a post ("post") or of the posts
+// of a user ("user").
+func Topic(kind string, id int64) string {
+	return kind + ":" + strconv.FormatInt(id, 10)
+}
+
+func parseTopic(topic string) (string, int64, error) {
+	kind, rawID, ok := strings.Cut(topic, ":")
+	if !ok || (kind != "post" && kind != "user") {
+		return "", 0, fmt.Errorf("unknown topic %q", topic)
+	}
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil || id <= 0 {
+		return "", 0, fmt.Errorf("unknown topic %q", topic)
+	}
+	return kind, id, nil
+}
+
+// PublishEvent sends an event to the subscribers of topic.
+func (g *Gateway) PublishEvent(topic, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	g.Hub.Publish(topic, Message{Type: TypeEvent, Topic: topic, Event: event, Data: payload}, nil, false)
+	return nil
+}
+
+// Serve runs the protocol for userID on conn until the client leaves, falls
+// behind or ctx is cancelled. It closes conn.
+func (g *Gateway) Serve(ctx context.Context, conn Conn, userID int64) {
+	client := NewClient(userID, g.Config.Buffer)
+	defer conn.Close()
+	if !g.Hub.Register(client) {
+		return
+	}
+	defer g.Hub.Remove(client)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go g.writeLoop(ctx, conn, client)
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(g.Config.ReadTimeout)); err != nil {
+			return
+		}
+		var m Message
+		if err := conn.ReadMessage(&m); err != nil {
+			return
+		}
+
+		select {
+		case <-client.Done():
+			return
+		default:
+		}
+		g.handle(ctx, client, m)
+	}
+}
+
+func (g *Gateway) handle(ctx context.Context, c *Client, m Message) {
+	reply := func(r Message) {
+		c.Enqueue(r, false)
+	}
+
+	switch m.Type {
+	case TypeSubscribe:
+		kind, id, err := parseTopic(m.Topic)
+		if err != nil {
+			reply(Message{Type: TypeError, Topic: m.Topic, Error: err.Error()})
+			return
+		}
+		if err := g.Authorize(ctx, c.UserID, kind, id); err != nil {
+			if !errors.Is(err, ErrForbidden) {
+				err = errors.New("subscription failed")
+			}
+			reply(Message{Type: TypeError, Topic: m.Topic, Error: err.Error()})
+			return
+		}
+		if !g.Hub.Subscribe(c, m.Topic, g.Config.MaxTopics) {
+			reply(Message{Type: TypeError, Topic: m.Topic, Error: "too many subscriptions"})
+			return
+		}
+		reply(Message{Type: TypeSubscribed, Topic: m.Topic})
+	case TypeUnsubscribe:
+		g.Hub.Unsubscribe(c, m.Topic)
+		reply(Message{Type: TypeUnsubscribed, Topic: m.Topic})
+	case TypeTyping:
+		if !g.subscribed(c, m.Topic) {
+			reply(Message{Type: TypeError, Topic: m.Topic, Error: "not subscribed"})
+			return
+		}
+		g.Hub.Publish(m.Topic, Message{Type: TypeTyping, Topic: m.Topic, UserID: c.UserID}, c, true)
+	case TypePing:
+		reply(Message{Type: TypePong})
+	case TypePong:
+	default:
+		reply(Message{Type: TypeError, Error: fmt.Sprintf("unknown message type %q", m.Type)})
+	}
+}
+
+func (g *Gateway) subscribed(c *Client, topic string) bool {
+	g.Hub.mu.RLock()
+	defer g.Hub.mu.RUnlock()
+	_, ok := c.topics[topic]
+	return ok
+}
+
+// writeLoop is the only writer of conn. It closes conn when the client is
+// disconnected so the read loop of Serve returns too.
+func (g *Gateway) writeLoop(ctx context.Context, conn Conn, c *Client) {
+	ping := time.NewTicker(g.Config.PingInterval)
+	defer ping.Stop()
+	defer conn.Close()
+
+	write := func(m *Message) bool {
+		if err := conn.SetWriteDeadline(time.Now().Add(g.Config.WriteTimeout)); err != nil {
+			return false
+		}
+		return conn.WriteMessage(m) == nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.Done():
+			return
+		case m := <-c.Messages():
+			if !write(&m) {
+				return
+			}
+		case <-ping.C:
+			if !write(&Message{Type: TypePing}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"sync"
+)
+
+// Hub routes messages to the clients subscribed to a topic. It keeps
+// everything in memory, so clients only see what is published in their own
+// process.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+	topics  map[string]map[*Client]struct{}
+	closed  bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clients: map[*Client]struct{}{},
+		topics:  map[string]map[*Client]struct{}{},
+	}
+}
+
+// Client is one connection of a user. Messages published to its topics
+// queue up in a buffer the connection drains; a client whose buffer is full
+// misses ephemeral messages such as typing indicators and is disconnected
+// on anything else.
+type Client struct {
+	UserID int64
+
+	send      chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// topics is guarded by the hub's lock.
+	topics map[string]struct{}
+}
+
+func NewClient(userID int64, buffer int) *Client {
+	return &Client{
+		UserID: userID,
+		send:   make(chan Message, buffer),
+		done:   make(chan struct{}),
+		topics: map[string]struct{}{},
+	}
+}
+
+// Messages delivers what the client should write to its connection.
+func (c *Client) Messages() <-chan Message {
+	return c.send
+}
+
+// Done is closed once the client is disconnected.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) disconnect() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// Enqueue queues m for the client without blocking. It reports false when
+// the buffer is full; the client is then disconnected unless m is
+// droppable.
+func (c *Client) Enqueue(m Message, droppable bool) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- m:
+		return true
+	default:
+		if !droppable {
+			c.disconnect()
+		}
+		return false
+	}
+}
+
+// Register adds c to the hub. It reports false once the hub is closed.
+func (h *Hub) Register(c *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.clients[c] = struct{}{}
+	return true
+}
+
+// Subscribe adds c to topic. It reports false when c already has max
+// subscriptions.
+func (h *Hub) Subscribe(c *Client, topic string, max int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := c.topics[topic]; ok {
+		return true
+	}
+	if len(c.topics) >= max {
+		return false
+	}
+	c.topics[topic] = struct{}{}
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[*Client]struct{}{}
+	}
+	h.topics[topic][c] = struct{}{}
+	return true
+}
+
+func (h *Hub) Unsubscribe(c *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unsubscribe(c, topic)
+}
+
+// Remove unsubscribes c from every topic and disconnects it.
+func (h *Hub) Remove(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for topic := range c.topics {
+		h.unsubscribe(c, topic)
+	}
+	delete(h.clients, c)
+	c.disconnect()
+}
+
+// Close disconnects every client and refuses new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.clients {
+		c.disconnect()
+	}
+}
+
+func (h *Hub) unsubscribe(c *Client, topic string) {
+	delete(c.topics, topic)
+	if subs := h.topics[topic]; subs != nil {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Publish queues m for every client subscribed to topic except from, which
+// may be nil. Droppable messages are skipped by clients that are behind.
+func (h *Hub) Publish(topic string, m Message, from *Client, droppable bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.topics[topic] {
+		if c != from {
+			c.Enqueue(m, droppable)
+		}
+	}
+}
+
+// Subscribers counts the clients subscribed to topic.
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
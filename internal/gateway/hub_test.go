@@ -0,0 +1,285 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeConn is an in-memory Conn: the test writes what the server reads and
+// reads what the server writes.
+type pipeConn struct {
+	in        chan Message
+	out       chan Message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeConn() *pipeConn {
+	return &pipeConn{
+		in:     make(chan Message, 16),
+		out:    make(chan Message, 16),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *pipeConn) ReadMessage(m *Message) error {
+	select {
+	case *m = <-c.in:
+		return nil
+	case <-c.closed:
+		return io.EOF
+	}
+}
+
+func (c *pipeConn) WriteMessage(m *Message) error {
+	select {
+	case c.out <- *m:
+		return nil
+	case <-c.closed:
+		return io.EOF
+	}
+}
+
+func (c *pipeConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *pipeConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *pipeConn) send(m Message) {
+	c.in <- m
+}
+
+func (c *pipeConn) receive(t *testing.T) Message {
+	t.Helper()
+	select {
+	case m := <-c.out:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+		return Message{}
+	}
+}
+
+func newTestGateway() *Gateway {
+	return &Gateway{
+		Hub: NewHub(),
+		Config: Config{
+			Buffer:       8,
+			MaxTopics:    2,
+			PingInterval: time.Hour,
+			ReadTimeout:  time.Hour,
+			WriteTimeout: time.Second,
+		},
+		Authorize: func(ctx context.Context, userID int64, kind string, id int64) error {
+			if kind == "user" && id == 666 {
+				return ErrForbidden
+			}
+			return nil
+		},
+	}
+}
+
+func serve(t *testing.T, g *Gateway, userID int64) *pipeConn {
+	t.Helper()
+	conn := newPipeConn()
+	go g.Serve(context.Background(), conn, userID)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func subscribe(t *testing.T, conn *pipeConn, topic string) {
+	t.Helper()
+	conn.send(Message{Type: TypeSubscribe, Topic: topic})
+	if m := conn.receive(t); m.Type != TypeSubscribed || m.Topic != topic {
+		t.Fatalf("expected to subscribe to %s, got %+v", topic, m)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	t.Run("should deliver events of subscribed topics", func(t *testing.T) {
+		g := newTestGateway()
+		conn := serve(t, g, 1)
+		subscribe(t, conn, "post:42")
+
+		if err := g.PublishEvent("post:42", "comment", map[string]int{"id": 7}); err != nil {
+			t.Fatal(err)
+		}
+		m := conn.receive(t)
+		if m.Type != TypeEvent || m.Event != "comment" || string(m.Data) != `{"id":7}` {
+			t.Errorf("unexpected message %+v", m)
+		}
+
+		conn.send(Message{Type: TypeUnsubscribe, Topic: "post:42"})
+		if m := conn.receive(t); m.Type != TypeUnsubscribed {
+			t.Fatalf("expected to unsubscribe, got %+v", m)
+		}
+		if n := g.Hub.Subscribers("post:42"); n != 0 {
+			t.Errorf("expected no subscribers, got %d", n)
+		}
+	})
+
+	t.Run("should reject invalid and forbidden topics", func(t *testing.T) {
+		g := newTestGateway()
+		conn := serve(t, g, 1)
+
+		for _, topic := range []string{"post:abc", "group:1", "user:666"} {
+			conn.send(Message{Type: TypeSubscribe, Topic: topic})
+			if m := conn.receive(t); m.Type != TypeError || m.Topic != topic {
+				t.Errorf("expected an error for %s, got %+v", topic, m)
+			}
+		}
+
+		subscribe(t, conn, "user:1")
+		subscribe(t, conn, "user:2")
+		conn.send(Message{Type: TypeSubscribe, Topic: "user:3"})
+		if m := conn.receive(t); m.Type != TypeError {
+			t.Errorf("expected the topic limit to apply, got %+v", m)
+		}
+	})
+
+	t.Run("should relay typing to other subscribers", func(t *testing.T) {
+		g := newTestGateway()
+		alice := serve(t, g, 1)
+		bob := serve(t, g, 2)
+		subscribe(t, alice, "post:1")
+		subscribe(t, bob, "post:1")
+
+		alice.send(Message{Type: TypeTyping, Topic: "post:1"})
+		if m := bob.receive(t); m.Type != TypeTyping || m.UserID != 1 {
+			t.Errorf("expected alice typing, got %+v", m)
+		}
+
+		alice.send(Message{Type: TypePing})
+		if m := alice.receive(t); m.Type != TypePong {
+			t.Errorf("expected alice to get a pong and not her own typing, got %+v", m)
+		}
+
+		bob.send(Message{Type: TypeTyping, Topic: "post:2"})
+		if m := bob.receive(t); m.Type != TypeError {
+			t.Errorf("expected typing outside a subscription to fail, got %+v", m)
+		}
+	})
+
+	t.Run("should ping clients", func(t *testing.T) {
+		g := newTestGateway()
+		g.Config.PingInterval = 10 * time.Millisecond
+		conn := serve(t, g, 1)
+		if m := conn.receive(t); m.Type != TypePing {
+			t.Errorf("expected a ping, got %+v", m)
+		}
+	})
+
+	t.Run("should close connections on shutdown", func(t *testing.T) {
+		g := newTestGateway()
+		conn := newPipeConn()
+		done := make(chan struct{})
+		go func() {
+			g.Serve(context.Background(), conn, 1)
+			close(done)
+		}()
+		subscribe(t, conn, "post:1")
+
+		g.Hub.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expected the connection to be closed")
+		}
+		if err := conn.ReadMessage(&Message{}); !errors.Is(err, io.EOF) {
+			t.Errorf("expected a closed connection, got %v", err)
+		}
+	})
+}
+
+func TestHubBackpressure(t *testing.T) {
+	h := NewHub()
+	c := NewClient(1, 2)
+	h.Register(c)
+	h.Subscribe(c, "post:1", 10)
+
+	for i := 0; i < 3; i++ {
+		h.Publish("post:1", Message{Type: TypeTyping}, nil, true)
+	}
+	select {
+	case <-c.Done():
+		t.Fatal("expected dropped typing not to disconnect the client")
+	default:
+	}
+
+	h.Publish("post:1", Message{Type: TypeEvent}, nil, false)
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("expected a slow client to be disconnected")
+	}
+}
+
+func TestHubConcurrency(t *testing.T) {
+	const clients, topics, messages = 200, 10, 100
+
+	h := NewHub()
+	var wg sync.WaitGroup
+	received := make([]int, clients)
+	for i := 0; i < clients; i++ {
+		c := NewClient(int64(i), messages)
+		h.Register(c)
+		h.Subscribe(c, fmt.Sprintf("post:%d", i%topics), 1)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for range c.Messages() {
+				received[i]++
+				if received[i] == messages {
+					h.Remove(c)
+					return
+				}
+			}
+		}(i)
+	}
+
+	var publishers sync.WaitGroup
+	for topic := 0; topic < topics; topic++ {
+		publishers.Add(1)
+		go func(topic int) {
+			defer publishers.Done()
+			for i := 0; i < messages; i++ {
+				h.Publish(fmt.Sprintf("post:%d", topic), Message{Type: TypeEvent}, nil, false)
+			}
+		}(topic)
+	}
+	publishers.Wait()
+	wg.Wait()
+
+	for i, n := range received {
+		if n != messages {
+			t.Fatalf("client %d received %d messages, expected %d", i, n, messages)
+		}
+	}
+}
+
+func BenchmarkHubPublish(b *testing.B) {
+	for _, subscribers := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprint(subscribers), func(b *testing.B) {
+			h := NewHub()
+			for i := 0; i < subscribers; i++ {
+				c := NewClient(int64(i), 1)
+				h.Register(c)
+				h.Subscribe(c, "post:1", 1)
+			}
+			m := Message{Type: TypeTyping, Topic: "post:1"}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.Publish("post:1", m, nil, true)
+			}
+		})
+	}
+}
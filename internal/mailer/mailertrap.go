@@ -6,6 +6,9 @@ const (
 	FromName            = "dzhoddi"
 	MaxRetries          = 3
 	UserWelcomeTemplate = "user_invitation.tmpl"
+
+	EmailVerificationTemplate = "email_verification.tmpl"
+	DigestTemplate            = "digest.tmpl"
 )
 
 //go:embed "templates"
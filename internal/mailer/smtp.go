@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type SMTPMailer struct {
+	fromEmail string
+	addr      string
+	auth      smtp.Auth
+	backoff   time.Duration
+}
+
+func NewSMTPMailer(host string, port int, username, password, fromEmail string) (*SMTPMailer, error) {
+	if host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		fromEmail: fromEmail,
+		addr:      net.JoinHostPort(host, strconv.Itoa(port)),
+		auth:      auth,
+		backoff:   time.Second,
+	}, nil
+}
+
+// Send renders templateFile and delivers it to email, trying up to
+// MaxRetries times with a growing pause in between. In sandbox mode the
+// message is rendered but not delivered.
+func (m *SMTPMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int64, error) {
+	msg, err := m.render(templateFile, username, email, data)
+	if err != nil {
+		return -1, err
+	}
+	if isSandbox {
+		return 200, nil
+	}
+
+	for i := 0; i < MaxRetries; i++ {
+		if i > 0 {
+			time.Sleep(m.backoff * time.Duration(i))
+		}
+		err = smtp.SendMail(m.addr, m.auth, m.fromEmail, []string{email}, msg)
+		if err == nil {
+			return 200, nil
+		}
+	}
+
+	return -1, fmt.Errorf("failed to send email after %d attempts: %w", MaxRetries, err)
+}
+
+func (m *SMTPMailer) render(templateFile, username, email string, data any) ([]byte, error) {
+	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	body := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(body, "body", data); err != nil {
+		return nil, err
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", mime.QEncoding.Encode("utf-8", FromName)+" <"+m.fromEmail+">")
+	fmt.Fprintf(msg, "To: %s\r\n", mime.QEncoding.Encode("utf-8", username)+" <"+email+">")
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject.String()))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
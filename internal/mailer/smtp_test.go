@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSMTPMailer(t *testing.T) {
+	// Nothing listens on the port once the listener is closed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m, err := NewSMTPMailer("127.0.0.1", port, "", "", "noreply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.backoff = time.Millisecond
+	vars := struct {
+		Username        string
+		ConfirmationURL string
+	}{Username: "gopher", ConfirmationURL: "http://localhost:4000/confirm-email/token"}
+
+	t.Run("should not deliver in sandbox mode", func(t *testing.T) {
+		status, err := m.Send(EmailVerificationTemplate, "gopher", "gopher@example.com", vars, true)
+		if err != nil || status != 200 {
+			t.Errorf("expected status 200, got %d, %v", status, err)
+		}
+	})
+
+	t.Run("should report failed deliveries", func(t *testing.T) {
+		if _, err := m.Send(EmailVerificationTemplate, "gopher", "gopher@example.com", vars, false); err == nil {
+			t.Error("expected an error without a server to deliver to")
+		}
+	})
+
+	t.Run("should reject unknown templates", func(t *testing.T) {
+		if _, err := m.Send("missing.tmpl", "gopher", "gopher@example.com", vars, true); err == nil {
+			t.Error("expected an error for a missing template")
+		}
+	})
+}
+
+func TestSMTPMailerRetries(t *testing.T) {
+	// The server hangs up on every connection, so each attempt fails.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	attempts := make(chan struct{}, MaxRetries+1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			attempts <- struct{}{}
+			conn.Close()
+		}
+	}()
+
+	m, err := NewSMTPMailer("127.0.0.1", l.Addr().(*net.TCPAddr).Port, "", "", "noreply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.backoff = time.Millisecond
+
+	vars := struct {
+		Username        string
+		ConfirmationURL string
+	}{Username: "gopher", ConfirmationURL: "http://localhost:4000/confirm-email/token"}
+	if _, err := m.Send(EmailVerificationTemplate, "gopher", "gopher@example.com", vars, false); err == nil {
+		t.Fatal("expected an error when every attempt fails")
+	}
+
+	if got := len(attempts); got != MaxRetries {
+		t.Errorf("expected %d attempts, got %d", MaxRetries, got)
+	}
+}
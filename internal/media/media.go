@@ -0,0 +1,160 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gabriel-vasile/mimetype"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrBadDimensions   = errors.New("image dimensions out of range")
+)
+
+// extensions lists the content types accepted for upload and the file
+// extension they are stored under.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+type Image struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+type Limits struct {
+	MinDimension int
+	MaxDimension int
+	// MaxPixels bounds the decoded size of an image, which can be far
+	// larger than the file for well compressed ones.
+	MaxPixels int
+}
+
+// Inspect sniffs the content type of data and checks the image dimensions
+// without decoding the whole image, so that Thumbnail only decodes images
+// within limits.
+func Inspect(data []byte, limits Limits) (*Image, error) {
+	contentType := mimetype.Detect(data).String()
+	ext, ok := extensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if cfg.Width < limits.MinDimension || cfg.Height < limits.MinDimension ||
+		cfg.Width > limits.MaxDimension || cfg.Height > limits.MaxDimension ||
+		cfg.Width*cfg.Height > limits.MaxPixels {
+		return nil, ErrBadDimensions
+	}
+
+	return &Image{
+		Data:        data,
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+	}, nil
+}
+
+// Thumbnail scales img down so that neither side exceeds maxSide. JPEG input
+// stays JPEG, everything else is encoded as PNG to keep transparency.
+func Thumbnail(img *Image, maxSide int) (*Image, error) {
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := fit(img.Width, img.Height, maxSide)
+	dst := resize(src, w, h)
+
+	buf := new(bytes.Buffer)
+	thumb := &Image{Width: w, Height: h}
+	if img.ContentType == "image/jpeg" {
+		err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: 85})
+		thumb.ContentType, thumb.Ext = "image/jpeg", ".jpg"
+	} else {
+		err = png.Encode(buf, dst)
+		thumb.ContentType, thumb.Ext = "image/png", ".png"
+	}
+	if err != nil {
+		return nil, err
+	}
+	thumb.Data = buf.Bytes()
+	return thumb, nil
+}
+
+func fit(w, h, maxSide int) (int, int) {
+	if w <= maxSide && h <= maxSide {
+		return w, h
+	}
+	if w >= h {
+		return maxSide, max(1, h*maxSide/w)
+	}
+	return max(1, w*maxSide/h), maxSide
+}
+
+// resize scales src to w x h with a box filter: every destination pixel is
+// the average of the source pixels it covers. Source pixels are read in
+// place rather than from a converted copy of src.
+func resize(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max(y0+1, (y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max(x0+1, (x+1)*sw/w)
+
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := pixel(src, b.Min.X+sx, b.Min.Y+sy)
+					r += pr
+					g += pg
+					bl += pb
+					a += pa
+					n++
+				}
+			}
+
+			off := dst.PixOffset(x, y)
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(bl / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// pixel returns the 8-bit alpha-premultiplied color of src at x, y. The
+// types the decoders return for JPEG and opaque PNG images are read
+// directly; anything else goes through the color model.
+func pixel(src image.Image, x, y int) (r, g, b, a uint32) {
+	switch img := src.(type) {
+	case *image.YCbCr:
+		yi, ci := img.YOffset(x, y), img.COffset(x, y)
+		cr, cg, cb := color.YCbCrToRGB(img.Y[yi], img.Cb[ci], img.Cr[ci])
+		return uint32(cr), uint32(cg), uint32(cb), 0xff
+	case *image.RGBA:
+		off := img.PixOffset(x, y)
+		return uint32(img.Pix[off]), uint32(img.Pix[off+1]), uint32(img.Pix[off+2]), uint32(img.Pix[off+3])
+	}
+	r, g, b, a = src.At(x, y).RGBA()
+	return r >> 8, g >> 8, b >> 8, a >> 8
+}
@@ -0,0 +1,131 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var testLimits = Limits{MinDimension: 16, MaxDimension: 1000, MaxPixels: 200_000}
+
+func encode(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(buf, img, nil)
+	case "gif":
+		err = gif.Encode(buf, img, nil)
+	default:
+		err = png.Encode(buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	t.Run("should detect supported images", func(t *testing.T) {
+		for format, want := range map[string]string{"jpeg": "image/jpeg", "png": "image/png", "gif": "image/gif"} {
+			img, err := Inspect(encode(t, format, 40, 30), testLimits)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if img.ContentType != want || img.Width != 40 || img.Height != 30 {
+				t.Errorf("%s: expected a 40x30 %s, got a %dx%d %s", format, want, img.Width, img.Height, img.ContentType)
+			}
+		}
+	})
+
+	t.Run("should reject other files", func(t *testing.T) {
+		for _, data := range [][]byte{[]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), []byte("plain text")} {
+			if _, err := Inspect(data, testLimits); !errors.Is(err, ErrUnsupportedType) {
+				t.Errorf("expected ErrUnsupportedType, got %v", err)
+			}
+		}
+
+		truncated := encode(t, "png", 40, 30)[:20]
+		if _, err := Inspect(truncated, testLimits); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("expected ErrUnsupportedType for a truncated image, got %v", err)
+		}
+	})
+
+	t.Run("should reject images out of limits", func(t *testing.T) {
+		for _, size := range [][2]int{{8, 100}, {100, 1001}, {500, 500}} {
+			if _, err := Inspect(encode(t, "png", size[0], size[1]), testLimits); !errors.Is(err, ErrBadDimensions) {
+				t.Errorf("%dx%d: expected ErrBadDimensions, got %v", size[0], size[1], err)
+			}
+		}
+	})
+}
+
+func TestThumbnail(t *testing.T) {
+	cases := []struct {
+		format      string
+		w, h        int
+		contentType string
+		thumbW      int
+		thumbH      int
+	}{
+		{"jpeg", 400, 200, "image/jpeg", 100, 50},
+		{"png", 200, 400, "image/png", 50, 100},
+		{"gif", 60, 40, "image/png", 60, 40},
+	}
+
+	for _, c := range cases {
+		img, err := Inspect(encode(t, c.format, c.w, c.h), testLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thumb, err := Thumbnail(img, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if thumb.ContentType != c.contentType || thumb.Width != c.thumbW || thumb.Height != c.thumbH {
+			t.Errorf("%s: expected a %dx%d %s, got a %dx%d %s", c.format,
+				c.thumbW, c.thumbH, c.contentType, thumb.Width, thumb.Height, thumb.ContentType)
+		}
+
+		decoded, _, err := image.DecodeConfig(bytes.NewReader(thumb.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Width != thumb.Width || decoded.Height != thumb.Height {
+			t.Errorf("%s: expected the encoded thumbnail to be %dx%d, got %dx%d", c.format,
+				thumb.Width, thumb.Height, decoded.Width, decoded.Height)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		v := uint8(0)
+		if x%2 == 1 {
+			v = 200
+		}
+		src.Set(x, 0, color.RGBA{R: v, G: v, B: v, A: 0xff})
+		src.Set(x, 1, color.RGBA{R: v, G: v, B: v, A: 0xff})
+	}
+
+	dst := resize(src, 2, 1)
+	for x := 0; x < 2; x++ {
+		if got := dst.RGBAAt(x, 0); got != (color.RGBA{R: 100, G: 100, B: 100, A: 0xff}) {
+			t.Errorf("expected pixel %d to average its source pixels, got %v", x, got)
+		}
+	}
+}
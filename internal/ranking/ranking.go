@@ -0,0 +1,159 @@
+package ranking
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Candidate is a post that may be shown in a ranked feed, with what the
+// scorers need to know about it.
+type Candidate struct {
+	PostID    int64
+	AuthorID  int64
+	CreatedAt time.Time
+	Tags      []string
+	Comments  int64
+	Reactions int64
+	Reposts   int64
+	// Followed tells whether the viewer follows the author, as opposed to
+	// posts picked for being popular.
+	Followed bool
+}
+
+// Signals describe the viewer. Affinities range from 0 (no interaction)
+// to 1 (the author or tag the viewer interacts with the most).
+type Signals struct {
+	AuthorAffinity map[int64]float64
+	TagAffinity    map[string]float64
+}
+
+// Scorer rates one aspect of a candidate, typically between 0 and 1.
+type Scorer interface {
+	Score(c Candidate, s Signals, now time.Time) float64
+}
+
+// Recency halves the score of a post every HalfLife of age.
+type Recency struct {
+	HalfLife time.Duration
+}
+
+func (r Recency) Score(c Candidate, _ Signals, now time.Time) float64 {
+	age := now.Sub(c.CreatedAt)
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp2(-age.Hours() / r.HalfLife.Hours())
+}
+
+// Engagement grows with the comments, reactions and reposts of a post on a
+// logarithmic scale, so a few viral posts do not drown everything else.
+// Saturation is the weighted engagement that scores 1.
+type Engagement struct {
+	Comment, Reaction, Repost float64
+	Saturation                float64
+}
+
+func (e Engagement) Score(c Candidate, _ Signals, _ time.Time) float64 {
+	total := e.Comment*float64(c.Comments) + e.Reaction*float64(c.Reactions) + e.Repost*float64(c.Reposts)
+	return math.Min(math.Log1p(total)/math.Log1p(e.Saturation), 1)
+}
+
+// AuthorAffinity favours authors the viewer interacts with.
+type AuthorAffinity struct{}
+
+func (AuthorAffinity) Score(c Candidate, s Signals, _ time.Time) float64 {
+	return s.AuthorAffinity[c.AuthorID]
+}
+
+// TagAffinity favours posts carrying the tags the viewer interacts with
+// the most.
+type TagAffinity struct{}
+
+func (TagAffinity) Score(c Candidate, s Signals, _ time.Time) float64 {
+	best := 0.0
+	for _, t := range c.Tags {
+		best = math.Max(best, s.TagAffinity[t])
+	}
+	return best
+}
+
+// Weighted is a scorer with the weight of its score in the total.
+type Weighted struct {
+	Scorer Scorer
+	Weight float64
+}
+
+type Scored struct {
+	Candidate
+	Score float64
+}
+
+// Ranker orders candidates by the weighted sum of its scorers' scores.
+type Ranker struct {
+	Scorers []Weighted
+	// MaxPerAuthor caps the posts of one author on a page; 0 disables it.
+	MaxPerAuthor int
+	// Now is the clock scores are computed against.
+	Now func() time.Time
+}
+
+// Rank scores candidates and orders them best first, ties broken by newest
+// post. With MaxPerAuthor set, the result is then reordered so that every
+// page of pageSize posts holds at most MaxPerAuthor posts of one author
+// while other authors have posts left to show.
+func (r Ranker) Rank(candidates []Candidate, s Signals, pageSize int) []Scored {
+	now := r.Now()
+	ranked := make([]Scored, len(candidates))
+	for i, c := range candidates {
+		ranked[i] = Scored{Candidate: c}
+		for _, w := range r.Scorers {
+			ranked[i].Score += w.Weight * w.Scorer.Score(c, s, now)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].PostID > ranked[j].PostID
+	})
+
+	if r.MaxPerAuthor <= 0 || pageSize <= 0 {
+		return ranked
+	}
+	return diversify(ranked, pageSize, r.MaxPerAuthor)
+}
+
+// diversify fills pages greedily from ranked, deferring posts of authors
+// already at maxPerAuthor on the current page to later pages. When only
+// such posts are left, they fill the page anyway rather than leaving it
+// short.
+func diversify(ranked []Scored, pageSize, maxPerAuthor int) []Scored {
+	result := make([]Scored, 0, len(ranked))
+	pending := ranked
+
+	for len(pending) > 0 {
+		perAuthor := map[int64]int{}
+		var deferred []Scored
+		page := 0
+
+		i := 0
+		for ; i < len(pending) && page < pageSize; i++ {
+			c := pending[i]
+			if perAuthor[c.AuthorID] >= maxPerAuthor {
+				deferred = append(deferred, c)
+				continue
+			}
+			perAuthor[c.AuthorID]++
+			result = append(result, c)
+			page++
+		}
+		for ; page < pageSize && len(deferred) > 0; page++ {
+			result = append(result, deferred[0])
+			deferred = deferred[1:]
+		}
+
+		pending = append(deferred, pending[i:]...)
+	}
+	return result
+}
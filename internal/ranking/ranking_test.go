@@ -0,0 +1,106 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func clock() time.Time { return now }
+
+func ids(ranked []Scored) []int64 {
+	out := make([]int64, len(ranked))
+	for i, r := range ranked {
+		out[i] = r.PostID
+	}
+	return out
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScorers(t *testing.T) {
+	s := Signals{
+		AuthorAffinity: map[int64]float64{1: 0.5},
+		TagAffinity:    map[string]float64{"go": 0.25, "sql": 0.75},
+	}
+	c := Candidate{AuthorID: 1, CreatedAt: now.Add(-2 * time.Hour), Tags: []string{"go", "sql"}, Comments: 1, Reactions: 2}
+
+	tests := []struct {
+		name   string
+		scorer Scorer
+		want   float64
+	}{
+		{"recency halves every half-life", Recency{HalfLife: time.Hour}, 0.25},
+		{"engagement saturates", Engagement{Comment: 2, Reaction: 1, Saturation: 4}, 1},
+		{"author affinity", AuthorAffinity{}, 0.5},
+		{"tag affinity takes the best tag", TagAffinity{}, 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scorer.Score(c, s, now); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	candidates := []Candidate{
+		{PostID: 1, AuthorID: 10, CreatedAt: now.Add(-3 * time.Hour)},
+		{PostID: 2, AuthorID: 10, CreatedAt: now.Add(-1 * time.Hour)},
+		{PostID: 3, AuthorID: 20, CreatedAt: now.Add(-2 * time.Hour), Comments: 50},
+		{PostID: 4, AuthorID: 10, CreatedAt: now},
+		{PostID: 5, AuthorID: 30, CreatedAt: now.Add(-5 * time.Hour)},
+	}
+
+	t.Run("orders by weighted score", func(t *testing.T) {
+		r := Ranker{
+			Scorers: []Weighted{
+				{Scorer: Recency{HalfLife: time.Hour}, Weight: 1},
+				{Scorer: Engagement{Comment: 1, Saturation: 50}, Weight: 2},
+			},
+			Now: clock,
+		}
+		got := ids(r.Rank(candidates, Signals{}, 0))
+		if want := []int64{3, 4, 2, 1, 5}; !equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("caps posts per author on each page", func(t *testing.T) {
+		r := Ranker{
+			Scorers:      []Weighted{{Scorer: Recency{HalfLife: time.Hour}, Weight: 1}},
+			MaxPerAuthor: 1,
+			Now:          clock,
+		}
+		// By recency alone: 4, 2, 3, 1, 5 with posts 4, 2 and 1 by author 10.
+		got := ids(r.Rank(candidates, Signals{}, 2))
+		if want := []int64{4, 3, 2, 5, 1}; !equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("fills pages when only one author is left", func(t *testing.T) {
+		r := Ranker{
+			Scorers:      []Weighted{{Scorer: Recency{HalfLife: time.Hour}, Weight: 1}},
+			MaxPerAuthor: 1,
+			Now:          clock,
+		}
+		got := ids(r.Rank(candidates[:2], Signals{}, 2))
+		if want := []int64{2, 1}; !equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package richtext
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	MaxTagLength      = 100
+	MaxUsernameLength = 100
+)
+
+// Entity is a #hashtag or @mention found in a text. Start and End are code
+// point offsets of the whole entity including its # or @ sign, End being
+// exclusive.
+type Entity struct {
+	Value string `json:"value"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type Entities struct {
+	Hashtags []Entity
+	Mentions []Entity
+}
+
+// Parse extracts hashtags and mentions from text. Hashtags are lower-cased;
+// mentions keep the username as written. An entity only starts at the
+// beginning of the text or after a character that cannot be part of a word,
+// so e-mail addresses and URL fragments are not picked up.
+func Parse(text string) Entities {
+	var e Entities
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		sign := runes[i]
+		if sign != '#' && sign != '@' {
+			continue
+		}
+		if i > 0 && (isWordRune(runes[i-1]) || runes[i-1] == '#' || runes[i-1] == '@') {
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i+1 : j])
+		if word == "" {
+			continue
+		}
+
+		switch sign {
+		case '#':
+			if len(word) <= MaxTagLength && strings.IndexFunc(word, unicode.IsLetter) >= 0 {
+				e.Hashtags = append(e.Hashtags, Entity{Value: strings.ToLower(word), Start: i, End: j})
+			}
+		case '@':
+			if len(word) <= MaxUsernameLength {
+				e.Mentions = append(e.Mentions, Entity{Value: word, Start: i, End: j})
+			}
+		}
+		i = j - 1
+	}
+	return e
+}
+
+// NormalizeTag turns a client supplied tag into its canonical form, or ""
+// when it is not a valid tag.
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if tag == "" || len(tag) > MaxTagLength || strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+		return ""
+	}
+	for _, r := range tag {
+		if !isWordRune(r) {
+			return ""
+		}
+	}
+	return tag
+}
+
+// Tags merges client supplied tags with the hashtags found in text, without
+// duplicates and in order of first appearance.
+func Tags(clientTags []string, text string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	add := func(tag string) {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	for _, t := range clientTags {
+		add(NormalizeTag(t))
+	}
+	for _, h := range Parse(text).Hashtags {
+		add(h.Value)
+	}
+	return tags
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
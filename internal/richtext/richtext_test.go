@@ -0,0 +1,52 @@
+package richtext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		hashtags []Entity
+		mentions []Entity
+	}{
+		{
+			name:     "hashtags and mentions",
+			text:     "Hi @alice, loving #GoLang and #go_1",
+			hashtags: []Entity{{"golang", 18, 25}, {"go_1", 30, 35}},
+			mentions: []Entity{{"alice", 3, 9}},
+		},
+		{
+			name: "ignores emails, numbers and doubled signs",
+			text: "mail bob@example.com about #123 or ##tag",
+		},
+		{
+			name:     "offsets count code points",
+			text:     "héllo #café @zoë",
+			hashtags: []Entity{{"café", 6, 11}},
+			mentions: []Entity{{"zoë", 12, 16}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Parse(tt.text)
+			if !reflect.DeepEqual(e.Hashtags, tt.hashtags) {
+				t.Errorf("hashtags: expected %v, got %v", tt.hashtags, e.Hashtags)
+			}
+			if !reflect.DeepEqual(e.Mentions, tt.mentions) {
+				t.Errorf("mentions: expected %v, got %v", tt.mentions, e.Mentions)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	got := Tags([]string{"#Go", "go", "bad tag", "Web"}, "more #web and #postgres")
+	want := []string{"go", "web", "postgres"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+)
+
+var ErrBlocked = errors.New("user is blocked")
+
+// notBlockedSQL filters out rows whose author (the column passed in) and the
+// viewer (the placeholder passed in) have blocked each other in any direction.
+func notBlockedSQL(authorCol, viewerArg string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM user_blocks b
+		WHERE (b.blocker_id = ` + viewerArg + ` AND b.blocked_id = ` + authorCol + `)
+		   OR (b.blocker_id = ` + authorCol + ` AND b.blocked_id = ` + viewerArg + `))`
+}
+
+// notMutedSQL filters out rows whose author the viewer has muted.
+func notMutedSQL(authorCol, viewerArg string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM user_mutes m
+		WHERE m.muter_id = ` + viewerArg + ` AND m.muted_id = ` + authorCol + `)`
+}
+
+// visibleAuthorSQL keeps rows whose author the viewer may see: public
+// accounts, private accounts the viewer follows and the viewer themselves,
+// as long as neither side blocked the other.
+func visibleAuthorSQL(authorCol, privateCol, viewerArg string) string {
+	return `(NOT ` + privateCol + ` OR ` + authorCol + ` = ` + viewerArg + ` OR EXISTS (
+		SELECT 1 FROM followers vf WHERE vf.user_id = ` + authorCol + ` AND vf.follower_id = ` + viewerArg + `)) AND
+		` + notBlockedSQL(authorCol, viewerArg)
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func isBlocked(ctx context.Context, q queryRower, a, b int64) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1))`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var blocked bool
+	err := q.QueryRowContext(ctx, query, a, b).Scan(&blocked)
+	return blocked, err
+}
+
+type BlockedUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+}
+
+type BlocksStore struct {
+	db *sql.DB
+}
+
+// Block records that blockerID blocked blockedID and drops every follow
+// relationship and pending follow request between the two.
+func (s *BlocksStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	if blockerID == blockedID {
+		return ErrConflict
+	}
+
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)`, blockerID, blockedID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok {
+				switch pqErr.Code {
+				case "23505":
+					return ErrConflict
+				case "23503":
+					return ErrNotFound
+				}
+			}
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+		DELETE FROM followers
+		WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)`,
+			blockerID, blockedID); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		DELETE FROM follow_requests
+		WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)`,
+			blockerID, blockedID)
+		return err
+	})
+}
+
+// Unblock lifts the block of blockedID, failing with ErrNotFound when there
+// is none.
+func (s *BlocksStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+
+	return deleteRelation(ctx, s.db, query, blockerID, blockedID)
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func (s *BlocksStore) IsBlocked(ctx context.Context, a, b int64) (bool, error) {
+	return isBlocked(ctx, s.db, a, b)
+}
+
+func (s *BlocksStore) GetBlocked(ctx context.Context, userID int64, pq PaginationQuery) ([]BlockedUser, error) {
+	query := `
+	SELECT u.id, u.username, b.created_at
+	FROM user_blocks b
+	JOIN users u ON u.id = b.blocked_id
+	WHERE b.blocker_id = $1
+	ORDER BY b.created_at DESC, u.id DESC
+	LIMIT $2 OFFSET $3`
+
+	return listBlockedUsers(ctx, s.db, query, userID, pq)
+}
+
+type MutesStore struct {
+	db *sql.DB
+}
+
+func (s *MutesStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	if muterID == mutedID {
+		return ErrConflict
+	}
+
+	query := `INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterID, mutedID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505":
+				return ErrConflict
+			case "23503":
+				return ErrNotFound
+			}
+		}
+	}
+	return err
+}
+
+// Unmute lifts the mute of mutedID, failing with ErrNotFound when there is
+// none.
+func (s *MutesStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	query := `DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2`
+
+	return deleteRelation(ctx, s.db, query, muterID, mutedID)
+}
+
+func deleteRelation(ctx context.Context, db *sql.DB, query string, a, b int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, query, a, b)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MutesStore) GetMuted(ctx context.Context, userID int64, pq PaginationQuery) ([]BlockedUser, error) {
+	query := `
+	SELECT u.id, u.username, m.created_at
+	FROM user_mutes m
+	JOIN users u ON u.id = m.muted_id
+	WHERE m.muter_id = $1
+	ORDER BY m.created_at DESC, u.id DESC
+	LIMIT $2 OFFSET $3`
+
+	return listBlockedUsers(ctx, s.db, query, userID, pq)
+}
+
+func listBlockedUsers(ctx context.Context, db *sql.DB, query string, userID int64, pq PaginationQuery) ([]BlockedUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, userID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []BlockedUser{}
+	for rows.Next() {
+		var u BlockedUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
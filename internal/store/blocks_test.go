@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	blocker := newTestUser(t, db, "user")
+	blocked := newTestUser(t, db, "user")
+	bystander := newTestUser(t, db, "user")
+	for _, f := range [][2]int64{{blocker, blocked}, {blocked, blocker}, {bystander, blocker}} {
+		if _, err := s.Followers.Follow(ctx, f[0], f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	post := newTestPost(t, db, blocker)
+
+	t.Run("should block once and drop follows both ways", func(t *testing.T) {
+		checkErr(t, nil, s.Blocks.Block(ctx, blocker, blocked))
+		checkErr(t, ErrConflict, s.Blocks.Block(ctx, blocker, blocked))
+		checkErr(t, ErrConflict, s.Blocks.Block(ctx, blocker, blocker))
+		checkErr(t, ErrNotFound, s.Blocks.Block(ctx, blocker, blocker+1000000))
+
+		rel, err := s.Followers.GetRelationship(ctx, blocked, blocker)
+		checkErr(t, nil, err)
+		if rel.Following || rel.FollowedBy {
+			t.Errorf("expected no follows left, got %+v", rel)
+		}
+		_, err = s.Followers.Follow(ctx, blocked, blocker)
+		checkErr(t, ErrBlocked, err)
+	})
+
+	t.Run("should hide blocked users from each other", func(t *testing.T) {
+		isBlocked, err := s.Blocks.IsBlocked(ctx, blocked, blocker)
+		checkErr(t, nil, err)
+		if !isBlocked {
+			t.Error("expected the block to apply both ways")
+		}
+
+		followers, err := s.Followers.GetFollowers(ctx, blocker, blocked, PaginationQuery{Limit: 10})
+		checkErr(t, nil, err)
+		if len(followers) != 0 {
+			t.Errorf("expected the blocked user to see no followers, got %d", len(followers))
+		}
+		followers, err = s.Followers.GetFollowers(ctx, blocker, bystander, PaginationQuery{Limit: 10})
+		checkErr(t, nil, err)
+		if len(followers) != 1 {
+			t.Errorf("expected others to see 1 follower, got %d", len(followers))
+		}
+
+		posts, err := s.Posts.GetByIDs(ctx, blocked, []int64{post})
+		checkErr(t, nil, err)
+		if len(posts) != 0 {
+			t.Errorf("expected the blocked user to see no posts, got %d", len(posts))
+		}
+	})
+
+	t.Run("should only unblock existing blocks", func(t *testing.T) {
+		checkErr(t, nil, s.Blocks.Unblock(ctx, blocker, blocked))
+		checkErr(t, ErrNotFound, s.Blocks.Unblock(ctx, blocker, blocked))
+	})
+}
+
+func TestMutes(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	muter := newTestUser(t, db, "user")
+	muted := newTestUser(t, db, "user")
+	author := newTestUser(t, db, "user")
+	post := newTestPost(t, db, author)
+	mustExec(t, db, `INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, 'hi')`, post, muted)
+
+	t.Run("should mute once", func(t *testing.T) {
+		checkErr(t, nil, s.Mutes.Mute(ctx, muter, muted))
+		checkErr(t, ErrConflict, s.Mutes.Mute(ctx, muter, muted))
+		checkErr(t, ErrConflict, s.Mutes.Mute(ctx, muter, muter))
+	})
+
+	t.Run("should hide the comments of muted users from the muter only", func(t *testing.T) {
+		for viewer, want := range map[int64]int{muter: 0, author: 1} {
+			comments, err := s.Comments.GetByPostID(ctx, post, viewer)
+			checkErr(t, nil, err)
+			if len(comments) != want {
+				t.Errorf("expected user %d to see %d comments, got %d", viewer, want, len(comments))
+			}
+		}
+	})
+
+	t.Run("should only unmute existing mutes", func(t *testing.T) {
+		checkErr(t, nil, s.Mutes.Unmute(ctx, muter, muted))
+		checkErr(t, ErrNotFound, s.Mutes.Unmute(ctx, muter, muted))
+	})
+}
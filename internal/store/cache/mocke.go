@@ -7,7 +7,9 @@ import (
 
 func NewMockCacheStorage() Storage {
 	return Storage{
-		Users: MockUserStorage{},
+		Users:     MockUserStorage{},
+		Trending:  NewMemoryTrendingStore(),
+		Timelines: MockTimelineStorage{},
 	}
 }
 
@@ -20,3 +22,24 @@ func (m MockUserStorage) Get(ctx context.Context, id int64) (*store.User, error)
 func (m MockUserStorage) Set(ctx context.Context, user *store.User) error {
 	return nil
 }
+
+func (m MockUserStorage) Delete(ctx context.Context, id int64) {}
+
+// MockTimelineStorage never has a timeline cached.
+type MockTimelineStorage struct{}
+
+func (m MockTimelineStorage) Push(ctx context.Context, userIDs []int64, postID int64) error {
+	return nil
+}
+
+func (m MockTimelineStorage) Fill(ctx context.Context, userID int64, postIDs []int64, complete bool) error {
+	return nil
+}
+
+func (m MockTimelineStorage) Range(ctx context.Context, userID, beforeID int64, count int) ([]int64, bool, bool, error) {
+	return nil, false, false, nil
+}
+
+func (m MockTimelineStorage) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
@@ -10,11 +10,26 @@ type Storage struct {
 	Users interface {
 		Get(context.Context, int64) (*store.User, error)
 		Set(context.Context, *store.User) error
+		Delete(context.Context, int64)
+	}
+	Trending interface {
+		SetTags(context.Context, string, []store.TrendingTag) error
+		GetTags(context.Context, string, int) ([]store.TrendingTag, error)
+		SetPosts(context.Context, string, []store.TrendingPost) error
+		GetPosts(context.Context, string, int) ([]store.TrendingPost, error)
+	}
+	Timelines interface {
+		Push(context.Context, []int64, int64) error
+		Fill(context.Context, int64, []int64, bool) error
+		Range(context.Context, int64, int64, int) ([]int64, bool, bool, error)
+		Delete(context.Context, int64) error
 	}
 }
 
 func NewRedisStorage(cacheRedis *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{cacheRedis: cacheRedis},
+		Users:     &UserStore{cacheRedis: cacheRedis},
+		Trending:  &TrendingStore{cacheRedis: cacheRedis},
+		Timelines: &TimelineStore{cacheRedis: cacheRedis},
 	}
 }
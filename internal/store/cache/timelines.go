@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TimelineSize is how many post IDs a cached timeline keeps.
+	TimelineSize = 800
+	// TimelineTTL is how long a timeline lives after it was built, so
+	// inactive users do not hold memory forever.
+	TimelineTTL = 7 * 24 * time.Hour
+
+	// timelineEnd is a member scored below every post. It marks timelines
+	// holding every post of the feed rather than only the newest
+	// TimelineSize ones, and goes away as soon as the timeline is trimmed.
+	timelineEnd = "end"
+)
+
+// TimelineStore caches the home feed of each user as a sorted set of post
+// IDs scored by the ID itself, newest last.
+type TimelineStore struct {
+	cacheRedis *redis.Client
+}
+
+// pushSource adds a post to a timeline and trims it, but only if the
+// timeline is cached: building one from a single post would hide the rest
+// of the feed.
+const pushSource = `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[1])
+	redis.call('ZREMRANGEBYRANK', KEYS[1], 0, -(tonumber(ARGV[2]) + 1))
+end
+return 0`
+
+var pushScript = redis.NewScript(pushSource)
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline:%d", userID)
+}
+
+// Push adds postID to the cached timelines of userIDs. The script is called
+// by its hash; when Redis does not know it yet, as after a restart, the
+// batch is sent again with the script itself, which also caches it.
+func (s *TimelineStore) Push(ctx context.Context, userIDs []int64, postID int64) error {
+	err := s.push(ctx, userIDs, postID, false)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		err = s.push(ctx, userIDs, postID, true)
+	}
+	return err
+}
+
+func (s *TimelineStore) push(ctx context.Context, userIDs []int64, postID int64, withSource bool) error {
+	pipe := s.cacheRedis.Pipeline()
+	for _, id := range userIDs {
+		keys := []string{timelineKey(id)}
+		if withSource {
+			pipe.Eval(ctx, pushSource, keys, postID, TimelineSize)
+		} else {
+			pipe.EvalSha(ctx, pushScript.Hash(), keys, postID, TimelineSize)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
+
+// Fill replaces the timeline of userID with postIDs. complete tells that
+// postIDs is the whole feed, so readers need not look past its end.
+func (s *TimelineStore) Fill(ctx context.Context, userID int64, postIDs []int64, complete bool) error {
+	key := timelineKey(userID)
+	_, err := s.cacheRedis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		members := make([]*redis.Z, 0, len(postIDs)+1)
+		for _, id := range postIDs {
+			members = append(members, &redis.Z{Score: float64(id), Member: id})
+		}
+		if complete {
+			members = append(members, &redis.Z{Score: 0, Member: timelineEnd})
+		}
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, key, members...)
+			pipe.Expire(ctx, key, TimelineTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// Range returns up to count post IDs of the timeline of userID below
+// beforeID, newest first; beforeID 0 starts at the newest post. found is
+// false when the timeline is not cached, and complete when nothing older
+// than the returned IDs exists in the feed.
+func (s *TimelineStore) Range(ctx context.Context, userID, beforeID int64, count int) (ids []int64, complete, found bool, err error) {
+	key := timelineKey(userID)
+	max := "+inf"
+	if beforeID > 0 {
+		max = "(" + strconv.FormatInt(beforeID, 10)
+	}
+
+	pipe := s.cacheRedis.Pipeline()
+	exists := pipe.Exists(ctx, key)
+	members := pipe.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{Max: max, Min: "(0", Count: int64(count)})
+	end := pipe.ZScore(ctx, key, timelineEnd)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, false, false, err
+	}
+
+	if exists.Val() == 0 {
+		return nil, false, false, nil
+	}
+	for _, m := range members.Val() {
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, false, false, err
+		}
+		ids = append(ids, id)
+	}
+	complete = end.Err() == nil && len(ids) < count
+	return ids, complete, true, nil
+}
+
+// Delete drops the timeline of userID so the next read rebuilds it.
+func (s *TimelineStore) Delete(ctx context.Context, userID int64) error {
+	return s.cacheRedis.Del(ctx, timelineKey(userID)).Err()
+}
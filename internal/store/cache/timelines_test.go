@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"testing"
+)
+
+func TestTimelines(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	timelines := &TimelineStore{cacheRedis: client}
+	ctx := context.Background()
+
+	t.Run("should push to cached timelines only", func(t *testing.T) {
+		if err := timelines.Fill(ctx, 1, []int64{10, 11}, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := timelines.Push(ctx, []int64{1, 2}, 12); err != nil {
+			t.Fatal(err)
+		}
+
+		ids, complete, found, err := timelines.Range(ctx, 1, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || !complete || len(ids) != 3 || ids[0] != 12 {
+			t.Errorf("expected the pushed post on top of the complete timeline, got %v, %t, %t", ids, complete, found)
+		}
+		if _, _, found, _ := timelines.Range(ctx, 2, 0, 10); found {
+			t.Error("expected no timeline to be built from a single post")
+		}
+	})
+
+	t.Run("should load the script again once Redis lost it", func(t *testing.T) {
+		mr.FlushAll()
+		if err := client.ScriptFlush(ctx).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := timelines.Fill(ctx, 1, []int64{10}, false); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := timelines.Push(ctx, []int64{1}, 13); err != nil {
+			t.Fatalf("expected the push to recover from NOSCRIPT, got %v", err)
+		}
+		ids, _, _, err := timelines.Range(ctx, 1, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 2 || ids[0] != 13 {
+			t.Errorf("expected the pushed post, got %v", ids)
+		}
+
+		exists, err := client.ScriptExists(ctx, pushScript.Hash()).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists[0] {
+			t.Error("expected the script to be cached again")
+		}
+	})
+
+	t.Run("should trim timelines", func(t *testing.T) {
+		ids := make([]int64, TimelineSize)
+		for i := range ids {
+			ids[i] = int64(i + 1)
+		}
+		if err := timelines.Fill(ctx, 3, ids, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := timelines.Push(ctx, []int64{3}, int64(TimelineSize+1)); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := mr.Exists("timeline:3"); !n {
+			t.Fatal("expected the timeline to exist")
+		}
+		members, err := client.ZCard(ctx, "timeline:3").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if members != TimelineSize {
+			t.Errorf("expected %d members, got %d", TimelineSize, members)
+		}
+	})
+}
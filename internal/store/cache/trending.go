@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"project/internal/store"
+	"strconv"
+	"sync"
+)
+
+// TrendingStore keeps trending rankings as Redis sorted sets, one per kind
+// and window.
+type TrendingStore struct {
+	cacheRedis *redis.Client
+}
+
+func (s *TrendingStore) SetTags(ctx context.Context, window string, tags []store.TrendingTag) error {
+	members := make([]*redis.Z, len(tags))
+	for i, t := range tags {
+		members[i] = &redis.Z{Score: t.Score, Member: t.Tag}
+	}
+	return s.replace(ctx, "trending:tags:"+window, members)
+}
+
+func (s *TrendingStore) GetTags(ctx context.Context, window string, limit int) ([]store.TrendingTag, error) {
+	zs, err := s.cacheRedis.ZRevRangeWithScores(ctx, "trending:tags:"+window, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]store.TrendingTag, len(zs))
+	for i, z := range zs {
+		tags[i] = store.TrendingTag{Tag: z.Member.(string), Score: z.Score}
+	}
+	return tags, nil
+}
+
+func (s *TrendingStore) SetPosts(ctx context.Context, window string, posts []store.TrendingPost) error {
+	members := make([]*redis.Z, len(posts))
+	for i, p := range posts {
+		members[i] = &redis.Z{Score: p.Score, Member: strconv.FormatInt(p.PostID, 10)}
+	}
+	return s.replace(ctx, "trending:posts:"+window, members)
+}
+
+func (s *TrendingStore) GetPosts(ctx context.Context, window string, limit int) ([]store.TrendingPost, error) {
+	zs, err := s.cacheRedis.ZRevRangeWithScores(ctx, "trending:posts:"+window, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]store.TrendingPost, 0, len(zs))
+	for _, z := range zs {
+		id, err := strconv.ParseInt(z.Member.(string), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, store.TrendingPost{PostID: id, Score: z.Score})
+	}
+	return posts, nil
+}
+
+// replace swaps the sorted set at key for members in one transaction, so
+// readers never see a half written ranking.
+func (s *TrendingStore) replace(ctx context.Context, key string, members []*redis.Z) error {
+	_, err := s.cacheRedis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, key, members...)
+		}
+		return nil
+	})
+	return err
+}
+
+// MemoryTrendingStore keeps trending rankings in process, for deployments
+// running without Redis.
+type MemoryTrendingStore struct {
+	mu    sync.RWMutex
+	tags  map[string][]store.TrendingTag
+	posts map[string][]store.TrendingPost
+}
+
+func NewMemoryTrendingStore() *MemoryTrendingStore {
+	return &MemoryTrendingStore{
+		tags:  map[string][]store.TrendingTag{},
+		posts: map[string][]store.TrendingPost{},
+	}
+}
+
+func (s *MemoryTrendingStore) SetTags(ctx context.Context, window string, tags []store.TrendingTag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tags[window] = tags
+	return nil
+}
+
+func (s *MemoryTrendingStore) GetTags(ctx context.Context, window string, limit int) ([]store.TrendingTag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tags := s.tags[window]
+	return append([]store.TrendingTag{}, tags[:min(limit, len(tags))]...), nil
+}
+
+func (s *MemoryTrendingStore) SetPosts(ctx context.Context, window string, posts []store.TrendingPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts[window] = posts
+	return nil
+}
+
+func (s *MemoryTrendingStore) GetPosts(ctx context.Context, window string, limit int) ([]store.TrendingPost, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	posts := s.posts[window]
+	return append([]store.TrendingPost{}, posts[:min(limit, len(posts))]...), nil
+}
@@ -40,3 +40,8 @@ func (s *UserStore) Set(ctx context.Context, user *store.User) error {
 	}
 	return s.cacheRedis.SetEX(ctx, cacheKey, data, time.Minute).Err()
 }
+
+func (s *UserStore) Delete(ctx context.Context, userID int64) {
+	cacheKey := fmt.Sprintf("user:%d", userID)
+	s.cacheRedis.Del(ctx, cacheKey)
+}
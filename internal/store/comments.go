@@ -18,14 +18,18 @@ type Comment struct {
 	User      User   `json:"user"`
 }
 
-func (s *CommentsStore) GetByPostID(ctx context.Context, postId int64) ([]Comment, error) {
+// GetByPostID lists the comments of a post, leaving out hidden comments and
+// authors that the viewer muted or that are blocked in either direction.
+func (s *CommentsStore) GetByPostID(ctx context.Context, postId, viewerID int64) ([]Comment, error) {
 	query := `SELECT c.id, c.post_id, c.user_id, c."content", c.created_at, users.username, users.id FROM comments c
 				JOIN users on users.id = c.user_id
-				WHERE c.id = $1
+				WHERE c.post_id = $1 AND c.hidden_at IS NULL AND
+					` + notBlockedSQL("c.user_id", "$2") + ` AND
+					` + notMutedSQL("c.user_id", "$2") + `
 				ORDER BY c.created_at DESC;`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, query, postId)
+	rows, err := s.db.QueryContext(ctx, query, postId, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -44,20 +48,56 @@ func (s *CommentsStore) GetByPostID(ctx context.Context, postId int64) ([]Commen
 	return comments, nil
 }
 
-func (s *CommentsStore) Create(ctx context.Context, comment *Comment) error {
-	query := `
-	INSERT INTO comments (post_id, user_id, content)
-	VALUES ($1, $2, $3) RETURNING id, created_at;`
+// GetParticipantIDs lists the users that commented on a post.
+func (s *CommentsStore) GetParticipantIDs(ctx context.Context, postID int64) ([]int64, error) {
+	query := `SELECT DISTINCT user_id FROM comments WHERE post_id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query,
-		comment.PostID, comment.UserID, comment.Content).Scan(
-		&comment.ID,
-		&comment.CreatedAt)
+	rows, err := s.db.QueryContext(ctx, query, postID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
 	}
-	return nil
+	return ids, rows.Err()
+}
+
+// Create adds a comment. Users that blocked each other cannot comment on
+// each other's posts.
+func (s *CommentsStore) Create(ctx context.Context, comment *Comment) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		authorID, err := postAuthor(ctx, tx, comment.PostID)
+		if err != nil {
+			return err
+		}
+		blocked, err := isBlocked(ctx, tx, comment.UserID, authorID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		query := `
+		INSERT INTO comments (post_id, user_id, content)
+		VALUES ($1, $2, $3) RETURNING id, created_at;`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		return tx.QueryRowContext(ctx, query,
+			comment.PostID, comment.UserID, comment.Content).Scan(
+			&comment.ID,
+			&comment.CreatedAt)
+	})
 }
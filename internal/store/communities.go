@@ -0,0 +1,387 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+)
+
+var ErrInviteOnly = errors.New("community is invite only")
+
+const (
+	CommunityRoleOwner     = "owner"
+	CommunityRoleModerator = "moderator"
+	CommunityRoleMember    = "member"
+)
+
+// Community members are either active, holding their role, or waiting:
+// pending members asked to join and invited ones were asked to.
+const (
+	MemberActive  = "active"
+	MemberPending = "pending"
+	MemberInvited = "invited"
+)
+
+var communityRoleLevels = map[string]int{
+	CommunityRoleMember:    1,
+	CommunityRoleModerator: 2,
+	CommunityRoleOwner:     3,
+}
+
+type Community struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	JoinPolicy   string `json:"join_policy"`
+	CreatedBy    *int64 `json:"created_by"`
+	MembersCount int64  `json:"members_count"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+type CommunityMember struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Status   string `json:"status"`
+	JoinedAt string `json:"joined_at"`
+}
+
+// HasRole reports whether the member is active and holds role or a higher
+// one. A nil member, who is not in the community, holds no role.
+func (m *CommunityMember) HasRole(role string) bool {
+	return m != nil && m.Status == MemberActive && communityRoleLevels[m.Role] >= communityRoleLevels[role]
+}
+
+// Outranks reports whether the member holds a higher role than other. Users
+// who are not active members hold no role.
+func (m *CommunityMember) Outranks(other *CommunityMember) bool {
+	return m.level() > other.level()
+}
+
+func (m *CommunityMember) level() int {
+	if m == nil || m.Status != MemberActive {
+		return 0
+	}
+	return communityRoleLevels[m.Role]
+}
+
+type CommunitiesStore struct {
+	db *sql.DB
+}
+
+// Create inserts the community and makes its creator its owner.
+func (s *CommunitiesStore) Create(ctx context.Context, c *Community) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := `
+		INSERT INTO communities (name, description, join_policy, created_by)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, c.Name, c.Description, c.JoinPolicy, c.CreatedBy).Scan(
+			&c.ID, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO community_members (community_id, user_id, role) VALUES ($1, $2, $3)`,
+			c.ID, c.CreatedBy, CommunityRoleOwner)
+		if err != nil {
+			return err
+		}
+		c.MembersCount = 1
+		return nil
+	})
+}
+
+const communityColumns = `c.id, c.name, c.description, c.join_policy, c.created_by, c.created_at, c.updated_at,
+	(SELECT COUNT(*) FROM community_members cm WHERE cm.community_id = c.id AND cm.status = 'active')`
+
+func scanCommunity(row interface{ Scan(...any) error }, c *Community) error {
+	return row.Scan(&c.ID, &c.Name, &c.Description, &c.JoinPolicy, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt,
+		&c.MembersCount)
+}
+
+func (s *CommunitiesStore) GetByID(ctx context.Context, id int64) (*Community, error) {
+	query := `SELECT ` + communityColumns + ` FROM communities c WHERE c.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var c Community
+	if err := scanCommunity(s.db.QueryRowContext(ctx, query, id), &c); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetAll returns communities whose name contains search, largest first.
+func (s *CommunitiesStore) GetAll(ctx context.Context, search string, pq PaginationQuery) ([]Community, error) {
+	query := `
+	SELECT * FROM (
+		SELECT ` + communityColumns + ` AS members_count
+		FROM communities c
+		WHERE $1 = '' OR c.name ILIKE '%' || $1 || '%'
+	) c
+	ORDER BY c.members_count DESC, c.id DESC
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, search, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	communities := []Community{}
+	for rows.Next() {
+		var c Community
+		if err := scanCommunity(rows, &c); err != nil {
+			return nil, err
+		}
+		communities = append(communities, c)
+	}
+	return communities, rows.Err()
+}
+
+// Update saves the name, description and join policy of a community.
+func (s *CommunitiesStore) Update(ctx context.Context, c *Community) error {
+	query := `
+	UPDATE communities SET name = $2, description = $3, join_policy = $4, updated_at = NOW()
+	WHERE id = $1
+	RETURNING updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, c.ID, c.Name, c.Description, c.JoinPolicy).Scan(&c.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a community along with its memberships and posts.
+func (s *CommunitiesStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM communities WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetMember returns the membership of userID in a community, whatever its
+// status.
+func (s *CommunitiesStore) GetMember(ctx context.Context, communityID, userID int64) (*CommunityMember, error) {
+	query := `
+	SELECT u.id, u.username, cm.role, cm.status, cm.created_at
+	FROM community_members cm
+	JOIN users u ON u.id = cm.user_id
+	WHERE cm.community_id = $1 AND cm.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var m CommunityMember
+	err := s.db.QueryRowContext(ctx, query, communityID, userID).Scan(&m.ID, &m.Username, &m.Role, &m.Status, &m.JoinedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetMembers returns the members of a community with the given status,
+// owners and moderators first.
+func (s *CommunitiesStore) GetMembers(ctx context.Context, communityID int64, status string, pq PaginationQuery) ([]CommunityMember, error) {
+	query := `
+	SELECT u.id, u.username, cm.role, cm.status, cm.created_at
+	FROM community_members cm
+	JOIN users u ON u.id = cm.user_id
+	WHERE cm.community_id = $1 AND cm.status = $2
+	ORDER BY CASE cm.role WHEN 'owner' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END, cm.created_at, u.id
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, communityID, status, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []CommunityMember{}
+	for rows.Next() {
+		var m CommunityMember
+		if err := rows.Scan(&m.ID, &m.Username, &m.Role, &m.Status, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// Join makes userID a member of a community as its join policy allows and
+// returns the resulting status: invited users and anyone joining an open
+// community become active, others wait for approval. Joining an
+// invite-only community uninvited fails with ErrInviteOnly.
+func (s *CommunitiesStore) Join(ctx context.Context, communityID, userID int64) (string, error) {
+	var status string
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		var policy string
+		err := tx.QueryRowContext(ctx,
+			`SELECT join_policy FROM communities WHERE id = $1 FOR SHARE`, communityID).Scan(&policy)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		var current string
+		err = tx.QueryRowContext(ctx,
+			`SELECT status FROM community_members WHERE community_id = $1 AND user_id = $2 FOR UPDATE`,
+			communityID, userID).Scan(&current)
+		switch {
+		case err == nil:
+			status = current
+			if current != MemberInvited {
+				return nil
+			}
+			status = MemberActive
+			_, err = tx.ExecContext(ctx,
+				`UPDATE community_members SET status = $3, created_at = NOW() WHERE community_id = $1 AND user_id = $2`,
+				communityID, userID, status)
+			return err
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+
+		switch policy {
+		case "open":
+			status = MemberActive
+		case "approval":
+			status = MemberPending
+		default:
+			return ErrInviteOnly
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO community_members (community_id, user_id, status) VALUES ($1, $2, $3)`,
+			communityID, userID, status)
+		return err
+	})
+	return status, err
+}
+
+// Invite invites userID to a community. Inviting someone who asked to join
+// admits them, and inviting a member has no effect.
+func (s *CommunitiesStore) Invite(ctx context.Context, communityID, userID int64) (string, error) {
+	query := `
+	INSERT INTO community_members (community_id, user_id, status) VALUES ($1, $2, 'invited')
+	ON CONFLICT (community_id, user_id) DO UPDATE
+		SET status = CASE WHEN community_members.status = 'pending' THEN 'active' ELSE community_members.status END
+	RETURNING status`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var status string
+	err := s.db.QueryRowContext(ctx, query, communityID, userID).Scan(&status)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return status, nil
+}
+
+// Approve admits a user who asked to join a community.
+func (s *CommunitiesStore) Approve(ctx context.Context, communityID, userID int64) error {
+	query := `
+	UPDATE community_members SET status = 'active', created_at = NOW()
+	WHERE community_id = $1 AND user_id = $2 AND status = 'pending'`
+
+	return s.execMember(ctx, query, communityID, userID)
+}
+
+// RemoveMember removes a member, a request to join or an invitation.
+// Owners cannot be removed.
+func (s *CommunitiesStore) RemoveMember(ctx context.Context, communityID, userID int64) error {
+	query := `
+	DELETE FROM community_members
+	WHERE community_id = $1 AND user_id = $2 AND role <> 'owner'`
+
+	return s.execMember(ctx, query, communityID, userID)
+}
+
+// SetRole makes an active member a moderator or a plain member again.
+func (s *CommunitiesStore) SetRole(ctx context.Context, communityID, userID int64, role string) error {
+	query := `
+	UPDATE community_members SET role = $3
+	WHERE community_id = $1 AND user_id = $2 AND status = 'active' AND role <> 'owner'`
+
+	return s.execMember(ctx, query, communityID, userID, role)
+}
+
+func (s *CommunitiesStore) execMember(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetFeed returns a page of the posts of a community as seen by viewerID,
+// with the same filters, cursors and visibility rules as GetUserFeed. The
+// caller checks that the viewer may read the community.
+func (s *CommunitiesStore) GetFeed(ctx context.Context, communityID, viewerID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	scope := `p.community_id = $8`
+	return queryFeed(ctx, s.db, viewerID, scope, fq, communityID)
+}
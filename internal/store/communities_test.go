@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestCommunityJoinPolicies(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	owner := newTestUser(t, db, "user")
+	var created int
+	newCommunity := func(policy string) int64 {
+		t.Helper()
+		created++
+		c := &Community{Name: fmt.Sprintf("%s-%d-%d", policy, owner, created), JoinPolicy: policy, CreatedBy: &owner}
+		checkErr(t, nil, s.Communities.Create(ctx, c))
+		return c.ID
+	}
+	join := func(communityID, userID int64, want string) {
+		t.Helper()
+		status, err := s.Communities.Join(ctx, communityID, userID)
+		checkErr(t, nil, err)
+		if status != want {
+			t.Errorf("expected status %q, got %q", want, status)
+		}
+	}
+
+	t.Run("should let anyone in open communities", func(t *testing.T) {
+		open := newCommunity("open")
+		user := newTestUser(t, db, "user")
+		join(open, user, MemberActive)
+		join(open, user, MemberActive)
+
+		c, err := s.Communities.GetByID(ctx, open)
+		checkErr(t, nil, err)
+		if c.MembersCount != 2 {
+			t.Errorf("expected 2 members, got %d", c.MembersCount)
+		}
+	})
+
+	t.Run("should hold requests until approved", func(t *testing.T) {
+		approval := newCommunity("approval")
+		user := newTestUser(t, db, "user")
+		join(approval, user, MemberPending)
+		join(approval, user, MemberPending)
+
+		checkErr(t, nil, s.Communities.Approve(ctx, approval, user))
+		checkErr(t, ErrNotFound, s.Communities.Approve(ctx, approval, user))
+		m, err := s.Communities.GetMember(ctx, approval, user)
+		checkErr(t, nil, err)
+		if !m.HasRole(CommunityRoleMember) {
+			t.Errorf("expected an active member, got %+v", m)
+		}
+	})
+
+	t.Run("should only let invited users in invite-only communities", func(t *testing.T) {
+		invite := newCommunity("invite")
+		user := newTestUser(t, db, "user")
+		_, err := s.Communities.Join(ctx, invite, user)
+		checkErr(t, ErrInviteOnly, err)
+
+		status, err := s.Communities.Invite(ctx, invite, user)
+		checkErr(t, nil, err)
+		if status != MemberInvited {
+			t.Errorf("expected an invitation, got %q", status)
+		}
+		join(invite, user, MemberActive)
+	})
+
+	t.Run("should admit requests on invitation", func(t *testing.T) {
+		approval := newCommunity("approval")
+		user := newTestUser(t, db, "user")
+		join(approval, user, MemberPending)
+
+		status, err := s.Communities.Invite(ctx, approval, user)
+		checkErr(t, nil, err)
+		if status != MemberActive {
+			t.Errorf("expected the request to be admitted, got %q", status)
+		}
+	})
+
+	t.Run("should keep owners", func(t *testing.T) {
+		open := newCommunity("open")
+		checkErr(t, ErrNotFound, s.Communities.RemoveMember(ctx, open, owner))
+		checkErr(t, ErrNotFound, s.Communities.SetRole(ctx, open, owner, CommunityRoleMember))
+	})
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+type DigestRecipient struct {
+	UserID   int64
+	Username string
+	Email    string
+}
+
+// DigestContent is the activity a digest reports: unread notifications
+// counted by type, and the most engaging posts of followed users.
+type DigestContent struct {
+	Notifications map[string]int
+	Posts         []DigestPost
+}
+
+type DigestPost struct {
+	ID        int64
+	Title     string
+	Username  string
+	Reactions int
+	Comments  int
+}
+
+func (c *DigestContent) Empty() bool {
+	return len(c.Notifications) == 0 && len(c.Posts) == 0
+}
+
+type DigestsStore struct {
+	db *sql.DB
+}
+
+// GetFrequency returns how often the user gets digests, "off" unless they
+// subscribed.
+func (s *DigestsStore) GetFrequency(ctx context.Context, userID int64) (string, error) {
+	query := `SELECT frequency FROM digest_subscriptions WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var frequency string
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&frequency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "off", nil
+	}
+	return frequency, err
+}
+
+func (s *DigestsStore) SetFrequency(ctx context.Context, userID int64, frequency string) error {
+	query := `
+	INSERT INTO digest_subscriptions (user_id, frequency) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET frequency = EXCLUDED.frequency, updated_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, frequency)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+		return ErrNotFound
+	}
+	return err
+}
+
+// GetDue returns up to limit active users subscribed at frequency whose
+// digest for the period starting at periodStart was not claimed yet.
+func (s *DigestsStore) GetDue(ctx context.Context, frequency string, periodStart time.Time, limit int) ([]DigestRecipient, error) {
+	query := `
+	SELECT u.id, u.username, u.email
+	FROM digest_subscriptions ds
+	JOIN users u ON u.id = ds.user_id
+	WHERE ds.frequency = $1 AND u.is_active AND u.deletion_scheduled_at IS NULL AND
+		NOT EXISTS (
+			SELECT 1 FROM digest_deliveries dd
+			WHERE dd.user_id = ds.user_id AND dd.period_start = $2)
+	ORDER BY u.id
+	LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, frequency, periodStart, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []DigestRecipient{}
+	for rows.Next() {
+		var r DigestRecipient
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Email); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// Claim reserves the digest of a user for the period starting at
+// periodStart. It reports false when the digest was already claimed, in
+// which case it must not be sent.
+func (s *DigestsStore) Claim(ctx context.Context, userID int64, periodStart time.Time) (bool, error) {
+	query := `
+	INSERT INTO digest_deliveries (user_id, period_start) VALUES ($1, $2)
+	ON CONFLICT (user_id, period_start) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, periodStart)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *DigestsStore) MarkSent(ctx context.Context, userID int64, periodStart time.Time) error {
+	query := `UPDATE digest_deliveries SET sent_at = NOW() WHERE user_id = $1 AND period_start = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, periodStart)
+	return err
+}
+
+// GetContent collects the activity of a user between from and to.
+func (s *DigestsStore) GetContent(ctx context.Context, userID int64, from, to time.Time, topPosts int) (*DigestContent, error) {
+	content := &DigestContent{Notifications: map[string]int{}}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	query := `
+	SELECT n.type, count(*)
+	FROM notifications n
+	WHERE n.user_id = $1 AND n.read_at IS NULL AND n.created_at >= $2 AND n.created_at < $3 AND
+		(n.actor_id IS NULL OR (
+			` + notBlockedSQL("n.actor_id", "$1") + ` AND
+			` + notMutedSQL("n.actor_id", "$1") + `))
+	GROUP BY n.type`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t string
+		var count int
+		if err := rows.Scan(&t, &count); err != nil {
+			return nil, err
+		}
+		content.Notifications[t] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT id, title, username, reactions, comments FROM (
+		SELECT p.id, p.title, u.username,
+			(SELECT count(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions,
+			(SELECT count(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.user_id IN (SELECT f.user_id FROM followers f WHERE f.follower_id = $1) AND
+			p.created_at >= $2 AND p.created_at < $3 AND p.hidden_at IS NULL AND
+			` + notBlockedSQL("p.user_id", "$1") + ` AND
+			` + notMutedSQL("p.user_id", "$1") + `
+	) t
+	ORDER BY reactions + comments DESC, id DESC
+	LIMIT $4`
+
+	rows, err = s.db.QueryContext(ctx, query, userID, from, to, topPosts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p DigestPost
+		if err := rows.Scan(&p.ID, &p.Title, &p.Username, &p.Reactions, &p.Comments); err != nil {
+			return nil, err
+		}
+		content.Posts = append(content.Posts, p)
+	}
+	return content, rows.Err()
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+)
+
+// UserExport is everything stored about a user, as handed out on data
+// export requests: their posts with the files attached to them, their
+// comments on any post, and the metadata of all their uploads, attached or
+// not. Comments others left on the user's posts belong to their authors and
+// are left out.
+type UserExport struct {
+	Profile   *User
+	Posts     []Post
+	Comments  []Comment
+	Followers []Follower
+	Following []Follower
+	Reactions []Reaction
+	Blocks    []BlockedUser
+	Mutes     []BlockedUser
+	Media     []Media
+}
+
+type ExportStore struct {
+	db *sql.DB
+}
+
+func (s *ExportStore) Export(ctx context.Context, userID int64) (*UserExport, error) {
+	export := &UserExport{}
+	users := &UsersStore{s.db}
+
+	var err error
+	if export.Profile, err = users.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	if export.Posts, err = s.posts(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.attachments(ctx, userID, export.Posts); err != nil {
+		return nil, err
+	}
+	if export.Comments, err = s.comments(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Followers, err = s.followers(ctx,
+		`SELECT user_id, follower_id, created_at FROM followers WHERE user_id = $1 ORDER BY created_at`, userID); err != nil {
+		return nil, err
+	}
+	if export.Following, err = s.followers(ctx,
+		`SELECT user_id, follower_id, created_at FROM followers WHERE follower_id = $1 ORDER BY created_at`, userID); err != nil {
+		return nil, err
+	}
+	if export.Reactions, err = s.reactions(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	all := PaginationQuery{Limit: 1 << 30}
+	if export.Blocks, err = (&BlocksStore{s.db}).GetBlocked(ctx, userID, all); err != nil {
+		return nil, err
+	}
+	if export.Mutes, err = (&MutesStore{s.db}).GetMuted(ctx, userID, all); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, user_id, storage_key, thumbnail_key, content_type, size_bytes, width, height, created_at
+	FROM media WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if export.Media, err = scanMedia(rows); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (s *ExportStore) posts(ctx context.Context, userID int64) ([]Post, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, user_id, title, content, tags, version, created_at, updated_at
+	FROM posts WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(&p.ID, &p.UserId, &p.Title, &p.Content, pq.Array(&p.Tags),
+			&p.Version, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// attachments sets the attachments of posts, which are the posts of userID
+// ordered by ID.
+func (s *ExportStore) attachments(ctx context.Context, userID int64, posts []Post) error {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT pa.post_id, m.id, m.user_id, m.storage_key, m.thumbnail_key, m.content_type, m.size_bytes, m.width, m.height, m.created_at
+	FROM post_attachments pa
+	JOIN posts p ON p.id = pa.post_id
+	JOIN media m ON m.id = pa.media_id
+	WHERE p.user_id = $1
+	ORDER BY pa.post_id, pa.position`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	i := 0
+	for rows.Next() {
+		var postID int64
+		var m Media
+		err := rows.Scan(&postID, &m.ID, &m.UserID, &m.Key, &m.ThumbnailKey, &m.ContentType,
+			&m.Size, &m.Width, &m.Height, &m.CreatedAt)
+		if err != nil {
+			return err
+		}
+		for i < len(posts) && posts[i].ID < postID {
+			i++
+		}
+		if i < len(posts) && posts[i].ID == postID {
+			posts[i].Attachments = append(posts[i].Attachments, m)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *ExportStore) comments(ctx context.Context, userID int64) ([]Comment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT id, post_id, user_id, content, created_at
+	FROM comments WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (s *ExportStore) followers(ctx context.Context, query string, userID int64) ([]Follower, error) {
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	followers := []Follower{}
+	for rows.Next() {
+		var f Follower
+		if err := rows.Scan(&f.UserID, &f.FollowerID, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		followers = append(followers, f)
+	}
+	return followers, rows.Err()
+}
+
+func (s *ExportStore) reactions(ctx context.Context, userID int64) ([]Reaction, error) {
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT post_id, user_id, kind, created_at
+	FROM post_reactions WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := []Reaction{}
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.PostID, &r.UserID, &r.Kind, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
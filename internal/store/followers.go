@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/lib/pq"
 )
 
@@ -16,34 +17,258 @@ type FollowerStore struct {
 	db *sql.DB
 }
 
-func (s *FollowerStore) Follow(ctx context.Context, followerID int64, userId int64) error {
+type FollowStatus string
+
+const (
+	FollowStatusFollowing FollowStatus = "following"
+	FollowStatusPending   FollowStatus = "pending"
+)
+
+type FollowRequest struct {
+	RequesterID int64  `json:"requester_id"`
+	Username    string `json:"username"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// Follow makes followerID follow userID. Following a private account only
+// records a pending request that the account owner has to approve.
+func (s *FollowerStore) Follow(ctx context.Context, followerID int64, userId int64) (FollowStatus, error) {
+	if followerID == userId {
+		return "", ErrConflict
+	}
+
+	var status FollowStatus
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		var isPrivate bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT is_private FROM users WHERE id = $1 AND is_active = true`, userId).Scan(&isPrivate)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		blocked, err := isBlocked(ctx, tx, followerID, userId)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
+		status = FollowStatusFollowing
+		if isPrivate {
+			// An existing follower must not end up with a pending request too.
+			var following bool
+			err := tx.QueryRowContext(ctx,
+				`SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`,
+				userId, followerID).Scan(&following)
+			if err != nil {
+				return err
+			}
+			if following {
+				return ErrConflict
+			}
+
+			query = `INSERT INTO follow_requests (user_id, requester_id) VALUES ($1, $2)`
+			status = FollowStatusPending
+		}
+
+		_, err = tx.ExecContext(ctx, query, userId, followerID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && (pqErr.Code == "23505" || pqErr.Code == "23503") {
+				return ErrConflict
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// Unfollow removes the follow relationship, or withdraws a pending request.
+func (s *FollowerStore) Unfollow(ctx context.Context, followerID int64, userId int64) error {
 	if followerID == userId {
 		return ErrConflict
 	}
-	query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
+
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`, userId, followerID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`, userId, followerID)
+		return err
+	})
+}
+
+// GetFollowRequests lists the pending requests to follow userID, oldest first.
+func (s *FollowerStore) GetFollowRequests(ctx context.Context, userID int64, pq PaginationQuery) ([]FollowRequest, error) {
+	query := `
+	SELECT fr.requester_id, u.username, fr.created_at
+	FROM follow_requests fr
+	JOIN users u ON u.id = fr.requester_id
+	WHERE fr.user_id = $1
+	ORDER BY fr.created_at ASC, fr.requester_id ASC
+	LIMIT $2 OFFSET $3`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userId, followerID)
+	rows, err := s.db.QueryContext(ctx, query, userID, pq.Limit, pq.Offset)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && (pqErr.Code == "23505" || pqErr.Code == "23503") {
-			return ErrConflict
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+	for rows.Next() {
+		var fr FollowRequest
+		if err := rows.Scan(&fr.RequesterID, &fr.Username, &fr.CreatedAt); err != nil {
+			return nil, err
 		}
+		requests = append(requests, fr)
 	}
-	return err
+	return requests, rows.Err()
 }
 
-func (s *FollowerStore) Unfollow(ctx context.Context, followerID int64, userId int64) error {
-	if followerID == userId {
-		return ErrConflict
+// ApproveRequest turns the pending request of requesterID into a follow.
+func (s *FollowerStore) ApproveRequest(ctx context.Context, userID, requesterID int64) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := deleteFollowRequest(ctx, tx, userID, requesterID); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, userID, requesterID)
+		return err
+	})
+}
+
+// RejectRequest drops the pending request of requesterID.
+func (s *FollowerStore) RejectRequest(ctx context.Context, userID, requesterID int64) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return deleteFollowRequest(ctx, tx, userID, requesterID)
+	})
+}
+
+func deleteFollowRequest(ctx context.Context, tx *sql.Tx, userID, requesterID int64) error {
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type FollowListItem struct {
+	ID             int64  `json:"id"`
+	Username       string `json:"username"`
+	FollowedAt     string `json:"followed_at"`
+	IsFollowedByMe bool   `json:"is_followed_by_me"`
+}
+
+type Relationship struct {
+	Following  bool `json:"following"`
+	FollowedBy bool `json:"followed_by"`
+	Mutual     bool `json:"mutual"`
+}
 
-	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+// GetFollowers lists the users following userID, newest first. IsFollowedByMe
+// reports whether viewerID follows each listed user. The list is empty when
+// viewerID may not see userID: a private account they do not follow, or
+// one of them blocked the other.
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, pq PaginationQuery) ([]FollowListItem, error) {
+	query := `
+	SELECT u.id, u.username, f.created_at,
+		EXISTS (SELECT 1 FROM followers m WHERE m.user_id = u.id AND m.follower_id = $2)
+	FROM followers f
+	JOIN users o ON o.id = f.user_id
+	JOIN users u ON u.id = f.follower_id
+	WHERE f.user_id = $1 AND ` + visibleAuthorSQL("o.id", "o.is_private", "$2") + `
+	ORDER BY f.created_at DESC, u.id DESC
+	LIMIT $3 OFFSET $4`
 
+	return s.list(ctx, query, userID, viewerID, pq)
+}
+
+// GetFollowing lists the users that userID follows, newest first, as long
+// as viewerID may see userID.
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, pq PaginationQuery) ([]FollowListItem, error) {
+	query := `
+	SELECT u.id, u.username, f.created_at,
+		EXISTS (SELECT 1 FROM followers m WHERE m.user_id = u.id AND m.follower_id = $2)
+	FROM followers f
+	JOIN users o ON o.id = f.follower_id
+	JOIN users u ON u.id = f.user_id
+	WHERE f.follower_id = $1 AND ` + visibleAuthorSQL("o.id", "o.is_private", "$2") + `
+	ORDER BY f.created_at DESC, u.id DESC
+	LIMIT $3 OFFSET $4`
+
+	return s.list(ctx, query, userID, viewerID, pq)
+}
+
+func (s *FollowerStore) list(ctx context.Context, query string, userID, viewerID int64, pq PaginationQuery) ([]FollowListItem, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userId, followerID)
-	return err
+	rows, err := s.db.QueryContext(ctx, query, userID, viewerID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []FollowListItem{}
+	for rows.Next() {
+		var i FollowListItem
+		if err := rows.Scan(&i.ID, &i.Username, &i.FollowedAt, &i.IsFollowedByMe); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+// GetRelationship describes how viewerID and userID follow each other.
+func (s *FollowerStore) GetRelationship(ctx context.Context, viewerID, userID int64) (*Relationship, error) {
+	query := `
+	SELECT
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1),
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rel := &Relationship{}
+	if err := s.db.QueryRowContext(ctx, query, viewerID, userID).Scan(&rel.Following, &rel.FollowedBy); err != nil {
+		return nil, err
+	}
+	rel.Mutual = rel.Following && rel.FollowedBy
+	return rel, nil
 }
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPrivateAccountFollows(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	owner := newTestUser(t, db, "user")
+	follower := newTestUser(t, db, "user")
+	requester := newTestUser(t, db, "user")
+	checkErr(t, nil, s.Users.SetPrivacy(ctx, owner, true))
+
+	t.Run("should only record requests to follow private accounts", func(t *testing.T) {
+		for _, id := range []int64{follower, requester} {
+			status, err := s.Followers.Follow(ctx, id, owner)
+			checkErr(t, nil, err)
+			if status != FollowStatusPending {
+				t.Fatalf("expected a pending follow, got %q", status)
+			}
+		}
+
+		requests, err := s.Followers.GetFollowRequests(ctx, owner, PaginationQuery{Limit: 10})
+		checkErr(t, nil, err)
+		if len(requests) != 2 {
+			t.Fatalf("expected 2 follow requests, got %d", len(requests))
+		}
+	})
+
+	t.Run("should approve and reject requests once", func(t *testing.T) {
+		checkErr(t, nil, s.Followers.ApproveRequest(ctx, owner, follower))
+		checkErr(t, nil, s.Followers.RejectRequest(ctx, owner, requester))
+		checkErr(t, ErrNotFound, s.Followers.RejectRequest(ctx, owner, requester))
+		checkErr(t, ErrNotFound, s.Followers.ApproveRequest(ctx, owner, requester))
+
+		rel, err := s.Followers.GetRelationship(ctx, follower, owner)
+		checkErr(t, nil, err)
+		if !rel.Following {
+			t.Error("expected the approved requester to follow the account")
+		}
+
+		_, err = s.Followers.Follow(ctx, follower, owner)
+		checkErr(t, ErrConflict, err)
+	})
+
+	t.Run("should only list followers of private accounts to followers", func(t *testing.T) {
+		for viewer, want := range map[int64]int{owner: 1, follower: 1, requester: 0} {
+			followers, err := s.Followers.GetFollowers(ctx, owner, viewer, PaginationQuery{Limit: 10})
+			checkErr(t, nil, err)
+			if len(followers) != want {
+				t.Errorf("expected user %d to see %d followers, got %d", viewer, want, len(followers))
+			}
+		}
+
+		following, err := s.Followers.GetFollowing(ctx, follower, requester, PaginationQuery{Limit: 10})
+		checkErr(t, nil, err)
+		if len(following) != 1 {
+			t.Errorf("expected the following list of a public account to be visible, got %d users", len(following))
+		}
+	})
+
+	t.Run("should approve pending requests when going public", func(t *testing.T) {
+		if _, err := s.Followers.Follow(ctx, requester, owner); err != nil {
+			t.Fatal(err)
+		}
+		checkErr(t, nil, s.Users.SetPrivacy(ctx, owner, false))
+
+		rel, err := s.Followers.GetRelationship(ctx, requester, owner)
+		checkErr(t, nil, err)
+		if !rel.Following {
+			t.Error("expected the pending request to be approved")
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+)
+
+// List is a named group of accounts whose posts make up a feed of their
+// own, independent of who the owner follows.
+type List struct {
+	ID           int64  `json:"id"`
+	UserID       int64  `json:"user_id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	IsPrivate    bool   `json:"is_private"`
+	MembersCount int64  `json:"members_count"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+type ListMember struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	AddedAt  string `json:"added_at"`
+}
+
+type ListsStore struct {
+	db *sql.DB
+}
+
+func (s *ListsStore) Create(ctx context.Context, l *List) error {
+	query := `
+	INSERT INTO lists (user_id, name, description, is_private)
+	VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, l.UserID, l.Name, l.Description, l.IsPrivate).Scan(
+		&l.ID, &l.CreatedAt, &l.UpdatedAt)
+}
+
+const listColumns = `l.id, l.user_id, l.name, l.description, l.is_private, l.created_at, l.updated_at,
+	(SELECT COUNT(*) FROM list_members lm WHERE lm.list_id = l.id)`
+
+func scanList(row interface{ Scan(...any) error }, l *List) error {
+	return row.Scan(&l.ID, &l.UserID, &l.Name, &l.Description, &l.IsPrivate, &l.CreatedAt, &l.UpdatedAt,
+		&l.MembersCount)
+}
+
+// GetByID returns a list viewerID may see: a public list whose owner did
+// not block them, or one of their own.
+func (s *ListsStore) GetByID(ctx context.Context, id, viewerID int64) (*List, error) {
+	query := `
+	SELECT ` + listColumns + `
+	FROM lists l
+	WHERE l.id = $1 AND (l.user_id = $2 OR (NOT l.is_private AND ` + notBlockedSQL("l.user_id", "$2") + `))`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var l List
+	if err := scanList(s.db.QueryRowContext(ctx, query, id, viewerID), &l); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetByUserID returns the lists of userID that viewerID may see, newest
+// first.
+func (s *ListsStore) GetByUserID(ctx context.Context, userID, viewerID int64) ([]List, error) {
+	query := `
+	SELECT ` + listColumns + `
+	FROM lists l
+	WHERE l.user_id = $1 AND (l.user_id = $2 OR (NOT l.is_private AND ` + notBlockedSQL("l.user_id", "$2") + `))
+	ORDER BY l.created_at DESC, l.id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var l List
+		if err := scanList(rows, &l); err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// Update saves the name, description and privacy of a list of its owner.
+func (s *ListsStore) Update(ctx context.Context, l *List) error {
+	query := `
+	UPDATE lists SET name = $3, description = $4, is_private = $5, updated_at = NOW()
+	WHERE id = $1 AND user_id = $2
+	RETURNING updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, l.ID, l.UserID, l.Name, l.Description, l.IsPrivate).Scan(&l.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *ListsStore) Delete(ctx context.Context, id, userID int64) error {
+	query := `DELETE FROM lists WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddMember adds userID to a list of ownerID. Adding a member twice is not
+// an error, but adding someone who blocked the owner, or was blocked by
+// them, is.
+func (s *ListsStore) AddMember(ctx context.Context, listID, ownerID, userID int64) error {
+	blocked, err := isBlocked(ctx, s.db, ownerID, userID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBlocked
+	}
+
+	query := `
+	INSERT INTO list_members (list_id, user_id)
+	SELECT l.id, $3 FROM lists l WHERE l.id = $1 AND l.user_id = $2
+	ON CONFLICT DO NOTHING
+	RETURNING list_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var id int64
+	err = s.db.QueryRowContext(ctx, query, listID, ownerID, userID).Scan(&id)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			// Either the list is not the owner's or the user is
+			// already a member.
+			return s.checkMember(ctx, listID, ownerID, userID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *ListsStore) checkMember(ctx context.Context, listID, ownerID, userID int64) error {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM list_members lm JOIN lists l ON l.id = lm.list_id
+		WHERE lm.list_id = $1 AND l.user_id = $2 AND lm.user_id = $3)`
+
+	var member bool
+	if err := s.db.QueryRowContext(ctx, query, listID, ownerID, userID).Scan(&member); err != nil {
+		return err
+	}
+	if !member {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RemoveMember removes userID from a list of ownerID.
+func (s *ListsStore) RemoveMember(ctx context.Context, listID, ownerID, userID int64) error {
+	query := `
+	DELETE FROM list_members lm USING lists l
+	WHERE l.id = lm.list_id AND lm.list_id = $1 AND l.user_id = $2 AND lm.user_id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, listID, ownerID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetMembers returns the members of a list, most recently added first.
+// Members who blocked the viewer, or were blocked by them, are left out.
+func (s *ListsStore) GetMembers(ctx context.Context, listID, viewerID int64, pq PaginationQuery) ([]ListMember, error) {
+	query := `
+	SELECT u.id, u.username, lm.created_at
+	FROM list_members lm
+	JOIN users u ON u.id = lm.user_id
+	WHERE lm.list_id = $1 AND ` + notBlockedSQL("u.id", "$2") + `
+	ORDER BY lm.created_at DESC, u.id DESC
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, listID, viewerID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ListMember{}
+	for rows.Next() {
+		var m ListMember
+		if err := rows.Scan(&m.ID, &m.Username, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// GetFeed returns a page of the posts of the members of a list as seen by
+// viewerID, with the same filters, cursors and visibility rules as
+// GetUserFeed. The caller checks that the viewer may see the list.
+func (s *ListsStore) GetFeed(ctx context.Context, listID, viewerID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	scope := `p.user_id IN (SELECT lm.user_id FROM list_members lm WHERE lm.list_id = $8)`
+	return queryFeed(ctx, s.db, viewerID, scope, fq, listID)
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListBlocks(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	owner := newTestUser(t, db, "user")
+	member := newTestUser(t, db, "user")
+	blocker := newTestUser(t, db, "user")
+	stranger := newTestUser(t, db, "user")
+	checkErr(t, nil, s.Blocks.Block(ctx, blocker, owner))
+
+	public := &List{UserID: owner, Name: "public"}
+	checkErr(t, nil, s.Lists.Create(ctx, public))
+	private := &List{UserID: owner, Name: "private", IsPrivate: true}
+	checkErr(t, nil, s.Lists.Create(ctx, private))
+
+	t.Run("should not add users blocked either way", func(t *testing.T) {
+		checkErr(t, ErrBlocked, s.Lists.AddMember(ctx, public.ID, owner, blocker))
+		checkErr(t, ErrBlocked, s.Lists.AddMember(ctx, public.ID, blocker, owner))
+	})
+
+	t.Run("should only let the owner add members, once", func(t *testing.T) {
+		checkErr(t, nil, s.Lists.AddMember(ctx, public.ID, owner, member))
+		checkErr(t, nil, s.Lists.AddMember(ctx, public.ID, owner, member))
+		checkErr(t, ErrNotFound, s.Lists.AddMember(ctx, public.ID, stranger, member))
+		checkErr(t, ErrNotFound, s.Lists.RemoveMember(ctx, public.ID, stranger, member))
+
+		l, err := s.Lists.GetByID(ctx, public.ID, owner)
+		checkErr(t, nil, err)
+		if l.MembersCount != 1 {
+			t.Errorf("expected 1 member, got %d", l.MembersCount)
+		}
+	})
+
+	t.Run("should hide lists from blocked users and private ones from others", func(t *testing.T) {
+		_, err := s.Lists.GetByID(ctx, public.ID, stranger)
+		checkErr(t, nil, err)
+		_, err = s.Lists.GetByID(ctx, public.ID, blocker)
+		checkErr(t, ErrNotFound, err)
+		_, err = s.Lists.GetByID(ctx, private.ID, stranger)
+		checkErr(t, ErrNotFound, err)
+
+		lists, err := s.Lists.GetByUserID(ctx, owner, stranger)
+		checkErr(t, nil, err)
+		if len(lists) != 1 || lists[0].ID != public.ID {
+			t.Errorf("expected only the public list, got %+v", lists)
+		}
+	})
+
+	t.Run("should hide members the viewer blocked", func(t *testing.T) {
+		checkErr(t, nil, s.Blocks.Block(ctx, stranger, member))
+		defer func() { checkErr(t, nil, s.Blocks.Unblock(ctx, stranger, member)) }()
+
+		members, err := s.Lists.GetMembers(ctx, public.ID, stranger, PaginationQuery{Limit: 10})
+		checkErr(t, nil, err)
+		if len(members) != 0 {
+			t.Errorf("expected no visible members, got %+v", members)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+)
+
+type Media struct {
+	ID           int64  `json:"id"`
+	UserID       int64  `json:"user_id"`
+	Key          string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	CreatedAt    string `json:"created_at"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+func (s *MediaStore) Create(ctx context.Context, m *Media) error {
+	query := `
+	INSERT INTO media (user_id, storage_key, thumbnail_key, content_type, size_bytes, width, height)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query,
+		m.UserID, m.Key, m.ThumbnailKey, m.ContentType, m.Size, m.Width, m.Height).Scan(
+		&m.ID,
+		&m.CreatedAt)
+}
+
+// GetByIDs returns the media among ids that belong to userID, in the order
+// of ids.
+func (s *MediaStore) GetByIDs(ctx context.Context, userID int64, ids []int64) ([]Media, error) {
+	query := `
+	SELECT id, user_id, storage_key, thumbnail_key, content_type, size_bytes, width, height, created_at
+	FROM media
+	WHERE user_id = $1 AND id = ANY($2)
+	ORDER BY array_position($2, id)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMedia(rows)
+}
+
+func (s *MediaStore) GetByPostID(ctx context.Context, postID int64) ([]Media, error) {
+	query := `
+	SELECT m.id, m.user_id, m.storage_key, m.thumbnail_key, m.content_type, m.size_bytes, m.width, m.height, m.created_at
+	FROM post_attachments pa
+	JOIN media m ON m.id = pa.media_id
+	WHERE pa.post_id = $1
+	ORDER BY pa.position`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMedia(rows)
+}
+
+func scanMedia(rows *sql.Rows) ([]Media, error) {
+	media := []Media{}
+	for rows.Next() {
+		var m Media
+		err := rows.Scan(&m.ID, &m.UserID, &m.Key, &m.ThumbnailKey, &m.ContentType,
+			&m.Size, &m.Width, &m.Height, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
+
+// GetKeysByUserID returns the blob keys of every file uploaded by userID.
+func (s *MediaStore) GetKeysByUserID(ctx context.Context, userID int64) ([]string, error) {
+	query := `SELECT storage_key, thumbnail_key FROM media WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key, thumbKey string
+		if err := rows.Scan(&key, &thumbKey); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key, thumbKey)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	owner := newTestUser(t, db, "user")
+	other := newTestUser(t, db, "user")
+	m := &Media{UserID: owner, Key: "media/test/a.png", ThumbnailKey: "media/test/a_thumb.png", ContentType: "image/png", Size: 3, Width: 16, Height: 16}
+	checkErr(t, nil, s.Media.Create(ctx, m))
+
+	t.Run("should only return the media of their owner", func(t *testing.T) {
+		for userID, want := range map[int64]int{owner: 1, other: 0} {
+			media, err := s.Media.GetByIDs(ctx, userID, []int64{m.ID})
+			checkErr(t, nil, err)
+			if len(media) != want {
+				t.Errorf("expected user %d to get %d media, got %d", userID, want, len(media))
+			}
+		}
+	})
+
+	t.Run("should attach media to one post only", func(t *testing.T) {
+		first := &Post{Title: "first", Content: "first", UserId: owner, Tags: []string{}, Attachments: []Media{*m}}
+		checkErr(t, nil, s.Posts.Create(ctx, first))
+		second := &Post{Title: "second", Content: "second", UserId: owner, Tags: []string{}, Attachments: []Media{*m}}
+		checkErr(t, ErrConflict, s.Posts.Create(ctx, second))
+
+		attached, err := s.Media.GetByPostID(ctx, first.ID)
+		checkErr(t, nil, err)
+		if len(attached) != 1 || attached[0].ID != m.ID {
+			t.Errorf("expected the media to stay attached to the first post, got %+v", attached)
+		}
+	})
+}
@@ -0,0 +1,452 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"slices"
+)
+
+// ErrMessagesRestricted is returned when a recipient only accepts messages
+// from people they follow.
+var ErrMessagesRestricted = errors.New("user only accepts messages from people they follow")
+
+type Conversation struct {
+	ID            int64                `json:"id"`
+	IsGroup       bool                 `json:"is_group"`
+	Members       []ConversationMember `json:"members"`
+	LastMessage   *Message             `json:"last_message"`
+	UnreadCount   int                  `json:"unread_count"`
+	CreatedAt     string               `json:"created_at"`
+	LastMessageAt string               `json:"last_message_at"`
+}
+
+type ConversationMember struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type Message struct {
+	ID             int64  `json:"id"`
+	ConversationID int64  `json:"conversation_id"`
+	SenderID       int64  `json:"sender_id"`
+	Body           string `json:"body"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// MessageQuery pages through a conversation, latest messages first. After
+// continues past a message; Before returns the page preceding it.
+type MessageQuery struct {
+	Limit  int
+	After  *FeedCursor
+	Before *FeedCursor
+}
+
+type MessagesStore struct {
+	db *sql.DB
+}
+
+// checkMembers checks that everyone in memberIDs may message everyone else
+// in it: they exist, no two of them blocked each other, and those that only
+// accept messages from people they follow follow all the others. The
+// creator of the conversation chose its members, so their own setting is
+// not checked.
+func checkMembers(ctx context.Context, tx *sql.Tx, creatorID int64, memberIDs []int64) error {
+	query := `
+	SELECT
+		(SELECT count(*) FROM users WHERE id = ANY($1) AND is_active),
+		EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE blocker_id = ANY($1) AND blocked_id = ANY($1)),
+		EXISTS (
+			SELECT 1 FROM users u CROSS JOIN unnest($1::bigint[]) other(id)
+			WHERE u.id = ANY($1) AND u.id <> $2 AND u.dm_followers_only AND other.id <> u.id
+				AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = other.id AND f.follower_id = u.id))`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var (
+		found      int
+		blocked    bool
+		restricted bool
+	)
+	err := tx.QueryRowContext(ctx, query, pq.Array(memberIDs), creatorID).Scan(&found, &blocked, &restricted)
+	if err != nil {
+		return err
+	}
+	switch {
+	case found != len(memberIDs):
+		return ErrNotFound
+	case blocked:
+		return ErrBlocked
+	case restricted:
+		return ErrMessagesRestricted
+	}
+	return nil
+}
+
+// Start opens a conversation between creatorID and memberIDs, who must not
+// include the creator. With a single member, the existing conversation of
+// the pair is returned if there is one, which is reported by created. The
+// messaging rules are checked between every two members here, once.
+func (s *MessagesStore) Start(ctx context.Context, creatorID int64, memberIDs []int64) (conversationID int64, created bool, err error) {
+	err = withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := checkMembers(ctx, tx, creatorID, append([]int64{creatorID}, memberIDs...)); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		var directKey sql.NullString
+		if len(memberIDs) == 1 {
+			directKey.String = fmt.Sprintf("%d:%d", min(creatorID, memberIDs[0]), max(creatorID, memberIDs[0]))
+			directKey.Valid = true
+		}
+
+		// Updating on conflict makes RETURNING report the existing row,
+		// which xmax tells apart from an inserted one.
+		err := tx.QueryRowContext(ctx, `
+		INSERT INTO conversations (direct_key, created_by) VALUES ($1, $2)
+		ON CONFLICT (direct_key) DO UPDATE SET direct_key = EXCLUDED.direct_key
+		RETURNING id, xmax = 0`, directKey, creatorID).Scan(&conversationID, &created)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		SELECT $1, unnest($2::bigint[])`, conversationID, pq.Array(append([]int64{creatorID}, memberIDs...)))
+		return err
+	})
+	return conversationID, created, err
+}
+
+func conversationsQuery(where string) string {
+	return `
+	SELECT c.id, c.direct_key IS NULL, c.created_at, c.last_message_at,
+		(SELECT count(*) FROM messages m
+		 WHERE m.conversation_id = c.id AND m.id > cm.last_read_message_id AND m.sender_id <> $1),
+		lm.id, lm.sender_id, lm.body, lm.created_at
+	FROM conversation_members cm
+	JOIN conversations c ON c.id = cm.conversation_id
+	LEFT JOIN LATERAL (
+		SELECT id, sender_id, body, created_at FROM messages
+		WHERE conversation_id = c.id
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	) lm ON TRUE
+	WHERE cm.user_id = $1 AND ` + where + `
+	ORDER BY c.last_message_at DESC, c.id DESC`
+}
+
+func (s *MessagesStore) queryConversations(ctx context.Context, query string, args ...any) ([]Conversation, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		var (
+			c         Conversation
+			lastID    sql.NullInt64
+			senderID  sql.NullInt64
+			body      sql.NullString
+			createdAt sql.NullString
+		)
+		err := rows.Scan(&c.ID, &c.IsGroup, &c.CreatedAt, &c.LastMessageAt, &c.UnreadCount,
+			&lastID, &senderID, &body, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		if lastID.Valid {
+			c.LastMessage = &Message{
+				ID:             lastID.Int64,
+				ConversationID: c.ID,
+				SenderID:       senderID.Int64,
+				Body:           body.String,
+				CreatedAt:      createdAt.String,
+			}
+		}
+		conversations = append(conversations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return conversations, s.loadMembers(ctx, conversations)
+}
+
+func (s *MessagesStore) loadMembers(ctx context.Context, conversations []Conversation) error {
+	if len(conversations) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(conversations))
+	for i, c := range conversations {
+		ids[i] = c.ID
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT cm.conversation_id, u.id, u.username
+	FROM conversation_members cm
+	JOIN users u ON u.id = cm.user_id
+	WHERE cm.conversation_id = ANY($1)
+	ORDER BY u.id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var conversationID int64
+		var m ConversationMember
+		if err := rows.Scan(&conversationID, &m.ID, &m.Username); err != nil {
+			return err
+		}
+		i := slices.IndexFunc(conversations, func(c Conversation) bool { return c.ID == conversationID })
+		conversations[i].Members = append(conversations[i].Members, m)
+	}
+	return rows.Err()
+}
+
+// GetByUserID lists the conversations of a user, latest activity first.
+func (s *MessagesStore) GetByUserID(ctx context.Context, userID int64, page PaginationQuery) ([]Conversation, error) {
+	query := conversationsQuery("TRUE") + `
+	LIMIT $2 OFFSET $3`
+	return s.queryConversations(ctx, query, userID, page.Limit, page.Offset)
+}
+
+// GetConversation returns a conversation userID is a member of.
+func (s *MessagesStore) GetConversation(ctx context.Context, id, userID int64) (*Conversation, error) {
+	conversations, err := s.queryConversations(ctx, conversationsQuery("c.id = $2"), userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, ErrNotFound
+	}
+	return &conversations[0], nil
+}
+
+// Send stores a message from a member of the conversation, who has then
+// read it, and returns the other members it is delivered to. Members that
+// left or blocked each other since the conversation started are not
+// delivered to, and a direct conversation cannot be written to then, nor
+// once the recipient only accepts messages from people they follow and
+// does not follow the sender.
+func (s *MessagesStore) Send(ctx context.Context, m *Message) ([]int64, error) {
+	var recipients []int64
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, `
+		SELECT cm.user_id, c.direct_key IS NOT NULL, u.is_active, NOT `+notBlockedSQL("u.id", "$2")+`,
+			u.dm_followers_only AND NOT EXISTS (
+				SELECT 1 FROM followers f WHERE f.user_id = $2 AND f.follower_id = u.id)
+		FROM conversation_members cm
+		JOIN conversations c ON c.id = cm.conversation_id
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = $1
+		FOR SHARE OF cm`, m.ConversationID, m.SenderID)
+		if err != nil {
+			return err
+		}
+		var member, direct bool
+		var unreachable error
+		for rows.Next() {
+			var (
+				id         int64
+				active     bool
+				blocked    bool
+				restricted bool
+			)
+			if err := rows.Scan(&id, &direct, &active, &blocked, &restricted); err != nil {
+				rows.Close()
+				return err
+			}
+			switch {
+			case id == m.SenderID:
+				member = true
+			case !active:
+				unreachable = ErrNotFound
+			case blocked:
+				unreachable = ErrBlocked
+			case direct && restricted:
+				unreachable = ErrMessagesRestricted
+			default:
+				recipients = append(recipients, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if !member {
+			return ErrNotFound
+		}
+		if direct && unreachable != nil {
+			return unreachable
+		}
+
+		err = tx.QueryRowContext(ctx, `
+		INSERT INTO messages (conversation_id, sender_id, body) VALUES ($1, $2, $3)
+		RETURNING id, created_at`, m.ConversationID, m.SenderID, m.Body).Scan(&m.ID, &m.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE conversations SET last_message_at = $2 WHERE id = $1`, m.ConversationID, m.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE conversation_members SET last_read_message_id = $3
+		WHERE conversation_id = $1 AND user_id = $2`, m.ConversationID, m.SenderID, m.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// GetMessages returns a page of a conversation userID is a member of.
+func (s *MessagesStore) GetMessages(ctx context.Context, conversationID, userID int64, q MessageQuery) ([]Message, error) {
+	cursor, order, cmp := q.After, "DESC", "<"
+	if q.Before != nil {
+		cursor, order, cmp = q.Before, "ASC", ">"
+	}
+
+	args := []any{conversationID, userID, q.Limit}
+	cursorSQL := "TRUE"
+	if cursor != nil {
+		cursorSQL = "(m.created_at, m.id) " + cmp + " ($4, $5)"
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+
+	query := `
+	SELECT m.id, m.conversation_id, m.sender_id, m.body, m.created_at
+	FROM messages m
+	WHERE m.conversation_id = $1 AND
+		EXISTS (SELECT 1 FROM conversation_members cm WHERE cm.conversation_id = $1 AND cm.user_id = $2) AND
+		` + cursorSQL + `
+	ORDER BY m.created_at ` + order + `, m.id ` + order + `
+	LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if q.Before != nil {
+		slices.Reverse(messages)
+	}
+	return messages, nil
+}
+
+// MarkRead marks every message of a conversation as read by userID.
+func (s *MessagesStore) MarkRead(ctx context.Context, conversationID, userID int64) error {
+	query := `
+	UPDATE conversation_members
+	SET last_read_message_id = COALESCE((SELECT max(id) FROM messages WHERE conversation_id = $1), 0)
+	WHERE conversation_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UnreadCount counts the messages others sent to userID that they did not
+// read yet.
+func (s *MessagesStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	query := `
+	SELECT count(*)
+	FROM conversation_members cm
+	JOIN messages m ON m.conversation_id = cm.conversation_id
+	WHERE cm.user_id = $1 AND m.id > cm.last_read_message_id AND m.sender_id <> $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// GetFollowersOnly reports whether userID only accepts messages from people
+// they follow.
+func (s *MessagesStore) GetFollowersOnly(ctx context.Context, userID int64) (bool, error) {
+	query := `SELECT dm_followers_only FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var followersOnly bool
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&followersOnly)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return followersOnly, err
+}
+
+func (s *MessagesStore) SetFollowersOnly(ctx context.Context, userID int64, followersOnly bool) error {
+	query := `UPDATE users SET dm_followers_only = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, followersOnly)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
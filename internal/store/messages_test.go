@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestGroupMessaging(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	creator := newTestUser(t, db, "user")
+	a := newTestUser(t, db, "user")
+	b := newTestUser(t, db, "user")
+	restricted := newTestUser(t, db, "user")
+	checkErr(t, nil, s.Messages.SetFollowersOnly(ctx, restricted, true))
+	for _, f := range [][2]int64{{restricted, creator}, {restricted, a}} {
+		_, err := s.Followers.Follow(ctx, f[0], f[1])
+		checkErr(t, nil, err)
+	}
+
+	t.Run("should check every pair of members", func(t *testing.T) {
+		checkErr(t, nil, s.Blocks.Block(ctx, a, b))
+		defer func() { checkErr(t, nil, s.Blocks.Unblock(ctx, a, b)) }()
+
+		_, _, err := s.Messages.Start(ctx, creator, []int64{a, b})
+		checkErr(t, ErrBlocked, err)
+	})
+
+	t.Run("should let restricted members in with the people they follow", func(t *testing.T) {
+		_, _, err := s.Messages.Start(ctx, creator, []int64{a, restricted})
+		checkErr(t, nil, err)
+
+		_, _, err = s.Messages.Start(ctx, creator, []int64{b, restricted})
+		checkErr(t, ErrMessagesRestricted, err)
+	})
+
+	t.Run("should not check the creator's own setting", func(t *testing.T) {
+		_, created, err := s.Messages.Start(ctx, restricted, []int64{b})
+		checkErr(t, nil, err)
+		if !created {
+			t.Error("expected a new conversation")
+		}
+	})
+
+	t.Run("should skip blocked members when sending to a group", func(t *testing.T) {
+		group, _, err := s.Messages.Start(ctx, creator, []int64{a, b})
+		checkErr(t, nil, err)
+		checkErr(t, nil, s.Blocks.Block(ctx, b, a))
+		defer func() { checkErr(t, nil, s.Blocks.Unblock(ctx, b, a)) }()
+
+		recipients, err := s.Messages.Send(ctx, &Message{ConversationID: group, SenderID: a, Body: "hi"})
+		checkErr(t, nil, err)
+		if len(recipients) != 1 || !slices.Contains(recipients, creator) {
+			t.Errorf("expected only the creator to receive the message, got %v", recipients)
+		}
+
+		recipients, err = s.Messages.Send(ctx, &Message{ConversationID: group, SenderID: creator, Body: "hi"})
+		checkErr(t, nil, err)
+		if len(recipients) != 2 {
+			t.Errorf("expected both members to receive the message, got %v", recipients)
+		}
+	})
+
+	t.Run("should close direct conversations once blocked", func(t *testing.T) {
+		direct, _, err := s.Messages.Start(ctx, creator, []int64{b})
+		checkErr(t, nil, err)
+		checkErr(t, nil, s.Blocks.Block(ctx, b, creator))
+		defer func() { checkErr(t, nil, s.Blocks.Unblock(ctx, b, creator)) }()
+
+		_, err = s.Messages.Send(ctx, &Message{ConversationID: direct, SenderID: creator, Body: "hi"})
+		checkErr(t, ErrBlocked, err)
+	})
+	t.Run("should close direct conversations once the recipient stops following", func(t *testing.T) {
+		direct, _, err := s.Messages.Start(ctx, creator, []int64{restricted})
+		checkErr(t, nil, err)
+		_, err = s.Messages.Send(ctx, &Message{ConversationID: direct, SenderID: creator, Body: "hi"})
+		checkErr(t, nil, err)
+
+		checkErr(t, nil, s.Followers.Unfollow(ctx, restricted, creator))
+		_, err = s.Messages.Send(ctx, &Message{ConversationID: direct, SenderID: creator, Body: "hi"})
+		checkErr(t, ErrMessagesRestricted, err)
+
+		_, err = s.Messages.Send(ctx, &Message{ConversationID: direct, SenderID: restricted, Body: "hi"})
+		checkErr(t, nil, err)
+	})
+}
@@ -8,7 +8,18 @@ import (
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:         &MockUserStore{},
+		Followers:     &MockFollowerStore{},
+		Blocks:        &MockBlockStore{},
+		Mutes:         &MockMuteStore{},
+		Notifications: &MockNotificationStore{},
+		Digests:       &MockDigestStore{},
+		Webhooks:      &MockWebhookStore{},
+		Messages:      &MockMessageStore{},
+		Lists:         &MockListStore{},
+		Communities:   &MockCommunityStore{},
+		Polls:         &MockPollStore{},
+		Reports:       &MockReportStore{},
 	}
 }
 
@@ -26,8 +37,8 @@ func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *User, token s
 	return nil
 }
 
-func (m *MockUserStore) Activate(ctx context.Context, username string) error {
-	return nil
+func (m *MockUserStore) Activate(ctx context.Context, username string) (*User, error) {
+	return &User{IsActive: true}, nil
 }
 
 func (m *MockUserStore) Delete(ctx context.Context, id int64) error {
@@ -37,3 +48,383 @@ func (m *MockUserStore) Delete(ctx context.Context, id int64) error {
 func (m *MockUserStore) GetByEmail(ctx context.Context, username string) (*User, error) {
 	return &User{}, nil
 }
+
+func (m *MockUserStore) SetPrivacy(ctx context.Context, id int64, isPrivate bool) error {
+	return nil
+}
+
+func (m *MockUserStore) UpdateProfile(ctx context.Context, user *User, usernameCooldown time.Duration, change *EmailChange) error {
+	return nil
+}
+
+func (m *MockUserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	return &User{}, nil
+}
+
+func (m *MockUserStore) ScheduleDeletion(ctx context.Context, id int64, at time.Time) error {
+	return nil
+}
+
+func (m *MockUserStore) CancelDeletion(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockUserStore) Search(ctx context.Context, q string, viewerID int64, pq PaginationQuery) ([]UserSearchResult, error) {
+	return []UserSearchResult{}, nil
+}
+
+func (m *MockUserStore) GetDueForDeletion(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	return []int64{}, nil
+}
+
+type MockFollowerStore struct{}
+
+func (m *MockFollowerStore) Follow(ctx context.Context, followerID, userID int64) (FollowStatus, error) {
+	return FollowStatusFollowing, nil
+}
+
+func (m *MockFollowerStore) Unfollow(ctx context.Context, followerID, userID int64) error {
+	return nil
+}
+
+func (m *MockFollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, pq PaginationQuery) ([]FollowListItem, error) {
+	return []FollowListItem{}, nil
+}
+
+func (m *MockFollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, pq PaginationQuery) ([]FollowListItem, error) {
+	return []FollowListItem{}, nil
+}
+
+func (m *MockFollowerStore) GetRelationship(ctx context.Context, viewerID, userID int64) (*Relationship, error) {
+	return &Relationship{}, nil
+}
+
+func (m *MockFollowerStore) GetFollowRequests(ctx context.Context, userID int64, pq PaginationQuery) ([]FollowRequest, error) {
+	return []FollowRequest{}, nil
+}
+
+func (m *MockFollowerStore) ApproveRequest(ctx context.Context, userID, requesterID int64) error {
+	return nil
+}
+
+func (m *MockFollowerStore) RejectRequest(ctx context.Context, userID, requesterID int64) error {
+	return nil
+}
+
+func (m *MockFollowerStore) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	return []int64{}, nil
+}
+
+type MockBlockStore struct{}
+
+func (m *MockBlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return nil
+}
+
+func (m *MockBlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	return nil
+}
+
+func (m *MockBlockStore) IsBlocked(ctx context.Context, a, b int64) (bool, error) {
+	return false, nil
+}
+
+func (m *MockBlockStore) GetBlocked(ctx context.Context, userID int64, pq PaginationQuery) ([]BlockedUser, error) {
+	return []BlockedUser{}, nil
+}
+
+type MockMuteStore struct{}
+
+func (m *MockMuteStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	return nil
+}
+
+func (m *MockMuteStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	return nil
+}
+
+func (m *MockMuteStore) GetMuted(ctx context.Context, userID int64, pq PaginationQuery) ([]BlockedUser, error) {
+	return []BlockedUser{}, nil
+}
+
+type MockNotificationStore struct{}
+
+func (m *MockNotificationStore) Create(ctx context.Context, n NewNotification, recipientIDs []int64) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (m *MockNotificationStore) GetByUserID(ctx context.Context, userID int64, unreadOnly bool, pq PaginationQuery) ([]Notification, error) {
+	return []Notification{}, nil
+}
+
+func (m *MockNotificationStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	return 0, nil
+}
+
+func (m *MockNotificationStore) MarkRead(ctx context.Context, userID, id int64) error {
+	return nil
+}
+
+func (m *MockNotificationStore) MarkAllRead(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockNotificationStore) GetPreferences(ctx context.Context, userID int64) (map[string]bool, error) {
+	prefs := map[string]bool{}
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+	return prefs, nil
+}
+
+func (m *MockNotificationStore) SetPreferences(ctx context.Context, userID int64, prefs map[string]bool) error {
+	return nil
+}
+
+type MockDigestStore struct{}
+
+func (m *MockDigestStore) GetFrequency(ctx context.Context, userID int64) (string, error) {
+	return "off", nil
+}
+
+func (m *MockDigestStore) SetFrequency(ctx context.Context, userID int64, frequency string) error {
+	return nil
+}
+
+func (m *MockDigestStore) GetDue(ctx context.Context, frequency string, periodStart time.Time, limit int) ([]DigestRecipient, error) {
+	return []DigestRecipient{}, nil
+}
+
+func (m *MockDigestStore) Claim(ctx context.Context, userID int64, periodStart time.Time) (bool, error) {
+	return true, nil
+}
+
+func (m *MockDigestStore) MarkSent(ctx context.Context, userID int64, periodStart time.Time) error {
+	return nil
+}
+
+func (m *MockDigestStore) GetContent(ctx context.Context, userID int64, from, to time.Time, topPosts int) (*DigestContent, error) {
+	return &DigestContent{Notifications: map[string]int{}}, nil
+}
+
+type MockWebhookStore struct{}
+
+func (m *MockWebhookStore) Create(ctx context.Context, w *Webhook) error {
+	w.ID = 1
+	w.Active = true
+	return nil
+}
+
+func (m *MockWebhookStore) GetByID(ctx context.Context, id, userID int64) (*Webhook, error) {
+	return &Webhook{ID: id, UserID: userID, Active: true}, nil
+}
+
+func (m *MockWebhookStore) GetByUserID(ctx context.Context, userID int64) ([]Webhook, error) {
+	return []Webhook{}, nil
+}
+
+func (m *MockWebhookStore) Update(ctx context.Context, w *Webhook) error {
+	return nil
+}
+
+func (m *MockWebhookStore) Delete(ctx context.Context, id, userID int64) error {
+	return nil
+}
+
+func (m *MockWebhookStore) Enqueue(ctx context.Context, event string, ownerIDs []int64, payload []byte) error {
+	return nil
+}
+
+func (m *MockWebhookStore) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	return []WebhookDelivery{}, nil
+}
+
+func (m *MockWebhookStore) RecordSuccess(ctx context.Context, d *WebhookDelivery, statusCode int) error {
+	return nil
+}
+
+func (m *MockWebhookStore) RecordFailure(ctx context.Context, d *WebhookDelivery, statusCode int, reason string, retryAt *time.Time, disableAfter int) (bool, error) {
+	return false, nil
+}
+
+func (m *MockWebhookStore) GetDeliveries(ctx context.Context, webhookID int64, pq PaginationQuery) ([]WebhookDelivery, error) {
+	return []WebhookDelivery{}, nil
+}
+
+type MockMessageStore struct{}
+
+func (m *MockMessageStore) Start(ctx context.Context, creatorID int64, memberIDs []int64) (int64, bool, error) {
+	return 1, true, nil
+}
+
+func (m *MockMessageStore) GetByUserID(ctx context.Context, userID int64, pq PaginationQuery) ([]Conversation, error) {
+	return []Conversation{}, nil
+}
+
+func (m *MockMessageStore) GetConversation(ctx context.Context, id, userID int64) (*Conversation, error) {
+	return &Conversation{ID: id, Members: []ConversationMember{{ID: userID}}}, nil
+}
+
+func (m *MockMessageStore) Send(ctx context.Context, msg *Message) ([]int64, error) {
+	msg.ID = 1
+	msg.CreatedAt = time.Now().Format(time.RFC3339)
+	return []int64{}, nil
+}
+
+func (m *MockMessageStore) GetMessages(ctx context.Context, conversationID, userID int64, q MessageQuery) ([]Message, error) {
+	return []Message{}, nil
+}
+
+func (m *MockMessageStore) MarkRead(ctx context.Context, conversationID, userID int64) error {
+	return nil
+}
+
+func (m *MockMessageStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	return 0, nil
+}
+
+func (m *MockMessageStore) GetFollowersOnly(ctx context.Context, userID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *MockMessageStore) SetFollowersOnly(ctx context.Context, userID int64, followersOnly bool) error {
+	return nil
+}
+
+type MockListStore struct{}
+
+func (m *MockListStore) Create(ctx context.Context, l *List) error {
+	l.ID = 1
+	return nil
+}
+
+func (m *MockListStore) GetByID(ctx context.Context, id, viewerID int64) (*List, error) {
+	return &List{ID: id, UserID: viewerID}, nil
+}
+
+func (m *MockListStore) GetByUserID(ctx context.Context, userID, viewerID int64) ([]List, error) {
+	return []List{}, nil
+}
+
+func (m *MockListStore) Update(ctx context.Context, l *List) error {
+	return nil
+}
+
+func (m *MockListStore) Delete(ctx context.Context, id, userID int64) error {
+	return nil
+}
+
+func (m *MockListStore) AddMember(ctx context.Context, listID, ownerID, userID int64) error {
+	return nil
+}
+
+func (m *MockListStore) RemoveMember(ctx context.Context, listID, ownerID, userID int64) error {
+	return nil
+}
+
+func (m *MockListStore) GetMembers(ctx context.Context, listID, viewerID int64, pq PaginationQuery) ([]ListMember, error) {
+	return []ListMember{}, nil
+}
+
+func (m *MockListStore) GetFeed(ctx context.Context, listID, viewerID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	return []PostWithMetadata{}, nil
+}
+
+type MockCommunityStore struct{}
+
+func (m *MockCommunityStore) Create(ctx context.Context, c *Community) error {
+	c.ID = 1
+	return nil
+}
+
+func (m *MockCommunityStore) GetByID(ctx context.Context, id int64) (*Community, error) {
+	return &Community{ID: id, JoinPolicy: "open"}, nil
+}
+
+func (m *MockCommunityStore) GetAll(ctx context.Context, search string, pq PaginationQuery) ([]Community, error) {
+	return []Community{}, nil
+}
+
+func (m *MockCommunityStore) Update(ctx context.Context, c *Community) error {
+	return nil
+}
+
+func (m *MockCommunityStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockCommunityStore) GetMember(ctx context.Context, communityID, userID int64) (*CommunityMember, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockCommunityStore) GetMembers(ctx context.Context, communityID int64, status string, pq PaginationQuery) ([]CommunityMember, error) {
+	return []CommunityMember{}, nil
+}
+
+func (m *MockCommunityStore) Join(ctx context.Context, communityID, userID int64) (string, error) {
+	return MemberActive, nil
+}
+
+func (m *MockCommunityStore) Invite(ctx context.Context, communityID, userID int64) (string, error) {
+	return MemberInvited, nil
+}
+
+func (m *MockCommunityStore) Approve(ctx context.Context, communityID, userID int64) error {
+	return nil
+}
+
+func (m *MockCommunityStore) RemoveMember(ctx context.Context, communityID, userID int64) error {
+	return nil
+}
+
+func (m *MockCommunityStore) SetRole(ctx context.Context, communityID, userID int64, role string) error {
+	return nil
+}
+
+func (m *MockCommunityStore) GetFeed(ctx context.Context, communityID, viewerID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	return []PostWithMetadata{}, nil
+}
+
+type MockPollStore struct{}
+
+func (m *MockPollStore) GetByPostIDs(ctx context.Context, viewerID int64, postIDs []int64) (map[int64]*Poll, error) {
+	return map[int64]*Poll{}, nil
+}
+
+func (m *MockPollStore) Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error {
+	return nil
+}
+
+func (m *MockPollStore) Freeze(ctx context.Context, limit int) (int64, error) {
+	return 0, nil
+}
+
+type MockReportStore struct{}
+
+func (m *MockReportStore) Create(ctx context.Context, nr NewReport) (int64, error) {
+	return 1, nil
+}
+
+func (m *MockReportStore) GetAll(ctx context.Context, status, targetType string, pq PaginationQuery) ([]Report, error) {
+	return []Report{}, nil
+}
+
+func (m *MockReportStore) GetByID(ctx context.Context, id int64) (*Report, error) {
+	return &Report{ID: id, Status: ReportOpen, Reasons: map[string]int64{}}, nil
+}
+
+func (m *MockReportStore) GetEntries(ctx context.Context, reportID int64, pq PaginationQuery) ([]ReportEntry, error) {
+	return []ReportEntry{}, nil
+}
+
+func (m *MockReportStore) Claim(ctx context.Context, id, moderatorID int64) (*Report, error) {
+	return &Report{ID: id, Status: ReportClaimed, ClaimedBy: &moderatorID}, nil
+}
+
+func (m *MockReportStore) Resolve(ctx context.Context, id, moderatorID int64, res Resolution) (*Report, error) {
+	return &Report{ID: id, Status: ReportResolved, ResolvedBy: &moderatorID, Action: &res.Action}, nil
+}
+
+func (m *MockReportStore) GetActions(ctx context.Context, targetType string, targetID int64, pq PaginationQuery) ([]ModerationAction, error) {
+	return []ModerationAction{}, nil
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"strconv"
+)
+
+const (
+	NotificationFollow        = "follow"
+	NotificationFollowRequest = "follow_request"
+	NotificationComment       = "comment"
+	NotificationReply         = "reply"
+	NotificationMention       = "mention"
+	NotificationReaction      = "reaction"
+	NotificationModeration    = "moderation"
+)
+
+// NotificationTypes lists the types users can turn on and off.
+var NotificationTypes = []string{
+	NotificationFollow,
+	NotificationFollowRequest,
+	NotificationComment,
+	NotificationReply,
+	NotificationMention,
+	NotificationReaction,
+	NotificationModeration,
+}
+
+// maxNotificationActors is how many of the latest actors of a group are
+// named.
+const maxNotificationActors = 3
+
+// NewNotification is something that happened to the recipients of a
+// notification. ActorID and PostID are 0 when there is no actor, as for
+// moderation, or no post.
+type NewNotification struct {
+	Type    string
+	ActorID int64
+	PostID  int64
+	Data    any
+}
+
+// Notification is a group of notifications of the same type, such as the
+// reactions to a post, listed as one with its latest actors.
+type Notification struct {
+	// ID is the latest notification of the group.
+	ID         int64               `json:"id"`
+	Type       string              `json:"type"`
+	Actors     []NotificationActor `json:"actors"`
+	ActorCount int                 `json:"actor_count"`
+	PostID     *int64              `json:"post_id"`
+	Data       json.RawMessage     `json:"data" swaggertype:"object"`
+	Message    string              `json:"message"`
+	Read       bool                `json:"read"`
+	CreatedAt  string              `json:"created_at"`
+}
+
+type NotificationActor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type NotificationsStore struct {
+	db *sql.DB
+}
+
+// notificationGroupKey groups follows, follow requests and the comments,
+// replies and reactions on a post. Mentions and moderation stand alone.
+func notificationGroupKey(n NewNotification) sql.NullString {
+	switch n.Type {
+	case NotificationFollow, NotificationFollowRequest:
+		return sql.NullString{String: n.Type, Valid: true}
+	case NotificationComment, NotificationReply, NotificationReaction:
+		return sql.NullString{String: n.Type + ":" + strconv.FormatInt(n.PostID, 10), Valid: true}
+	}
+	return sql.NullString{}
+}
+
+// Create notifies the recipients of n, except the actor, users that turned
+// the type off and users that blocked or muted the actor. Repeated
+// follows and reactions by the same actor notify once. It returns the
+// users notified.
+func (s *NotificationsStore) Create(ctx context.Context, n NewNotification, recipientIDs []int64) ([]int64, error) {
+	data, err := json.Marshal(n.Data)
+	if err != nil {
+		return nil, err
+	}
+	if n.Data == nil {
+		data = []byte("{}")
+	}
+
+	query := `
+	INSERT INTO notifications (user_id, actor_id, type, post_id, group_key, data)
+	SELECT r.id, $2, $3, $4, $5, $6::jsonb
+	FROM (SELECT DISTINCT unnest($1::bigint[]) AS id) r
+	WHERE r.id IS DISTINCT FROM $2::bigint AND
+		NOT EXISTS (
+			SELECT 1 FROM notification_preferences np
+			WHERE np.user_id = r.id AND np.type = $3 AND NOT np.enabled) AND
+		($2::bigint IS NULL OR (
+			` + notBlockedSQL("$2::bigint", "r.id") + ` AND
+			` + notMutedSQL("$2::bigint", "r.id") + `))
+	ON CONFLICT (user_id, group_key, actor_id) WHERE type IN ('reaction', 'follow') DO NOTHING
+	RETURNING user_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query,
+		pq.Array(recipientIDs),
+		sql.NullInt64{Int64: n.ActorID, Valid: n.ActorID != 0},
+		n.Type,
+		sql.NullInt64{Int64: n.PostID, Valid: n.PostID != 0},
+		notificationGroupKey(n),
+		string(data),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notified := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		notified = append(notified, id)
+	}
+	return notified, rows.Err()
+}
+
+// GetByUserID lists the notification groups of a user, latest first,
+// leaving out actors the user has since blocked or muted.
+func (s *NotificationsStore) GetByUserID(ctx context.Context, userID int64, unreadOnly bool, page PaginationQuery) ([]Notification, error) {
+	query := `
+	SELECT max(n.id), n.type, (array_agg(n.post_id ORDER BY n.id DESC))[1],
+		(array_agg(n.data ORDER BY n.id DESC))[1], bool_and(n.read_at IS NOT NULL), max(n.created_at),
+		count(DISTINCT n.actor_id),
+		(array_agg(n.actor_id ORDER BY n.id DESC) FILTER (WHERE n.actor_id IS NOT NULL))[1:20],
+		(array_agg(u.username ORDER BY n.id DESC) FILTER (WHERE n.actor_id IS NOT NULL))[1:20]
+	FROM notifications n
+	LEFT JOIN users u ON u.id = n.actor_id
+	WHERE n.user_id = $1 AND (n.actor_id IS NULL OR (
+		` + notBlockedSQL("n.actor_id", "$1") + ` AND
+		` + notMutedSQL("n.actor_id", "$1") + `))
+	GROUP BY n.type, COALESCE(n.group_key, n.id::text)
+	HAVING NOT $2 OR bool_or(n.read_at IS NULL)
+	ORDER BY max(n.created_at) DESC, max(n.id) DESC
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, unreadOnly, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var (
+			n         Notification
+			postID    sql.NullInt64
+			actorIDs  []int64
+			usernames []string
+		)
+		err := rows.Scan(&n.ID, &n.Type, &postID, &n.Data, &n.Read, &n.CreatedAt, &n.ActorCount,
+			pq.Array(&actorIDs), pq.Array(&usernames))
+		if err != nil {
+			return nil, err
+		}
+		if postID.Valid {
+			n.PostID = &postID.Int64
+		}
+
+		// The same actor may comment several times.
+		n.Actors = []NotificationActor{}
+		seen := map[int64]bool{}
+		for i, id := range actorIDs {
+			if seen[id] || len(n.Actors) == maxNotificationActors {
+				continue
+			}
+			seen[id] = true
+			n.Actors = append(n.Actors, NotificationActor{ID: id, Username: usernames[i]})
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// UnreadCount counts the notification groups with unread notifications.
+func (s *NotificationsStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	query := `
+	SELECT count(DISTINCT (n.type, COALESCE(n.group_key, n.id::text)))
+	FROM notifications n
+	WHERE n.user_id = $1 AND n.read_at IS NULL AND (n.actor_id IS NULL OR (
+		` + notBlockedSQL("n.actor_id", "$1") + ` AND
+		` + notMutedSQL("n.actor_id", "$1") + `))`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks a notification as read along with the earlier ones of its
+// group.
+func (s *NotificationsStore) MarkRead(ctx context.Context, userID, id int64) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		var typ string
+		var groupKey sql.NullString
+		err := tx.QueryRowContext(ctx,
+			`SELECT type, group_key FROM notifications WHERE id = $1 AND user_id = $2`,
+			id, userID).Scan(&typ, &groupKey)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		query := `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL AND
+			(id = $2 OR (type = $3 AND group_key = $4 AND id < $2))`
+
+		_, err = tx.ExecContext(ctx, query, userID, id, typ, groupKey)
+		return err
+	})
+}
+
+func (s *NotificationsStore) MarkAllRead(ctx context.Context, userID int64) error {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// GetPreferences reports which notification types the user receives.
+func (s *NotificationsStore) GetPreferences(ctx context.Context, userID int64) (map[string]bool, error) {
+	query := `SELECT type, enabled FROM notification_preferences WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+	for rows.Next() {
+		var t string
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+		prefs[t] = enabled
+	}
+	return prefs, rows.Err()
+}
+
+// SetPreferences turns the given notification types on or off, leaving the
+// others as they are.
+func (s *NotificationsStore) SetPreferences(ctx context.Context, userID int64, prefs map[string]bool) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := `
+		INSERT INTO notification_preferences (user_id, type, enabled) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		for t, enabled := range prefs {
+			if _, err := tx.ExecContext(ctx, query, userID, t, enabled); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"fmt"
 	"net/http"
+	"project/internal/richtext"
 	"strconv"
 	"strings"
 	"time"
@@ -15,8 +17,22 @@ type PaginatedFeedQuery struct {
 	Search string   `json:"search" validate:"max=100"`
 	Since  string   `json:"since"`
 	Until  string   `json:"until"`
+	Mode   string   `json:"mode" validate:"oneof=chronological ranked"`
+	// After continues the feed past a post in sort order; Before returns
+	// the page preceding it. At most one of them is set, and Offset must
+	// then be 0.
+	After  *FeedCursor `json:"-"`
+	Before *FeedCursor `json:"-"`
 }
 
+// FeedCursor is the position of a post in the feed.
+type FeedCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// Parse overrides the defaults in fq with the query parameters of r and
+// reports malformed ones. Tags are normalized like post tags.
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
 	q := r.URL.Query()
 
@@ -24,7 +40,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if limit != "" {
 		l, err := strconv.Atoi(limit)
 		if err != nil {
-			return fq, nil
+			return fq, fmt.Errorf("invalid limit %q", limit)
 		}
 		fq.Limit = l
 	}
@@ -33,19 +49,30 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if offset != "" {
 		o, err := strconv.Atoi(offset)
 		if err != nil {
-			return fq, nil
+			return fq, fmt.Errorf("invalid offset %q", offset)
 		}
 		fq.Offset = o
 	}
 
-	sortBy := q.Get("sortBy")
+	// sortBy is the name the API first shipped with.
+	sortBy := q.Get("sort")
+	if sortBy == "" {
+		sortBy = q.Get("sortBy")
+	}
 	if sortBy != "" {
-		fq.SortBy = sortBy
+		fq.SortBy = strings.ToLower(sortBy)
 	}
 
 	tags := q.Get("tags")
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		fq.Tags = nil
+		for _, t := range strings.Split(tags, ",") {
+			tag := richtext.NormalizeTag(t)
+			if tag == "" {
+				return fq, fmt.Errorf("invalid tag %q", t)
+			}
+			fq.Tags = append(fq.Tags, tag)
+		}
 	}
 
 	search := q.Get("search")
@@ -53,22 +80,63 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Search = search
 	}
 
+	mode := q.Get("mode")
+	if mode != "" {
+		fq.Mode = mode
+	}
+
 	since := q.Get("since")
 	if since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime(since)
+		if err != nil {
+			return fq, fmt.Errorf("invalid since %q, expected YYYY-MM-DD", since)
+		}
+		fq.Since = t
 	}
 
 	until := q.Get("until")
 	if until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime(until)
+		if err != nil {
+			return fq, fmt.Errorf("invalid until %q, expected YYYY-MM-DD", until)
+		}
+		fq.Until = t
 	}
 	return fq, nil
 }
 
-func parseTime(s string) string {
+func parseTime(s string) (string, error) {
 	t, err := time.Parse("2006-01-02", s)
 	if err != nil {
-		return ""
+		return "", err
+	}
+	return t.Format("2006-01-02"), nil
+}
+
+type PaginationQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=50"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+func (pq PaginationQuery) Parse(r *http.Request) (PaginationQuery, error) {
+	q := r.URL.Query()
+
+	limit := q.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return pq, fmt.Errorf("invalid limit %q", limit)
+		}
+		pq.Limit = l
+	}
+
+	offset := q.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return pq, fmt.Errorf("invalid offset %q", offset)
+		}
+		pq.Offset = o
 	}
-	return t.Format("2006-01-02")
+	return pq, nil
 }
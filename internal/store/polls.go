@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPollClosed  = errors.New("poll is closed")
+	ErrInvalidVote = errors.New("invalid poll vote")
+)
+
+// Poll is attached to a post. Its results, Voters and the Votes of its
+// options, are hidden from users who did not vote until it closes.
+type Poll struct {
+	Multiple bool         `json:"multiple"`
+	ClosesAt string       `json:"closes_at"`
+	Closed   bool         `json:"closed"`
+	Voted    bool         `json:"voted"`
+	Voters   *int64       `json:"voters"`
+	Options  []PollOption `json:"options"`
+}
+
+type PollOption struct {
+	ID    int64  `json:"id"`
+	Text  string `json:"text"`
+	Votes *int64 `json:"votes"`
+	// Chosen is set on the options the current user voted for.
+	Chosen bool `json:"chosen"`
+}
+
+type PollsStore struct {
+	db *sql.DB
+}
+
+// createPoll stores the poll of a post being created.
+func createPoll(ctx context.Context, tx *sql.Tx, post *Post) error {
+	poll := post.Poll
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO polls (post_id, multiple, closes_at) VALUES ($1, $2, $3) RETURNING closes_at`,
+		post.ID, poll.Multiple, poll.ClosesAt).Scan(&poll.ClosesAt)
+	if err != nil {
+		return err
+	}
+
+	for i := range poll.Options {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO poll_options (post_id, position, text) VALUES ($1, $2, $3) RETURNING id`,
+			post.ID, i, poll.Options[i].Text).Scan(&poll.Options[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetByPostIDs returns the polls of the given posts, keyed by post, as
+// seen by viewerID. Counts are live until Freeze stores the results of a
+// closed poll, which makes them final; a poll that closed but was not
+// frozen yet still reports live counts.
+func (s *PollsStore) GetByPostIDs(ctx context.Context, viewerID int64, postIDs []int64) (map[int64]*Poll, error) {
+	query := `
+	SELECT p.post_id, p.multiple, p.closes_at, p.closes_at <= NOW(),
+		EXISTS (SELECT 1 FROM poll_ballots b WHERE b.post_id = p.post_id AND b.user_id = $2),
+		COALESCE(p.final_voters, (SELECT COUNT(*) FROM poll_ballots b WHERE b.post_id = p.post_id)),
+		o.id, o.text,
+		COALESCE(o.final_votes, (SELECT COUNT(*) FROM poll_votes v WHERE v.option_id = o.id)),
+		EXISTS (SELECT 1 FROM poll_votes v WHERE v.option_id = o.id AND v.user_id = $2)
+	FROM polls p
+	JOIN poll_options o ON o.post_id = p.post_id
+	WHERE p.post_id = ANY($1)
+	ORDER BY p.post_id, o.position`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	polls := make(map[int64]*Poll)
+	for rows.Next() {
+		var (
+			postID, voters int64
+			poll           Poll
+			o              PollOption
+			votes          int64
+		)
+		err := rows.Scan(&postID, &poll.Multiple, &poll.ClosesAt, &poll.Closed, &poll.Voted, &voters,
+			&o.ID, &o.Text, &votes, &o.Chosen)
+		if err != nil {
+			return nil, err
+		}
+
+		p, ok := polls[postID]
+		if !ok {
+			p = &poll
+			if p.Closed || p.Voted {
+				p.Voters = &voters
+			}
+			p.Options = []PollOption{}
+			polls[postID] = p
+		}
+		if p.Voters != nil {
+			o.Votes = &votes
+		}
+		p.Options = append(p.Options, o)
+	}
+	return polls, rows.Err()
+}
+
+// Vote records the ballot of userID, who votes for optionIDs. Each user
+// votes once: voting again fails with ErrConflict. Votes for options of
+// another poll, or for several options of a single choice poll, fail with
+// ErrInvalidVote.
+func (s *PollsStore) Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		// Lock the poll so it cannot be frozen while the vote is cast.
+		var multiple, open bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT multiple, closes_at > NOW() FROM polls WHERE post_id = $1 FOR SHARE`, postID).Scan(&multiple, &open)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if !open {
+			return ErrPollClosed
+		}
+		if !multiple && len(optionIDs) > 1 {
+			return ErrInvalidVote
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO poll_ballots (post_id, user_id) VALUES ($1, $2)`, postID, userID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO poll_votes (post_id, user_id, option_id)
+			SELECT $1, $2, o.id FROM poll_options o WHERE o.post_id = $1 AND o.id = ANY($3)`,
+			postID, userID, pq.Array(optionIDs))
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n != int64(len(optionIDs)) {
+			return ErrInvalidVote
+		}
+		return nil
+	})
+}
+
+// Freeze stores the final results of up to limit polls that closed and
+// returns how many it froze.
+func (s *PollsStore) Freeze(ctx context.Context, limit int) (int64, error) {
+	query := `
+	WITH due AS (
+		SELECT post_id FROM polls
+		WHERE final_voters IS NULL AND closes_at <= NOW()
+		ORDER BY closes_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	), options AS (
+		UPDATE poll_options o SET final_votes = (SELECT COUNT(*) FROM poll_votes v WHERE v.option_id = o.id)
+		FROM due WHERE o.post_id = due.post_id
+	)
+	UPDATE polls p SET final_voters = (SELECT COUNT(*) FROM poll_ballots b WHERE b.post_id = p.post_id)
+	FROM due WHERE p.post_id = due.post_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"html"
+	"strings"
+)
+
+type PostSearchQuery struct {
+	Query  string `json:"q" validate:"required,max=200"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+// PostSearchResult highlights are HTML: the post text is escaped and the
+// matches are wrapped in <mark> tags.
+type PostSearchResult struct {
+	Post
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Highlight      string  `json:"highlight"`
+}
+
+// ts_headline marks matches with control characters that are stripped from
+// the text beforehand, so that they can be turned into tags once the text
+// is escaped.
+const (
+	markStart = "\x02"
+	markStop  = "\x03"
+
+	titleHeadlineOptions = "HighlightAll=true, StartSel=\"" + markStart + "\", StopSel=\"" + markStop + "\""
+	headlineOptions      = "StartSel=\"" + markStart + "\", StopSel=\"" + markStop + "\", MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=\" … \""
+)
+
+var highlightReplacer = strings.NewReplacer(markStart, "<mark>", markStop, "</mark>")
+
+// highlight escapes a headline and turns its marks into <mark> tags.
+func highlight(headline string) string {
+	return highlightReplacer.Replace(html.EscapeString(headline))
+}
+
+// Search runs a websearch style full-text query (quotes, OR, -exclusion)
+// over titles, contents and tags, best ranked first. The query is parsed
+// with the text search configuration of each post, so posts indexed in
+// another language than the current default are found too.
+func (s *PostsStore) Search(ctx context.Context, viewerID int64, sq PostSearchQuery) ([]PostSearchResult, error) {
+	query := `
+	SELECT p.id, p.user_id, p.title, p.content, p.tags, p.created_at, p.updated_at, u.username,
+		ts_rank(p.search_vector, q) AS rank,
+		ts_headline(p.search_language, translate(p.title, chr(2) || chr(3), ''), q, $4),
+		ts_headline(p.search_language, translate(p.content, chr(2) || chr(3), ''), q, $5)
+	FROM pg_ts_config c
+	CROSS JOIN LATERAL websearch_to_tsquery(c.oid::regconfig, $1) q
+	JOIN posts p ON p.search_language = c.oid::regconfig AND p.search_vector @@ q
+	JOIN users u ON u.id = p.user_id
+	WHERE p.hidden_at IS NULL AND
+		` + visibleAuthorSQL("p.user_id", "u.is_private", "$6") + ` AND
+		` + notMutedSQL("p.user_id", "$6") + `
+	ORDER BY rank DESC, p.created_at DESC, p.id DESC
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query,
+		sq.Query, sq.Limit, sq.Offset, titleHeadlineOptions, headlineOptions, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+	for rows.Next() {
+		var r PostSearchResult
+		err := rows.Scan(
+			&r.ID,
+			&r.UserId,
+			&r.Title,
+			&r.Content,
+			pq.Array(&r.Tags),
+			&r.CreatedAt,
+			&r.UpdatedAt,
+			&r.User.Username,
+			&r.Rank,
+			&r.TitleHighlight,
+			&r.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		r.User.ID = r.UserId
+		r.TitleHighlight = highlight(r.TitleHighlight)
+		r.Highlight = highlight(r.Highlight)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	got := highlight("<script>alert(1)</script> " + markStart + "golang" + markStop + " & more")
+	want := "&lt;script&gt;alert(1)&lt;/script&gt; <mark>golang</mark> &amp; more"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	author := newTestUser(t, db, "user")
+	viewer := newTestUser(t, db, "user")
+	english := &Post{Title: "Running <b>fast</b>", Content: "<img src=x onerror=alert(1)> running with \x02gophers\x03", UserId: author, Tags: []string{}}
+	checkErr(t, nil, s.Posts.Create(ctx, english))
+	german := &Post{Title: "Häuser", Content: "Wir laufen durch die Häuser", UserId: author, Tags: []string{}, Language: "german"}
+	checkErr(t, nil, s.Posts.Create(ctx, german))
+
+	search := func(q string) []PostSearchResult {
+		t.Helper()
+		results, err := s.Posts.Search(ctx, viewer, PostSearchQuery{Query: q, Limit: 10})
+		checkErr(t, nil, err)
+		return results
+	}
+
+	t.Run("should escape the post text in highlights", func(t *testing.T) {
+		results := search("runs")
+		if len(results) != 1 || results[0].ID != english.ID {
+			t.Fatalf("expected the english post, got %+v", results)
+		}
+		for _, h := range []string{results[0].TitleHighlight, results[0].Highlight} {
+			if !strings.Contains(strings.ToLower(h), "<mark>running</mark>") {
+				t.Errorf("expected the match to be marked, got %q", h)
+			}
+			if strings.Contains(h, "<b>") || strings.Contains(h, "<img") || strings.ContainsAny(h, markStart+markStop) {
+				t.Errorf("expected the post text to be escaped, got %q", h)
+			}
+		}
+	})
+
+	t.Run("should parse the query in the language of each post", func(t *testing.T) {
+		results := search("haus")
+		if len(results) != 1 || results[0].ID != german.ID {
+			t.Errorf("expected the german post to match its stemmed word, got %+v", results)
+		}
+	})
+
+	t.Run("should not find posts hidden from the viewer", func(t *testing.T) {
+		checkErr(t, nil, s.Blocks.Block(ctx, author, viewer))
+		if results := search("running"); len(results) != 0 {
+			t.Errorf("expected no results from a blocking author, got %d", len(results))
+		}
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/lib/pq"
+	"slices"
 )
 
 type Post struct {
@@ -18,6 +20,17 @@ type Post struct {
 	UpdatedAt string    `json:"updated_at"`
 	Comments  []Comment `json:"comment"`
 	User      User      `json:"user"`
+
+	Attachments []Media   `json:"attachments"`
+	Mentions    []Mention `json:"mentions"`
+	// CommunityID is set on posts made in a community.
+	CommunityID *int64 `json:"community_id"`
+	Poll        *Poll  `json:"poll"`
+	// Hidden posts were hidden by a moderator.
+	Hidden bool `json:"hidden"`
+
+	// Language is the text search configuration the post is indexed with.
+	Language string `json:"-"`
 }
 type PostsStore struct {
 	db *sql.DB
@@ -28,31 +41,62 @@ type PostWithMetadata struct {
 	CommentsCount int64 `json:"comments_count"`
 }
 
+// GetUserFeed returns a page of the posts of userId and of the users they
+// follow, ordered by (created_at, id). Since and Until are inclusive days.
+// With fq.Before set the page is read backwards from the cursor and
+// returned in feed order.
 func (s *PostsStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
-	query :=
-		`
-		SELECT
-			p.id, p.user_id, p.title, p.content, p.created_at, p.tags,
-			u.username,
-			COUNT(c.id) AS comments_count
-		FROM posts p
-		LEFT JOIN COMMENTS c ON c.post_id = p.id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE 
-		    f.user_id = $1 AND
-			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-			(p.tags @> $5 OR $5 ='{}') AND
-			p.created_at >= $6 AND p.created_at <= $7
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.SortBy + `
-		LIMIT $2 OFFSET $3;
-`
+	scope := `p.user_id IN (
+			SELECT f.user_id FROM followers f WHERE f.follower_id = $1
+			UNION ALL
+			SELECT $1::bigint
+		)`
+	return queryFeed(ctx, s.db, userId, scope, fq)
+}
+
+// queryFeed reads a page of the feed of viewerID made of the posts p that
+// the scope condition selects, applying the filters and cursor of fq. The
+// condition may refer to the viewer as $1 and to the extra arguments from
+// $8 on.
+func queryFeed(ctx context.Context, db *sql.DB, viewerID int64, scope string, fq PaginatedFeedQuery, extra ...any) ([]PostWithMetadata, error) {
+	ascending := fq.SortBy == "asc"
+	cursor := fq.After
+	if fq.Before != nil {
+		ascending = !ascending
+		cursor = fq.Before
+	}
+	order, cmp := "DESC", "<"
+	if ascending {
+		order, cmp = "ASC", ">"
+	}
+
+	args := []any{viewerID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags), fq.Since, fq.Until}
+	args = append(args, extra...)
+	cursorSQL := "TRUE"
+	if cursor != nil {
+		cursorSQL = fmt.Sprintf("(p.created_at, p.id) %s ($%d, $%d)", cmp, len(args)+1, len(args)+2)
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+
+	query := `
+	SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.tags, p.community_id, u.username,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments_count
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE ` + scope + ` AND p.hidden_at IS NULL AND
+		($4 = '' OR p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+		($5 = '{}' OR p.tags @> $5) AND
+		p.created_at >= $6::date AND p.created_at < $7::date + 1 AND
+		` + cursorSQL + ` AND
+		` + visibleAuthorSQL("p.user_id", "u.is_private", "$1") + ` AND
+		` + notMutedSQL("p.user_id", "$1") + `
+	ORDER BY p.created_at ` + order + `, p.id ` + order + `
+	LIMIT $2 OFFSET $3`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userId, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags), fq.Since, fq.Until)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +113,7 @@ func (s *PostsStore) GetUserFeed(ctx context.Context, userId int64, fq Paginated
 			&p.Content,
 			&p.CreatedAt,
 			pq.Array(&p.Tags),
+			&p.CommunityID,
 			&p.User.Username,
 			&p.CommentsCount)
 		if err != nil {
@@ -76,33 +121,66 @@ func (s *PostsStore) GetUserFeed(ctx context.Context, userId int64, fq Paginated
 		}
 		feeds = append(feeds, p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if fq.Before != nil {
+		slices.Reverse(feeds)
+	}
 	return feeds, nil
 }
 
+// Create inserts the post together with links to its attachments and its
+// poll, if any. It returns ErrConflict when an attachment already belongs to
+// another post.
 func (s *PostsStore) Create(ctx context.Context, post *Post) error {
-	query := `
-	INSERT INTO posts (content, title, user_id, tags)
-	VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
-	`
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := `
+		INSERT INTO posts (content, title, user_id, tags, search_language, community_id)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, '')::regconfig, 'english'), $6)
+		RETURNING id, created_at, updated_at
+		`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
-	defer cancel()
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query,
-		post.Content, post.Title, post.UserId, pq.Array(post.Tags)).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
-	if err != nil {
-		return err
-	}
-	return nil
+		err := tx.QueryRowContext(ctx, query,
+			post.Content, post.Title, post.UserId, pq.Array(post.Tags), post.Language, post.CommunityID).Scan(
+			&post.ID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := syncEntities(ctx, tx, post); err != nil {
+			return err
+		}
+
+		for i, m := range post.Attachments {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO post_attachments (post_id, media_id, position) VALUES ($1, $2, $3)`,
+				post.ID, m.ID, i)
+			if err != nil {
+				if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+					return ErrConflict
+				}
+				return err
+			}
+		}
+
+		if post.Poll != nil {
+			return createPoll(ctx, tx, post)
+		}
+		return nil
+	})
 }
 
 func (s *PostsStore) GetByID(ctx context.Context, postId int64) (*Post, error) {
 	query := `
-	SELECT id, user_id, title, content, tags, created_at, updated_at, version
+	SELECT id, user_id, title, content, tags, created_at, updated_at, version, community_id, hidden_at IS NOT NULL
 	FROM posts 
 	WHERE ID =  $1;
 	`
@@ -119,7 +197,9 @@ func (s *PostsStore) GetByID(ctx context.Context, postId int64) (*Post, error) {
 		pq.Array(&post.Tags),
 		&post.CreatedAt,
 		&post.UpdatedAt,
-		&post.Version)
+		&post.Version,
+		&post.CommunityID,
+		&post.Hidden)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -138,7 +218,7 @@ func (s *PostsStore) Delete(ctx context.Context, postID int64) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
 	defer cancel()
 
-	res, err := s.db.ExecContext(ctx, query, postID)
+	res, err := conn(ctx, s.db).ExecContext(ctx, query, postID)
 	if err != nil {
 		return err
 	}
@@ -152,22 +232,73 @@ func (s *PostsStore) Delete(ctx context.Context, postID int64) error {
 	return nil
 }
 
+// Edit saves the title, content and tags of the post if nobody else changed
+// it since it was read, and re-links its tags and mentions.
 func (s *PostsStore) Edit(ctx context.Context, post *Post) error {
-	query := `UPDATE posts 
-SET title = $1, content = $2, version = version + 1
-WHERE ID = $3
-WHERE VERSION = $4
-RETURNING version;`
-
-	err := s.db.QueryRowContext(ctx,
-		query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		query := `UPDATE posts
+		SET title = $1, content = $2, tags = $3, version = version + 1, updated_at = NOW()
+		WHERE id = $4 AND version = $5
+		RETURNING version, updated_at;`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx,
+			query, post.Title, post.Content, pq.Array(post.Tags), post.ID, post.Version).Scan(
+			&post.Version,
+			&post.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return syncEntities(ctx, tx, post)
+	})
+}
+
+// GetByIDs returns the posts among ids that viewerID may see, in no
+// particular order.
+func (s *PostsStore) GetByIDs(ctx context.Context, viewerID int64, ids []int64) ([]PostWithMetadata, error) {
+	query := `
+	SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.tags, p.community_id, u.username,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments_count
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.id = ANY($1) AND p.hidden_at IS NULL AND
+		` + visibleAuthorSQL("p.user_id", "u.is_private", "$2") + ` AND
+		` + notMutedSQL("p.user_id", "$2")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), viewerID)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
-			return nil
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		err := rows.Scan(
+			&p.ID,
+			&p.UserId,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			pq.Array(&p.Tags),
+			&p.CommunityID,
+			&p.User.Username,
+			&p.CommentsCount)
+		if err != nil {
+			return nil, err
 		}
+		posts = append(posts, p)
 	}
-	return nil
+	return posts, rows.Err()
 }
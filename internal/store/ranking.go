@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"math"
+	"project/internal/ranking"
+	"time"
+)
+
+type RankingStore struct {
+	db *sql.DB
+}
+
+// GetCandidates returns what a ranked feed of userID is picked from: the
+// newest posts since since of the users they follow, at most limit of
+// them, plus the posts in popularIDs. Only posts the viewer may see and
+// did not write themselves are returned.
+func (s *RankingStore) GetCandidates(ctx context.Context, userID int64, since time.Time, limit int, popularIDs []int64) ([]ranking.Candidate, error) {
+	query := `
+	SELECT p.id, p.user_id, p.created_at, p.tags,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL),
+		(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id),
+		(SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id),
+		EXISTS (SELECT 1 FROM followers f WHERE f.user_id = p.user_id AND f.follower_id = $1)
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.id IN (
+			(SELECT fp.id FROM posts fp
+			JOIN followers f ON f.user_id = fp.user_id
+			WHERE f.follower_id = $1 AND fp.created_at > $2
+			ORDER BY fp.id DESC
+			LIMIT $3)
+			UNION
+			SELECT unnest($4::bigint[])
+		) AND
+		p.user_id <> $1 AND
+		p.hidden_at IS NULL AND
+		` + visibleAuthorSQL("p.user_id", "u.is_private", "$1") + ` AND
+		` + notMutedSQL("p.user_id", "$1")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, since, limit, pq.Array(popularIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []ranking.Candidate{}
+	for rows.Next() {
+		var c ranking.Candidate
+		err := rows.Scan(
+			&c.PostID,
+			&c.AuthorID,
+			&c.CreatedAt,
+			pq.Array(&c.Tags),
+			&c.Comments,
+			&c.Reactions,
+			&c.Reposts,
+			&c.Followed)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// GetSignals measures how much userID interacted with each author and tag
+// through comments, reactions and reposts since since. Affinities are
+// relative to the author and tag interacted with the most.
+func (s *RankingStore) GetSignals(ctx context.Context, userID int64, since time.Time) (ranking.Signals, error) {
+	interactions := `
+	WITH interactions AS (
+		SELECT post_id FROM comments WHERE user_id = $1 AND created_at > $2
+		UNION ALL
+		SELECT post_id FROM post_reactions WHERE user_id = $1 AND created_at > $2
+		UNION ALL
+		SELECT post_id FROM reposts WHERE user_id = $1 AND created_at > $2
+	)`
+	authorsQuery := interactions + `
+	SELECT p.user_id, COUNT(*)
+	FROM interactions i
+	JOIN posts p ON p.id = i.post_id
+	WHERE p.user_id <> $1
+	GROUP BY p.user_id`
+	tagsQuery := interactions + `
+	SELECT t.name, COUNT(*)
+	FROM interactions i
+	JOIN post_tags pt ON pt.post_id = i.post_id
+	JOIN tags t ON t.id = pt.tag_id
+	GROUP BY t.name
+	ORDER BY COUNT(*) DESC
+	LIMIT 100`
+
+	signals := ranking.Signals{
+		AuthorAffinity: map[int64]float64{},
+		TagAffinity:    map[string]float64{},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, authorsQuery, userID, since)
+	if err != nil {
+		return signals, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var n float64
+		if err := rows.Scan(&id, &n); err != nil {
+			return signals, err
+		}
+		signals.AuthorAffinity[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return signals, err
+	}
+
+	tagRows, err := s.db.QueryContext(ctx, tagsQuery, userID, since)
+	if err != nil {
+		return signals, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var tag string
+		var n float64
+		if err := tagRows.Scan(&tag, &n); err != nil {
+			return signals, err
+		}
+		signals.TagAffinity[tag] = n
+	}
+	if err := tagRows.Err(); err != nil {
+		return signals, err
+	}
+
+	normalize(signals.AuthorAffinity)
+	normalize(signals.TagAffinity)
+	return signals, nil
+}
+
+// normalize scales the counts in m so that the highest one becomes 1.
+func normalize[K comparable](m map[K]float64) {
+	max := 0.0
+	for _, v := range m {
+		max = math.Max(max, v)
+	}
+	if max == 0 {
+		return
+	}
+	for k, v := range m {
+		m[k] = v / max
+	}
+}
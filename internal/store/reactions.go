@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type Reaction struct {
+	PostID    int64  `json:"post_id"`
+	UserID    int64  `json:"user_id"`
+	Kind      string `json:"kind"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ReactionsStore struct {
+	db *sql.DB
+}
+
+// React sets the reaction of a user on a post, replacing any previous one.
+// Users that blocked each other cannot react to each other's posts.
+func (s *ReactionsStore) React(ctx context.Context, reaction *Reaction) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		authorID, err := postAuthor(ctx, tx, reaction.PostID)
+		if err != nil {
+			return err
+		}
+		blocked, err := isBlocked(ctx, tx, reaction.UserID, authorID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		query := `
+		INSERT INTO post_reactions (post_id, user_id, kind) VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id) DO UPDATE SET kind = EXCLUDED.kind
+		RETURNING created_at`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		return tx.QueryRowContext(ctx, query,
+			reaction.PostID, reaction.UserID, reaction.Kind).Scan(&reaction.CreatedAt)
+	})
+}
+
+func (s *ReactionsStore) Unreact(ctx context.Context, postID, userID int64) error {
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID)
+	return err
+}
+
+func postAuthor(ctx context.Context, q queryRower, postID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var authorID int64
+	err := q.QueryRowContext(ctx, `SELECT user_id FROM posts WHERE id = $1`, postID).Scan(&authorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return authorID, nil
+}
@@ -0,0 +1,418 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrInvalidAction = errors.New("action does not apply to the reported target")
+	// ErrOutranked is returned when a moderator decides about themselves or
+	// about a user whose role is not below theirs.
+	ErrOutranked = errors.New("target is the moderator or holds an equal or higher role")
+)
+
+const (
+	ReportOpen     = "open"
+	ReportClaimed  = "claimed"
+	ReportResolved = "resolved"
+)
+
+var (
+	ReportTargets     = []string{"post", "comment", "user"}
+	ReportReasons     = []string{"spam", "harassment", "hate", "violence", "sexual", "misinformation", "other"}
+	ModerationActions = []string{"dismiss", "hide", "warn", "suspend"}
+)
+
+// Report aggregates the reports of one target until a moderator resolves
+// it. TargetUserID is the author of a reported post or comment, or the
+// reported user; it is nil once they are gone.
+type Report struct {
+	ID             int64            `json:"id"`
+	TargetType     string           `json:"target_type"`
+	TargetID       int64            `json:"target_id"`
+	TargetUserID   *int64           `json:"target_user_id"`
+	Status         string           `json:"status"`
+	ReportsCount   int64            `json:"reports_count"`
+	Reasons        map[string]int64 `json:"reasons"`
+	LastReportedAt string           `json:"last_reported_at"`
+	ClaimedBy      *int64           `json:"claimed_by"`
+	ClaimedAt      *string          `json:"claimed_at"`
+	ResolvedBy     *int64           `json:"resolved_by"`
+	ResolvedAt     *string          `json:"resolved_at"`
+	Action         *string          `json:"action"`
+	CreatedAt      string           `json:"created_at"`
+}
+
+type ReportEntry struct {
+	ID         int64  `json:"id"`
+	ReporterID int64  `json:"reporter_id"`
+	Username   string `json:"username"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// ModerationAction records a decision of a moderator: claiming a report or
+// resolving it.
+type ModerationAction struct {
+	ID          int64  `json:"id"`
+	ReportID    *int64 `json:"report_id"`
+	ModeratorID *int64 `json:"moderator_id"`
+	Action      string `json:"action"`
+	TargetType  string `json:"target_type"`
+	TargetID    int64  `json:"target_id"`
+	Note        string `json:"note"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type NewReport struct {
+	ReporterID int64
+	TargetType string
+	TargetID   int64
+	Reason     string
+	Details    string
+}
+
+type Resolution struct {
+	Action string
+	Note   string
+	// SuspendFor is how long a suspended user stays suspended.
+	SuspendFor time.Duration
+}
+
+type ReportsStore struct {
+	db *sql.DB
+}
+
+// Create files a report, adding it to the unresolved report of its target
+// if there is one. Reporting a target twice fails with ErrConflict.
+func (s *ReportsStore) Create(ctx context.Context, nr NewReport) (int64, error) {
+	var id int64
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		var exists bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT CASE $1
+				WHEN 'post' THEN EXISTS (SELECT 1 FROM posts WHERE id = $2)
+				WHEN 'comment' THEN EXISTS (SELECT 1 FROM comments WHERE id = $2)
+				ELSE EXISTS (SELECT 1 FROM users WHERE id = $2)
+			END`, nr.TargetType, nr.TargetID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO reports (target_type, target_id, reports_count) VALUES ($1, $2, 1)
+			ON CONFLICT (target_type, target_id) WHERE status <> 'resolved' DO UPDATE
+				SET reports_count = reports.reports_count + 1, last_reported_at = NOW()
+			RETURNING id`, nr.TargetType, nr.TargetID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO report_entries (report_id, reporter_id, reason, details) VALUES ($1, $2, $3, $4)`,
+			id, nr.ReporterID, nr.Reason, nr.Details)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+		return nil
+	})
+	return id, err
+}
+
+const reportColumns = `r.id, r.target_type, r.target_id,
+	CASE r.target_type
+		WHEN 'post' THEN (SELECT p.user_id FROM posts p WHERE p.id = r.target_id)
+		WHEN 'comment' THEN (SELECT c.user_id FROM comments c WHERE c.id = r.target_id)
+		ELSE (SELECT u.id FROM users u WHERE u.id = r.target_id)
+	END,
+	r.status, r.reports_count,
+	(SELECT json_object_agg(e.reason, e.n) FROM (
+		SELECT reason, COUNT(*) AS n FROM report_entries WHERE report_id = r.id GROUP BY reason) e),
+	r.last_reported_at, r.claimed_by, r.claimed_at, r.resolved_by, r.resolved_at, r.action, r.created_at`
+
+func scanReport(row interface{ Scan(...any) error }, r *Report) error {
+	var reasons []byte
+	err := row.Scan(&r.ID, &r.TargetType, &r.TargetID, &r.TargetUserID, &r.Status, &r.ReportsCount, &reasons,
+		&r.LastReportedAt, &r.ClaimedBy, &r.ClaimedAt, &r.ResolvedBy, &r.ResolvedAt, &r.Action, &r.CreatedAt)
+	if err != nil {
+		return err
+	}
+	r.Reasons = map[string]int64{}
+	if reasons != nil {
+		return json.Unmarshal(reasons, &r.Reasons)
+	}
+	return nil
+}
+
+// GetAll returns the reports with the given status and, when set, target
+// type. The most reported targets come first.
+func (s *ReportsStore) GetAll(ctx context.Context, status, targetType string, pq PaginationQuery) ([]Report, error) {
+	query := `
+	SELECT ` + reportColumns + `
+	FROM reports r
+	WHERE r.status = $1 AND ($2 = '' OR r.target_type = $2)
+	ORDER BY r.reports_count DESC, r.last_reported_at DESC, r.id DESC
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, status, targetType, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var r Report
+		if err := scanReport(rows, &r); err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+func (s *ReportsStore) GetByID(ctx context.Context, id int64) (*Report, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	return getReport(ctx, s.db, id)
+}
+
+func getReport(ctx context.Context, q queryRower, id int64) (*Report, error) {
+	var r Report
+	err := scanReport(q.QueryRowContext(ctx, `SELECT `+reportColumns+` FROM reports r WHERE r.id = $1`, id), &r)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetEntries returns the individual reports aggregated into a report,
+// oldest first.
+func (s *ReportsStore) GetEntries(ctx context.Context, reportID int64, pq PaginationQuery) ([]ReportEntry, error) {
+	query := `
+	SELECT e.id, e.reporter_id, u.username, e.reason, e.details, e.created_at
+	FROM report_entries e
+	JOIN users u ON u.id = e.reporter_id
+	WHERE e.report_id = $1
+	ORDER BY e.created_at, e.id
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, reportID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ReportEntry{}
+	for rows.Next() {
+		var e ReportEntry
+		if err := rows.Scan(&e.ID, &e.ReporterID, &e.Username, &e.Reason, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// lockReport locks an unresolved report for moderatorID. Reports that are
+// resolved or claimed by another moderator fail with ErrConflict.
+func lockReport(ctx context.Context, tx *sql.Tx, id, moderatorID int64) (*Report, error) {
+	var status string
+	var claimedBy sql.NullInt64
+	err := tx.QueryRowContext(ctx,
+		`SELECT status, claimed_by FROM reports WHERE id = $1 FOR UPDATE`, id).Scan(&status, &claimedBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if status == ReportResolved || (status == ReportClaimed && claimedBy.Int64 != moderatorID) {
+		return nil, ErrConflict
+	}
+	return getReport(ctx, tx, id)
+}
+
+func recordAction(ctx context.Context, tx *sql.Tx, r *Report, moderatorID int64, action, note string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO moderation_actions (report_id, moderator_id, action, target_type, target_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		r.ID, moderatorID, action, r.TargetType, r.TargetID, note)
+	return err
+}
+
+// Claim assigns an open report to moderatorID so other moderators leave it
+// to them.
+func (s *ReportsStore) Claim(ctx context.Context, id, moderatorID int64) (*Report, error) {
+	var report *Report
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		r, err := lockReport(ctx, tx, id, moderatorID)
+		if err != nil {
+			return err
+		}
+		if r.Status == ReportClaimed {
+			report = r
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE reports SET status = 'claimed', claimed_by = $2, claimed_at = NOW() WHERE id = $1`, id, moderatorID)
+		if err != nil {
+			return err
+		}
+		if err := recordAction(ctx, tx, r, moderatorID, "claim", ""); err != nil {
+			return err
+		}
+		report, err = getReport(ctx, tx, id)
+		return err
+	})
+	return report, err
+}
+
+// checkOutranks fails with ErrOutranked when moderatorID may not take
+// action against the user behind a report: nobody resolves reports about
+// themselves, and only users of a lower role can be acted against.
+func checkOutranks(ctx context.Context, tx *sql.Tx, moderatorID int64, r *Report, action string) error {
+	if r.TargetUserID == nil {
+		return nil
+	}
+	if *r.TargetUserID == moderatorID {
+		return ErrOutranked
+	}
+	if action == "dismiss" {
+		return nil
+	}
+
+	var outranked bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT tr.level >= mr.level
+		FROM users t JOIN roles tr ON tr.id = t.role_id, users m JOIN roles mr ON mr.id = m.role_id
+		WHERE t.id = $1 AND m.id = $2`, *r.TargetUserID, moderatorID).Scan(&outranked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if outranked {
+		return ErrOutranked
+	}
+	return nil
+}
+
+// Resolve applies the decision of moderatorID to a report and closes it:
+// hiding the reported post or comment, or suspending the user behind the
+// target. Dismissing and warning change nothing but the report, the caller
+// tells the user about warnings. Reports about the moderator, and actions
+// against users of the same or a higher role, fail with ErrOutranked.
+func (s *ReportsStore) Resolve(ctx context.Context, id, moderatorID int64, res Resolution) (*Report, error) {
+	var report *Report
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		r, err := lockReport(ctx, tx, id, moderatorID)
+		if err != nil {
+			return err
+		}
+		if err := checkOutranks(ctx, tx, moderatorID, r, res.Action); err != nil {
+			return err
+		}
+
+		switch res.Action {
+		case "hide":
+			switch r.TargetType {
+			case "post":
+				_, err = tx.ExecContext(ctx, `UPDATE posts SET hidden_at = NOW() WHERE id = $1`, r.TargetID)
+			case "comment":
+				_, err = tx.ExecContext(ctx, `UPDATE comments SET hidden_at = NOW() WHERE id = $1`, r.TargetID)
+			default:
+				return ErrInvalidAction
+			}
+		case "warn", "suspend":
+			if r.TargetUserID == nil {
+				return ErrNotFound
+			}
+			if res.Action == "suspend" {
+				_, err = tx.ExecContext(ctx,
+					`UPDATE users SET suspended_until = NOW() + make_interval(secs => $2) WHERE id = $1`,
+					*r.TargetUserID, res.SuspendFor.Seconds())
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE reports SET status = 'resolved', resolved_by = $2, resolved_at = NOW(), action = $3
+			WHERE id = $1`, id, moderatorID, res.Action)
+		if err != nil {
+			return err
+		}
+		if err := recordAction(ctx, tx, r, moderatorID, res.Action, res.Note); err != nil {
+			return err
+		}
+		report, err = getReport(ctx, tx, id)
+		return err
+	})
+	return report, err
+}
+
+// GetActions returns the moderation decisions about a target, or all of
+// them when targetType is empty, latest first.
+func (s *ReportsStore) GetActions(ctx context.Context, targetType string, targetID int64, pq PaginationQuery) ([]ModerationAction, error) {
+	query := `
+	SELECT id, report_id, moderator_id, action, target_type, target_id, note, created_at
+	FROM moderation_actions
+	WHERE $1 = '' OR (target_type = $1 AND target_id = $2)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, targetType, targetID, pq.Limit, pq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []ModerationAction{}
+	for rows.Next() {
+		var a ModerationAction
+		err := rows.Scan(&a.ID, &a.ReportID, &a.ModeratorID, &a.Action, &a.TargetType, &a.TargetID, &a.Note, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReports(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	author := newTestUser(t, db, "user")
+	first := newTestUser(t, db, "user")
+	second := newTestUser(t, db, "user")
+	moderator := newTestUser(t, db, "moderator")
+	other := newTestUser(t, db, "moderator")
+	admin := newTestUser(t, db, "admin")
+
+	report := func(reporterID int64, targetType string, targetID int64, reason string) int64 {
+		t.Helper()
+		id, err := s.Reports.Create(ctx, NewReport{ReporterID: reporterID, TargetType: targetType, TargetID: targetID, Reason: reason})
+		checkErr(t, nil, err)
+		return id
+	}
+
+	t.Run("should aggregate the reports of a target", func(t *testing.T) {
+		post := newTestPost(t, db, author)
+		id := report(first, "post", post, "spam")
+		if again := report(second, "post", post, "harassment"); again != id {
+			t.Fatalf("expected reports to be aggregated into %d, got %d", id, again)
+		}
+		_, err := s.Reports.Create(ctx, NewReport{ReporterID: first, TargetType: "post", TargetID: post, Reason: "other"})
+		checkErr(t, ErrConflict, err)
+		_, err = s.Reports.Create(ctx, NewReport{ReporterID: first, TargetType: "post", TargetID: post + 1000000, Reason: "spam"})
+		checkErr(t, ErrNotFound, err)
+
+		r, err := s.Reports.GetByID(ctx, id)
+		checkErr(t, nil, err)
+		if r.ReportsCount != 2 || r.Reasons["spam"] != 1 || r.Reasons["harassment"] != 1 {
+			t.Errorf("expected 2 reports with their reasons, got %+v", r)
+		}
+		if r.TargetUserID == nil || *r.TargetUserID != author {
+			t.Errorf("expected the report to be about the author, got %v", r.TargetUserID)
+		}
+	})
+
+	t.Run("should leave claimed and resolved reports alone", func(t *testing.T) {
+		id := report(first, "post", newTestPost(t, db, author), "spam")
+		_, err := s.Reports.Claim(ctx, id, moderator)
+		checkErr(t, nil, err)
+		_, err = s.Reports.Claim(ctx, id, moderator)
+		checkErr(t, nil, err)
+		_, err = s.Reports.Claim(ctx, id, other)
+		checkErr(t, ErrConflict, err)
+		_, err = s.Reports.Resolve(ctx, id, other, Resolution{Action: "dismiss"})
+		checkErr(t, ErrConflict, err)
+
+		_, err = s.Reports.Resolve(ctx, id, moderator, Resolution{Action: "dismiss"})
+		checkErr(t, nil, err)
+		_, err = s.Reports.Resolve(ctx, id, moderator, Resolution{Action: "dismiss"})
+		checkErr(t, ErrConflict, err)
+	})
+
+	t.Run("should open a new report once resolved", func(t *testing.T) {
+		post := newTestPost(t, db, author)
+		id := report(first, "post", post, "spam")
+		_, err := s.Reports.Resolve(ctx, id, moderator, Resolution{Action: "dismiss"})
+		checkErr(t, nil, err)
+
+		if again := report(second, "post", post, "spam"); again == id {
+			t.Error("expected a new report after the resolution")
+		}
+	})
+
+	t.Run("should hide reported posts only", func(t *testing.T) {
+		id := report(first, "user", author, "spam")
+		_, err := s.Reports.Resolve(ctx, id, moderator, Resolution{Action: "hide"})
+		checkErr(t, ErrInvalidAction, err)
+
+		post := newTestPost(t, db, author)
+		id = report(first, "post", post, "spam")
+		_, err = s.Reports.Resolve(ctx, id, moderator, Resolution{Action: "hide"})
+		checkErr(t, nil, err)
+		p, err := s.Posts.GetByID(ctx, post)
+		checkErr(t, nil, err)
+		if !p.Hidden {
+			t.Error("expected the post to be hidden")
+		}
+	})
+
+	t.Run("should only act against users of a lower role", func(t *testing.T) {
+		for _, target := range []int64{moderator, other, admin} {
+			id := report(first, "post", newTestPost(t, db, target), "spam")
+			for _, action := range []string{"hide", "warn", "suspend"} {
+				_, err := s.Reports.Resolve(ctx, id, moderator, Resolution{Action: action, SuspendFor: time.Hour})
+				checkErr(t, ErrOutranked, err)
+			}
+		}
+
+		id := report(first, "post", newTestPost(t, db, moderator), "spam")
+		_, err := s.Reports.Resolve(ctx, id, moderator, Resolution{Action: "dismiss"})
+		checkErr(t, ErrOutranked, err)
+
+		id = report(first, "post", newTestPost(t, db, other), "spam")
+		_, err = s.Reports.Resolve(ctx, id, moderator, Resolution{Action: "dismiss"})
+		checkErr(t, nil, err)
+
+		id = report(first, "user", moderator, "spam")
+		_, err = s.Reports.Resolve(ctx, id, admin, Resolution{Action: "suspend", SuspendFor: time.Hour})
+		checkErr(t, nil, err)
+	})
+}
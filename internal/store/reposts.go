@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type RepostsStore struct {
+	db *sql.DB
+}
+
+// Repost shares a post with the followers of userID. Reposting twice is a
+// no-op, and users that blocked each other cannot repost each other's posts.
+func (s *RepostsStore) Repost(ctx context.Context, postID, userID int64) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		authorID, err := postAuthor(ctx, tx, postID)
+		if err != nil {
+			return err
+		}
+		blocked, err := isBlocked(ctx, tx, userID, authorID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+
+		query := `
+		INSERT INTO reposts (user_id, post_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, post_id) DO NOTHING`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		_, err = tx.ExecContext(ctx, query, userID, postID)
+		return err
+	})
+}
+
+func (s *RepostsStore) Unrepost(ctx context.Context, postID, userID int64) error {
+	query := `DELETE FROM reposts WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, postID)
+	return err
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+type UserSearchResult struct {
+	ID             int64   `json:"id"`
+	Username       string  `json:"username"`
+	DisplayName    string  `json:"display_name"`
+	AvatarURL      string  `json:"avatar_url"`
+	IsFollowedByMe bool    `json:"is_followed_by_me"`
+	Score          float64 `json:"score"`
+}
+
+// followBoost is added to the score of accounts the viewer already follows.
+const followBoost = 0.25
+
+// Search finds active users whose username or display name resembles q,
+// best matches first. Users blocked in either direction are left out.
+func (s *UsersStore) Search(ctx context.Context, q string, viewerID int64, pq PaginationQuery) ([]UserSearchResult, error) {
+	query := `
+	SELECT id, username, display_name, avatar_url, followed,
+		similarity_score + CASE WHEN followed THEN $5::float8 ELSE 0 END AS score
+	FROM (
+		SELECT u.id, u.username, u.display_name, u.avatar_url,
+			EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $2) AS followed,
+			GREATEST(similarity(u.username, $1), similarity(u.display_name, $1))
+				+ CASE WHEN u.username ILIKE $6 THEN 0.2 ELSE 0 END AS similarity_score
+		FROM users u
+		WHERE u.is_active AND
+			(u.username % $1 OR u.display_name % $1 OR u.username ILIKE $6 OR u.display_name ILIKE $6) AND
+			` + notBlockedSQL("u.id", "$2") + `
+	) matches
+	ORDER BY score DESC, id ASC
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q, viewerID, pq.Limit, pq.Offset, followBoost, likePrefix(q))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []UserSearchResult{}
+	for rows.Next() {
+		var r UserSearchResult
+		err := rows.Scan(&r.ID, &r.Username, &r.DisplayName, &r.AvatarURL, &r.IsFollowedByMe, &r.Score)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// likePrefix turns s into a LIKE pattern matching values that start with s.
+func likePrefix(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s) + "%"
+}
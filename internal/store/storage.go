@@ -4,6 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"project/internal/events"
+	"project/internal/ranking"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,49 +23,277 @@ type Storage struct {
 		Delete(context.Context, int64) error
 		Edit(context.Context, *Post) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		Search(context.Context, int64, PostSearchQuery) ([]PostSearchResult, error)
+		GetByTag(context.Context, string, int64, PaginationQuery) ([]PostWithMetadata, error)
+		GetMentions(context.Context, []int64) (map[int64][]Mention, error)
+		GetByIDs(context.Context, int64, []int64) ([]PostWithMetadata, error)
+		GetTimelineIDs(context.Context, int64, int64, int) ([]int64, error)
+		GetLargeAccountPosts(context.Context, int64, int64, int64, string, int) ([]PostWithMetadata, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
 		GetByID(context.Context, int64) (*User, error)
 		CreateAndInvite(context.Context, *User, string, time.Duration) error
-		Activate(context.Context, string) error
+		Activate(context.Context, string) (*User, error)
 		Delete(context.Context, int64) error
 		GetByEmail(context.Context, string) (*User, error)
+		SetPrivacy(context.Context, int64, bool) error
+		UpdateProfile(context.Context, *User, time.Duration, *EmailChange) error
+		ConfirmEmailChange(context.Context, string) (*User, error)
+		ScheduleDeletion(context.Context, int64, time.Time) error
+		CancelDeletion(context.Context, int64) error
+		GetDueForDeletion(context.Context, time.Time, int) ([]int64, error)
+		Search(context.Context, string, int64, PaginationQuery) ([]UserSearchResult, error)
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByPostID(context.Context, int64, int64) ([]Comment, error)
+		GetParticipantIDs(context.Context, int64) ([]int64, error)
+	}
+	Reactions interface {
+		React(context.Context, *Reaction) error
+		Unreact(context.Context, int64, int64) error
+	}
+	Reposts interface {
+		Repost(context.Context, int64, int64) error
+		Unrepost(context.Context, int64, int64) error
+	}
+	Ranking interface {
+		GetCandidates(context.Context, int64, time.Time, int, []int64) ([]ranking.Candidate, error)
+		GetSignals(context.Context, int64, time.Time) (ranking.Signals, error)
+	}
+	Trending interface {
+		TopPosts(context.Context, TrendingWindow, TrendingWeights, time.Time, int) ([]TrendingPost, error)
+		TopTags(context.Context, TrendingWindow, TrendingWeights, time.Time, int) ([]TrendingTag, error)
+		Exclusive(context.Context, func(context.Context) error) (bool, error)
 	}
 
 	Followers interface {
-		Follow(context.Context, int64, int64) error
+		Follow(context.Context, int64, int64) (FollowStatus, error)
 		Unfollow(context.Context, int64, int64) error
+		GetFollowers(context.Context, int64, int64, PaginationQuery) ([]FollowListItem, error)
+		GetFollowing(context.Context, int64, int64, PaginationQuery) ([]FollowListItem, error)
+		GetRelationship(context.Context, int64, int64) (*Relationship, error)
+		GetFollowRequests(context.Context, int64, PaginationQuery) ([]FollowRequest, error)
+		ApproveRequest(context.Context, int64, int64) error
+		RejectRequest(context.Context, int64, int64) error
+		GetFollowerIDs(context.Context, int64) ([]int64, error)
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	Blocks interface {
+		Block(context.Context, int64, int64) error
+		Unblock(context.Context, int64, int64) error
+		IsBlocked(context.Context, int64, int64) (bool, error)
+		GetBlocked(context.Context, int64, PaginationQuery) ([]BlockedUser, error)
+	}
+	Media interface {
+		Create(context.Context, *Media) error
+		GetByIDs(context.Context, int64, []int64) ([]Media, error)
+		GetByPostID(context.Context, int64) ([]Media, error)
+		GetKeysByUserID(context.Context, int64) ([]string, error)
+	}
+	Export interface {
+		Export(context.Context, int64) (*UserExport, error)
+	}
+	Mutes interface {
+		Mute(context.Context, int64, int64) error
+		Unmute(context.Context, int64, int64) error
+		GetMuted(context.Context, int64, PaginationQuery) ([]BlockedUser, error)
+	}
+	Notifications interface {
+		Create(context.Context, NewNotification, []int64) ([]int64, error)
+		GetByUserID(context.Context, int64, bool, PaginationQuery) ([]Notification, error)
+		UnreadCount(context.Context, int64) (int, error)
+		MarkRead(context.Context, int64, int64) error
+		MarkAllRead(context.Context, int64) error
+		GetPreferences(context.Context, int64) (map[string]bool, error)
+		SetPreferences(context.Context, int64, map[string]bool) error
+	}
+	Digests interface {
+		GetFrequency(context.Context, int64) (string, error)
+		SetFrequency(context.Context, int64, string) error
+		GetDue(context.Context, string, time.Time, int) ([]DigestRecipient, error)
+		Claim(context.Context, int64, time.Time) (bool, error)
+		MarkSent(context.Context, int64, time.Time) error
+		GetContent(context.Context, int64, time.Time, time.Time, int) (*DigestContent, error)
+	}
+	Webhooks interface {
+		Create(context.Context, *Webhook) error
+		GetByID(context.Context, int64, int64) (*Webhook, error)
+		GetByUserID(context.Context, int64) ([]Webhook, error)
+		Update(context.Context, *Webhook) error
+		Delete(context.Context, int64, int64) error
+		Enqueue(context.Context, string, []int64, []byte) error
+		ClaimDeliveries(context.Context, int, time.Duration) ([]WebhookDelivery, error)
+		RecordSuccess(context.Context, *WebhookDelivery, int) error
+		RecordFailure(context.Context, *WebhookDelivery, int, string, *time.Time, int) (bool, error)
+		GetDeliveries(context.Context, int64, PaginationQuery) ([]WebhookDelivery, error)
+	}
+	Messages interface {
+		Start(context.Context, int64, []int64) (int64, bool, error)
+		GetByUserID(context.Context, int64, PaginationQuery) ([]Conversation, error)
+		GetConversation(context.Context, int64, int64) (*Conversation, error)
+		Send(context.Context, *Message) ([]int64, error)
+		GetMessages(context.Context, int64, int64, MessageQuery) ([]Message, error)
+		MarkRead(context.Context, int64, int64) error
+		UnreadCount(context.Context, int64) (int, error)
+		GetFollowersOnly(context.Context, int64) (bool, error)
+		SetFollowersOnly(context.Context, int64, bool) error
+	}
+	Lists interface {
+		Create(context.Context, *List) error
+		GetByID(context.Context, int64, int64) (*List, error)
+		GetByUserID(context.Context, int64, int64) ([]List, error)
+		Update(context.Context, *List) error
+		Delete(context.Context, int64, int64) error
+		AddMember(context.Context, int64, int64, int64) error
+		RemoveMember(context.Context, int64, int64, int64) error
+		GetMembers(context.Context, int64, int64, PaginationQuery) ([]ListMember, error)
+		GetFeed(context.Context, int64, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+	}
+	Communities interface {
+		Create(context.Context, *Community) error
+		GetByID(context.Context, int64) (*Community, error)
+		GetAll(context.Context, string, PaginationQuery) ([]Community, error)
+		Update(context.Context, *Community) error
+		Delete(context.Context, int64) error
+		GetMember(context.Context, int64, int64) (*CommunityMember, error)
+		GetMembers(context.Context, int64, string, PaginationQuery) ([]CommunityMember, error)
+		Join(context.Context, int64, int64) (string, error)
+		Invite(context.Context, int64, int64) (string, error)
+		Approve(context.Context, int64, int64) error
+		RemoveMember(context.Context, int64, int64) error
+		SetRole(context.Context, int64, int64, string) error
+		GetFeed(context.Context, int64, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+	}
+	Polls interface {
+		GetByPostIDs(context.Context, int64, []int64) (map[int64]*Poll, error)
+		Vote(context.Context, int64, int64, []int64) error
+		Freeze(context.Context, int) (int64, error)
+	}
+	Reports interface {
+		Create(context.Context, NewReport) (int64, error)
+		GetAll(context.Context, string, string, PaginationQuery) ([]Report, error)
+		GetByID(context.Context, int64) (*Report, error)
+		GetEntries(context.Context, int64, PaginationQuery) ([]ReportEntry, error)
+		Claim(context.Context, int64, int64) (*Report, error)
+		Resolve(context.Context, int64, int64, Resolution) (*Report, error)
+		GetActions(context.Context, string, int64, PaginationQuery) ([]ModerationAction, error)
+	}
+
+	db *sql.DB
+}
+
+type txKey struct{}
+
+// storeTx is the transaction a context runs in, until it ends.
+type storeTx struct {
+	tx   *sql.Tx
+	done atomic.Bool
 }
 
-func withTx(db *sql.DB, ctx context.Context, f func(*sql.Tx) error) error {
+// conner is what queries run on: the database or a transaction.
+type conner interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction ctx runs in, if any is still open, or db.
+func conn(ctx context.Context, db *sql.DB) conner {
+	if tx := openTx(ctx); tx != nil {
+		return tx
+	}
+	return db
+}
+
+func openTx(ctx context.Context) *sql.Tx {
+	if current, ok := ctx.Value(txKey{}).(*storeTx); ok && !current.done.Load() {
+		return current.tx
+	}
+	return nil
+}
+
+// withTx runs f in a transaction, or in the one ctx already runs in. Events
+// published with the context f is given are only delivered once the
+// transaction commits, and InTx subscribers that fail roll it back.
+func withTx(db *sql.DB, ctx context.Context, f func(context.Context, *sql.Tx) error) error {
+	if tx := openTx(ctx); tx != nil {
+		return f(ctx, tx)
+	}
+
+	ctx, pending := events.Begin(ctx)
+	defer pending.Rollback()
+
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-
-	if err := f(tx); err != nil {
+	current := &storeTx{tx: tx}
+	err = f(context.WithValue(ctx, txKey{}, current), tx)
+	current.done.Store(true)
+	if err == nil {
+		err = pending.Err()
+	}
+	if err != nil {
 		_ = tx.Rollback()
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	pending.Commit()
+	return nil
+}
+
+// InTx runs fn in a transaction that the store calls made with its context
+// take part in, so that a change and what it triggers, such as queued
+// webhooks, are saved together.
+func (s Storage) InTx(ctx context.Context, fn func(context.Context) error) error {
+	if s.db == nil {
+		ctx, pending := events.Begin(ctx)
+		defer pending.Rollback()
+
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		if err := pending.Err(); err != nil {
+			return err
+		}
+		pending.Commit()
+		return nil
+	}
+	return withTx(s.db, ctx, func(ctx context.Context, _ *sql.Tx) error {
+		return fn(ctx)
+	})
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostsStore{db},
-		Users:     &UsersStore{db},
-		Comments:  &CommentsStore{db},
-		Followers: &FollowerStore{db},
-		Roles:     &RolesStorage{db},
+		Posts:         &PostsStore{db},
+		Users:         &UsersStore{db},
+		Comments:      &CommentsStore{db},
+		Followers:     &FollowerStore{db},
+		Roles:         &RolesStorage{db},
+		Reactions:     &ReactionsStore{db},
+		Reposts:       &RepostsStore{db},
+		Trending:      &TrendingStore{db},
+		Ranking:       &RankingStore{db},
+		Blocks:        &BlocksStore{db},
+		Mutes:         &MutesStore{db},
+		Media:         &MediaStore{db},
+		Export:        &ExportStore{db},
+		Notifications: &NotificationsStore{db},
+		Digests:       &DigestsStore{db},
+		Webhooks:      &WebhooksStore{db},
+		Messages:      &MessagesStore{db},
+		Lists:         &ListsStore{db},
+		Communities:   &CommunitiesStore{db},
+		Polls:         &PollsStore{db},
+		Reports:       &ReportsStore{db},
+		db:            db,
 	}
 }
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"project/internal/richtext"
+)
+
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// syncEntities links the post to its normalized tags and to the users its
+// content mentions, replacing whatever was linked before. Mentions of
+// unknown usernames are dropped.
+func syncEntities(ctx context.Context, tx *sql.Tx, post *Post) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_tags WHERE post_id = $1`, post.ID); err != nil {
+		return err
+	}
+	if len(post.Tags) > 0 {
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO tags (name) SELECT unnest($1::varchar[])
+		ON CONFLICT (name) DO NOTHING`, pq.Array(post.Tags))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_tags (post_id, tag_id)
+		SELECT $1, id FROM tags WHERE name = ANY($2)`, post.ID, pq.Array(post.Tags))
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_mentions WHERE post_id = $1`, post.ID); err != nil {
+		return err
+	}
+	post.Mentions = []Mention{}
+	entities := richtext.Parse(post.Content).Mentions
+	if len(entities) == 0 {
+		return nil
+	}
+
+	usernames := make([]string, len(entities))
+	for i, e := range entities {
+		usernames[i] = e.Value
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, username FROM users WHERE username = ANY($1) AND is_active`, pq.Array(usernames))
+	if err != nil {
+		return err
+	}
+	ids := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			rows.Close()
+			return err
+		}
+		ids[username] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range entities {
+		id, ok := ids[e.Value]
+		if !ok {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO post_mentions (post_id, user_id, start_offset, end_offset) VALUES ($1, $2, $3, $4)`,
+			post.ID, id, e.Start, e.End)
+		if err != nil {
+			return err
+		}
+		post.Mentions = append(post.Mentions, Mention{UserID: id, Username: e.Value, Start: e.Start, End: e.End})
+	}
+	return nil
+}
+
+// GetMentions returns the resolved mentions of the given posts keyed by post ID.
+func (s *PostsStore) GetMentions(ctx context.Context, postIDs []int64) (map[int64][]Mention, error) {
+	query := `
+	SELECT pm.post_id, pm.user_id, u.username, pm.start_offset, pm.end_offset
+	FROM post_mentions pm
+	JOIN users u ON u.id = pm.user_id
+	WHERE pm.post_id = ANY($1)
+	ORDER BY pm.post_id, pm.start_offset`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := map[int64][]Mention{}
+	for rows.Next() {
+		var postID int64
+		var m Mention
+		if err := rows.Scan(&postID, &m.UserID, &m.Username, &m.Start, &m.End); err != nil {
+			return nil, err
+		}
+		mentions[postID] = append(mentions[postID], m)
+	}
+	return mentions, rows.Err()
+}
+
+// GetByTag lists the posts carrying tag that viewerID may see, newest first.
+func (s *PostsStore) GetByTag(ctx context.Context, tag string, viewerID int64, page PaginationQuery) ([]PostWithMetadata, error) {
+	query := `
+	SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.tags, u.username,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments_count
+	FROM tags t
+	JOIN post_tags pt ON pt.tag_id = t.id
+	JOIN posts p ON p.id = pt.post_id
+	JOIN users u ON u.id = p.user_id
+	WHERE t.name = $1 AND p.hidden_at IS NULL AND
+		` + visibleAuthorSQL("p.user_id", "u.is_private", "$2") + ` AND
+		` + notMutedSQL("p.user_id", "$2") + `
+	ORDER BY p.created_at DESC, p.id DESC
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, tag, viewerID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		err := rows.Scan(
+			&p.ID,
+			&p.UserId,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			pq.Array(&p.Tags),
+			&p.User.Username,
+			&p.CommentsCount)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"github.com/lib/pq"
+)
+
+// GetFollowerIDs lists the IDs of every user following userID, except those
+// who muted them.
+func (s *FollowerStore) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+	SELECT f.follower_id FROM followers f
+	WHERE f.user_id = $1 AND
+		` + notMutedSQL("$1", "f.follower_id")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetTimelineIDs returns the IDs of the newest posts of userID and of the
+// users they follow, newest first, leaving out authors with at least
+// maxFollowers followers. Those are read with GetLargeAccountPosts instead.
+func (s *PostsStore) GetTimelineIDs(ctx context.Context, userID, maxFollowers int64, limit int) ([]int64, error) {
+	query := `
+	SELECT p.id
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.user_id IN (
+			SELECT f.user_id FROM followers f WHERE f.follower_id = $1
+			UNION ALL
+			SELECT $1::bigint
+		) AND
+		(u.followers_count < $2 OR u.id = $1)
+	ORDER BY p.id DESC
+	LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, maxFollowers, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetLargeAccountPosts returns the newest posts below beforeID, or from the
+// newest on when it is 0, of the accounts with at least minFollowers
+// followers that userID follows and may see. since is the oldest day to
+// include.
+func (s *PostsStore) GetLargeAccountPosts(ctx context.Context, userID, minFollowers, beforeID int64, since string, limit int) ([]PostWithMetadata, error) {
+	query := `
+	SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.tags, p.community_id, u.username,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.hidden_at IS NULL) AS comments_count
+	FROM followers f
+	JOIN users u ON u.id = f.user_id
+	JOIN posts p ON p.user_id = u.id
+	WHERE f.follower_id = $1 AND
+		u.followers_count >= $2 AND
+		($3::bigint = 0 OR p.id < $3) AND
+		p.created_at >= $4::date AND
+		p.hidden_at IS NULL AND
+		` + visibleAuthorSQL("p.user_id", "u.is_private", "$1") + ` AND
+		` + notMutedSQL("p.user_id", "$1") + `
+	ORDER BY p.id DESC
+	LIMIT $5`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, minFollowers, beforeID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		err := rows.Scan(
+			&p.ID,
+			&p.UserId,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			pq.Array(&p.Tags),
+			&p.CommunityID,
+			&p.User.Username,
+			&p.CommentsCount)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTimelinePostsCommunity(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	author := newTestUser(t, db, "user")
+	reader := newTestUser(t, db, "user")
+	c := &Community{Name: fmt.Sprintf("timeline-%d", author), JoinPolicy: "open", CreatedBy: &author}
+	checkErr(t, nil, s.Communities.Create(ctx, c))
+	post := newTestPost(t, db, author)
+	mustExec(t, db, `UPDATE posts SET community_id = $1 WHERE id = $2`, c.ID, post)
+	mustExec(t, db, `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`, author, reader)
+
+	check := func(t *testing.T, posts []PostWithMetadata) {
+		t.Helper()
+		if len(posts) != 1 || posts[0].CommunityID == nil || *posts[0].CommunityID != c.ID {
+			t.Errorf("expected the post of community %d, got %+v", c.ID, posts)
+		}
+	}
+
+	t.Run("should return the community of cached posts", func(t *testing.T) {
+		posts, err := s.Posts.GetByIDs(ctx, reader, []int64{post})
+		checkErr(t, nil, err)
+		check(t, posts)
+	})
+
+	t.Run("should return the community of large account posts", func(t *testing.T) {
+		since := time.Now().AddDate(0, 0, -1).Format(time.DateOnly)
+		posts, err := s.Posts.GetLargeAccountPosts(ctx, reader, 0, 0, since, 10)
+		checkErr(t, nil, err)
+		check(t, posts)
+	})
+}
+
+func TestGetFollowerIDs(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	author := newTestUser(t, db, "user")
+	follower := newTestUser(t, db, "user")
+	muter := newTestUser(t, db, "user")
+	mustExec(t, db, `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2), ($1, $3)`, author, follower, muter)
+	checkErr(t, nil, s.Mutes.Mute(ctx, muter, author))
+
+	ids, err := s.Followers.GetFollowerIDs(ctx, author)
+	checkErr(t, nil, err)
+	if len(ids) != 1 || ids[0] != follower {
+		t.Errorf("expected only follower %d, got %v", follower, ids)
+	}
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TrendingWindow is a sliding window trending scores are computed over.
+// Every event inside the window counts for its weight halved once per
+// HalfLife of age, so recent activity dominates.
+type TrendingWindow struct {
+	Name     string
+	Duration time.Duration
+	HalfLife time.Duration
+}
+
+var TrendingWindows = []TrendingWindow{
+	{Name: "1h", Duration: time.Hour, HalfLife: 15 * time.Minute},
+	{Name: "24h", Duration: 24 * time.Hour, HalfLife: 6 * time.Hour},
+	{Name: "7d", Duration: 7 * 24 * time.Hour, HalfLife: 48 * time.Hour},
+}
+
+// TrendingWeights is how much one event of each kind adds to a score.
+// Posts only count towards the tags they carry.
+type TrendingWeights struct {
+	Post     float64
+	Comment  float64
+	Reaction float64
+	Repost   float64
+}
+
+type TrendingTag struct {
+	Tag   string  `json:"tag"`
+	Score float64 `json:"score"`
+}
+
+type TrendingPost struct {
+	PostID int64   `json:"post_id"`
+	Score  float64 `json:"score"`
+}
+
+type TrendingStore struct {
+	db *sql.DB
+}
+
+// trendingLockKey identifies the advisory lock held while scores are
+// computed.
+const trendingLockKey = 0x7472656e64
+
+// Exclusive runs fn while holding a database-wide advisory lock, so that
+// only one API instance computes the scores at a time. It reports false
+// without running fn when another instance holds the lock.
+func (s *TrendingStore) Exclusive(ctx context.Context, fn func(context.Context) error) (bool, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, trendingLockKey).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		// the lock goes with the session, so it must be released even when
+		// ctx is already cancelled
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, trendingLockKey)
+	}()
+
+	return true, fn(ctx)
+}
+
+// trendingEventsSQL lists the weighted engagement events since $1 as
+// (post_id, created_at, weight). Only public posts of active accounts count,
+// and hidden posts and comments do not.
+const trendingEventsSQL = `
+	SELECT e.post_id, e.created_at, e.weight FROM (
+		SELECT post_id, created_at, $3::float8 AS weight FROM comments WHERE created_at > $1 AND hidden_at IS NULL
+		UNION ALL
+		SELECT post_id, created_at, $4::float8 FROM post_reactions WHERE created_at > $1
+		UNION ALL
+		SELECT post_id, created_at, $5::float8 FROM reposts WHERE created_at > $1
+	) e
+	JOIN posts p ON p.id = e.post_id
+	JOIN users u ON u.id = p.user_id
+	WHERE p.hidden_at IS NULL AND u.is_active AND NOT u.is_private AND u.deletion_scheduled_at IS NULL`
+
+// decaySQL is the weight of an event row e at time $2 with the half-life in
+// seconds given by $6.
+const decaySQL = `e.weight * exp(-ln(2) * extract(epoch FROM $2::timestamptz - e.created_at) / $6::float8)`
+
+// TopPosts ranks the posts with the most decayed engagement in the window
+// ending at now.
+func (s *TrendingStore) TopPosts(ctx context.Context, window TrendingWindow, weights TrendingWeights, now time.Time, limit int) ([]TrendingPost, error) {
+	query := `
+	SELECT e.post_id, SUM(` + decaySQL + `) AS score
+	FROM (` + trendingEventsSQL + `) e
+	GROUP BY e.post_id
+	ORDER BY score DESC, e.post_id DESC
+	LIMIT $7`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query,
+		now.Add(-window.Duration),
+		now,
+		weights.Comment,
+		weights.Reaction,
+		weights.Repost,
+		window.HalfLife.Seconds(),
+		limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []TrendingPost{}
+	for rows.Next() {
+		var p TrendingPost
+		if err := rows.Scan(&p.PostID, &p.Score); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// TopTags ranks tags by the decayed engagement of the posts carrying them,
+// plus the posts themselves created in the window.
+func (s *TrendingStore) TopTags(ctx context.Context, window TrendingWindow, weights TrendingWeights, now time.Time, limit int) ([]TrendingTag, error) {
+	query := `
+	SELECT t.name, SUM(` + decaySQL + `) AS score
+	FROM (
+		` + trendingEventsSQL + `
+		UNION ALL
+		SELECT p.id, p.created_at, $8::float8 FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.created_at > $1 AND p.hidden_at IS NULL AND u.is_active AND NOT u.is_private
+			AND u.deletion_scheduled_at IS NULL
+	) e
+	JOIN post_tags pt ON pt.post_id = e.post_id
+	JOIN tags t ON t.id = pt.tag_id
+	GROUP BY t.name
+	ORDER BY score DESC, t.name
+	LIMIT $7`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query,
+		now.Add(-window.Duration),
+		now,
+		weights.Comment,
+		weights.Reaction,
+		weights.Repost,
+		window.HalfLife.Seconds(),
+		limit,
+		weights.Post)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.Score); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTrendingExclusive(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	var nested bool
+	ran, err := s.Trending.Exclusive(ctx, func(ctx context.Context) error {
+		var err error
+		nested, err = s.Trending.Exclusive(ctx, func(ctx context.Context) error { return nil })
+		return err
+	})
+	checkErr(t, nil, err)
+	if !ran || nested {
+		t.Errorf("expected only the outer computation to run, got %t and %t", ran, nested)
+	}
+
+	ran, err = s.Trending.Exclusive(ctx, func(ctx context.Context) error { return nil })
+	checkErr(t, nil, err)
+	if !ran {
+		t.Error("expected the lock to be released")
+	}
+}
+
+func TestTrendingHidden(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	author := newTestUser(t, db, "user")
+	visible := newTestPost(t, db, author)
+	hidden := newTestPost(t, db, author)
+	mustExec(t, db, `UPDATE posts SET hidden_at = NOW() WHERE id = $1`, hidden)
+	mustExec(t, db, `INSERT INTO tags (name) VALUES ('trendvisible'), ('trendhidden') ON CONFLICT DO NOTHING`)
+	mustExec(t, db, `INSERT INTO post_tags (post_id, tag_id) SELECT $1, id FROM tags WHERE name = 'trendvisible'`, visible)
+	mustExec(t, db, `INSERT INTO post_tags (post_id, tag_id) SELECT $1, id FROM tags WHERE name = 'trendhidden'`, hidden)
+	mustExec(t, db, `
+		INSERT INTO comments (post_id, user_id, content, hidden_at)
+		VALUES ($1, $3, 'shown', NULL), ($1, $3, 'hidden', NOW()), ($2, $3, 'shown', NULL)`, visible, hidden, author)
+
+	window := TrendingWindow{Name: "day", Duration: 24 * time.Hour, HalfLife: time.Hour}
+	weights := TrendingWeights{Post: 1, Comment: 1}
+
+	tags, err := s.Trending.TopTags(ctx, window, weights, time.Now().Add(time.Minute), 100)
+	checkErr(t, nil, err)
+	for _, tag := range tags {
+		if tag.Tag == "trendhidden" {
+			t.Errorf("expected the tag of the hidden post not to trend, got %+v", tag)
+		}
+	}
+
+	posts, err := s.Posts.GetByIDs(ctx, author, []int64{visible, hidden})
+	checkErr(t, nil, err)
+	if len(posts) != 1 || posts[0].CommentsCount != 1 {
+		t.Errorf("expected the visible post with 1 visible comment, got %+v", posts)
+	}
+}
@@ -13,6 +13,7 @@ import (
 var (
 	ErrDuplicateEmail    = errors.New("duplicate email")
 	ErrDuplicateUsername = errors.New("duplicate username")
+	ErrUsernameCooldown  = errors.New("username was changed too recently")
 )
 
 type User struct {
@@ -22,8 +23,24 @@ type User struct {
 	Password  password `json:"-"`
 	CreatedAt string   `json:"created_at"`
 	IsActive  bool     `json:"is_active"`
+	IsPrivate bool     `json:"is_private"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	// SuspendedUntil is set while a moderator keeps the user from using the
+	// API.
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Website     string `json:"website"`
+	Location    string `json:"location"`
+	AvatarURL   string `json:"avatar_url"`
+
+	FollowersCount int64 `json:"followers_count"`
+	FollowingCount int64 `json:"following_count"`
+	PostsCount     int64 `json:"posts_count"`
 }
 
 type password struct {
@@ -46,7 +63,7 @@ type UsersStore struct {
 }
 
 func (s *UsersStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExpr time.Duration) error {
-	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
 		//create user
 		if err := s.Create(ctx, tx, user); err != nil {
 			return err
@@ -62,7 +79,9 @@ func (s *UsersStore) CreateAndInvite(ctx context.Context, user *User, token stri
 }
 
 func (s *UsersStore) GetByID(ctx context.Context, id int64) (*User, error) {
-	query := `SELECT users.id, users.username, users.email, users.password, users.created_at, roles.* 
+	query := `SELECT users.id, users.username, users.email, users.password, users.created_at,
+	users.is_active, users.is_private, users.display_name, users.bio, users.website, users.location, users.avatar_url,
+	users.followers_count, users.following_count, users.posts_count, users.suspended_until, roles.*
 	FROM users 
 	JOIN roles ON (users.role_id = roles.id)
 	WHERE users.id = $1 AND users.is_active = true`
@@ -72,6 +91,8 @@ func (s *UsersStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	user := &User{}
 	err := s.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt,
+		&user.IsActive, &user.IsPrivate, &user.DisplayName, &user.Bio, &user.Website, &user.Location, &user.AvatarURL,
+		&user.FollowersCount, &user.FollowingCount, &user.PostsCount, &user.SuspendedUntil,
 		&user.Role.ID, &user.Role.Name, &user.Role.Level, &user.Role.Description)
 	if err != nil {
 		switch {
@@ -103,19 +124,23 @@ func (s *UsersStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 		&user.ID,
 		&user.CreatedAt)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
-			return ErrDuplicateUsername
-		default:
-			return err
-		}
+		return uniqueUserError(err)
 	}
 
 	return nil
 }
 
+func uniqueUserError(err error) error {
+	switch {
+	case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		return ErrDuplicateEmail
+	case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+		return ErrDuplicateUsername
+	default:
+		return err
+	}
+}
+
 func (s *UsersStore) createUserInvitation(ctx context.Context,
 	tx *sql.Tx, token string, invitationExpr time.Duration, userID int64) error {
 	query := `INSERT INTO user_invetetions (token, user_id, expiry) VALUES ($1, $2, $3);`
@@ -130,12 +155,12 @@ func (s *UsersStore) createUserInvitation(ctx context.Context,
 	return nil
 }
 
-func (s *UsersStore) Activate(ctx context.Context, token string) error {
-	// find the user that this belongs to
-
-	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+func (s *UsersStore) Activate(ctx context.Context, token string) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
 		// find the user that this belongs to
-		user, err := s.getUserFromInvitation(ctx, tx, token)
+		var err error
+		user, err = s.getUserFromInvitation(ctx, tx, token)
 		if err != nil {
 			return err
 		}
@@ -153,6 +178,10 @@ func (s *UsersStore) Activate(ctx context.Context, token string) error {
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 func (s *UsersStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
@@ -160,7 +189,7 @@ func (s *UsersStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, toke
 	SELECT u.id, u.username, u.email, u.created_at, u.is_active
 	FROM users u
 	JOIN user_invetetions ui ON u.id = ui.user_id
-	WHERE ui.token = $1 AND ui.expiry <= $2
+	WHERE ui.token = $1 AND ui.expiry > $2
 	`
 	hash := sha256.Sum256([]byte(token))
 	hashToken := hex.EncodeToString(hash[:])
@@ -196,7 +225,7 @@ func (s *UsersStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 
 	_, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.IsActive, user.ID)
 	if err != nil {
-		return err
+		return uniqueUserError(err)
 	}
 	return nil
 
@@ -215,9 +244,12 @@ func (s *UsersStore) deleteInvite(ctx context.Context, tx *sql.Tx, userID int64)
 	return nil
 }
 
+// Delete removes the user together with everything they authored: their
+// posts (and the comments on them), their comments, follow relationships and
+// pending invitations, all in one transaction.
 func (s *UsersStore) Delete(ctx context.Context, userID int64) error {
-	return withTx(s.db, ctx, func(tx *sql.Tx) error {
-		if err := s.delete(ctx, tx, userID); err != nil {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := s.deleteContent(ctx, tx, userID); err != nil {
 			return err
 		}
 
@@ -225,10 +257,32 @@ func (s *UsersStore) Delete(ctx context.Context, userID int64) error {
 			return err
 		}
 
+		if err := s.delete(ctx, tx, userID); err != nil {
+			return err
+		}
+
 		return nil
 	})
 }
 
+func (s *UsersStore) deleteContent(ctx context.Context, tx *sql.Tx, userID int64) error {
+	queries := []string{
+		`DELETE FROM comments WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+		`DELETE FROM posts WHERE user_id = $1`,
+		`DELETE FROM followers WHERE user_id = $1 OR follower_id = $1`,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *UsersStore) delete(ctx context.Context, tx *sql.Tx, userID int64) error {
 	query := `DELETE FROM users WHERE id = $1;`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
@@ -241,7 +295,7 @@ func (s *UsersStore) delete(ctx context.Context, tx *sql.Tx, userID int64) error
 }
 
 func (s *UsersStore) GetByEmail(ctx context.Context, email string) (*User, error) {
-	query := `SELECT id, username, email, password, is_active 
+	query := `SELECT id, username, email, password, is_active, deletion_scheduled_at
 	FROM users
 	WHERE email = $1 AND is_active = true`
 
@@ -249,7 +303,7 @@ func (s *UsersStore) GetByEmail(ctx context.Context, email string) (*User, error
 	defer cancel()
 	user := &User{}
 	err := s.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.IsActive)
+		&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.IsActive, &user.DeletionScheduledAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -260,3 +314,210 @@ func (s *UsersStore) GetByEmail(ctx context.Context, email string) (*User, error
 	}
 	return user, nil
 }
+
+// SetPrivacy toggles the private flag. Switching back to public approves
+// every pending follow request.
+func (s *UsersStore) SetPrivacy(ctx context.Context, userID int64, isPrivate bool) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET is_private = $1 WHERE id = $2`, isPrivate, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+		if isPrivate {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		WITH approved AS (
+			DELETE FROM follow_requests WHERE user_id = $1
+			RETURNING user_id, requester_id
+		)
+		INSERT INTO followers (user_id, follower_id)
+		SELECT user_id, requester_id FROM approved
+		ON CONFLICT DO NOTHING`, userID)
+		return err
+	})
+}
+
+// EmailChange is a request to move an account to a new email address. Token
+// is the hashed verification token mailed to Email, valid for Exp.
+type EmailChange struct {
+	Email string
+	Token string
+	Exp   time.Duration
+}
+
+// UpdateProfile saves the profile fields of user. A new username is only
+// accepted once usernameCooldown has passed since the previous change. When
+// change is set, it is stored with the profile, replacing previous pending
+// requests, so that either both or neither are saved.
+func (s *UsersStore) UpdateProfile(ctx context.Context, user *User, usernameCooldown time.Duration, change *EmailChange) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		current := &User{ID: user.ID}
+		var changedAt sql.NullTime
+		err := tx.QueryRowContext(ctx, `
+		SELECT username, email, is_active, username_changed_at FROM users WHERE id = $1 FOR UPDATE`,
+			user.ID).Scan(&current.Username, &current.Email, &current.IsActive, &changedAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if current.Username != user.Username {
+			if changedAt.Valid && time.Since(changedAt.Time) < usernameCooldown {
+				return ErrUsernameCooldown
+			}
+			current.Username = user.Username
+			if err := s.update(ctx, tx, current); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE users SET username_changed_at = NOW() WHERE id = $1`, user.ID); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE users
+		SET display_name = $1, bio = $2, website = $3, location = $4, avatar_url = $5
+		WHERE id = $6`,
+			user.DisplayName, user.Bio, user.Website, user.Location, user.AvatarURL, user.ID)
+		if err != nil || change == nil {
+			return err
+		}
+		return s.requestEmailChange(ctx, tx, user.ID, change)
+	})
+}
+
+func (s *UsersStore) requestEmailChange(ctx context.Context, tx *sql.Tx, userID int64, change *EmailChange) error {
+	var taken bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, change.Email).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateEmail
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM email_verifications WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO email_verifications (token, user_id, email, expiry) VALUES ($1, $2, $3, $4)`,
+		change.Token, userID, change.Email, time.Now().Add(change.Exp))
+	return err
+}
+
+// ConfirmEmailChange moves the user to the email address the token was
+// issued for.
+func (s *UsersStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	user := &User{}
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, `
+		SELECT u.id, u.username, ev.email, u.is_active
+		FROM email_verifications ev
+		JOIN users u ON u.id = ev.user_id
+		WHERE ev.token = $1 AND ev.expiry > $2`, hashToken, time.Now()).Scan(
+			&user.ID, &user.Username, &user.Email, &user.IsActive)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM email_verifications WHERE user_id = $1`, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ScheduleDeletion marks the account for deletion at the given time.
+func (s *UsersStore) ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error {
+	query := `UPDATE users SET deletion_scheduled_at = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, at, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *UsersStore) CancelDeletion(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// GetDueForDeletion returns up to limit accounts whose grace period ended
+// before now.
+func (s *UsersStore) GetDueForDeletion(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	query := `
+	SELECT id FROM users
+	WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= $1
+	ORDER BY deletion_scheduled_at
+	LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestEmailChange(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	id := newTestUser(t, db, "user")
+	other := newTestUser(t, db, "user")
+	user, err := s.Users.GetByID(ctx, id)
+	checkErr(t, nil, err)
+	taken, err := s.Users.GetByID(ctx, other)
+	checkErr(t, nil, err)
+
+	hash := func(token string) string {
+		h := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(h[:])
+	}
+
+	t.Run("should save neither the profile nor the change for a taken email", func(t *testing.T) {
+		user.Bio = "moving"
+		change := &EmailChange{Email: taken.Email, Token: hash("taken"), Exp: time.Hour}
+		checkErr(t, ErrDuplicateEmail, s.Users.UpdateProfile(ctx, user, 0, change))
+
+		saved, err := s.Users.GetByID(ctx, id)
+		checkErr(t, nil, err)
+		if saved.Bio != "" {
+			t.Errorf("expected the profile to be left unchanged, got bio %q", saved.Bio)
+		}
+		_, err = s.Users.ConfirmEmailChange(ctx, "taken")
+		checkErr(t, ErrNotFound, err)
+	})
+
+	t.Run("should only confirm the latest change once", func(t *testing.T) {
+		for _, token := range []string{"first", "second"} {
+			change := &EmailChange{Email: "new@example.com", Token: hash(token), Exp: time.Hour}
+			checkErr(t, nil, s.Users.UpdateProfile(ctx, user, 0, change))
+		}
+
+		_, err := s.Users.ConfirmEmailChange(ctx, "first")
+		checkErr(t, ErrNotFound, err)
+		confirmed, err := s.Users.ConfirmEmailChange(ctx, "second")
+		checkErr(t, nil, err)
+		if confirmed.Email != "new@example.com" {
+			t.Errorf("expected the new email, got %q", confirmed.Email)
+		}
+		_, err = s.Users.ConfirmEmailChange(ctx, "second")
+		checkErr(t, ErrNotFound, err)
+	})
+
+	t.Run("should not confirm expired changes", func(t *testing.T) {
+		change := &EmailChange{Email: "later@example.com", Token: hash("expired"), Exp: -time.Minute}
+		checkErr(t, nil, s.Users.UpdateProfile(ctx, user, 0, change))
+		_, err := s.Users.ConfirmEmailChange(ctx, "expired")
+		checkErr(t, ErrNotFound, err)
+	})
+}
+
+func TestAccountDeletion(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	leaving := newTestUser(t, db, "user")
+	staying := newTestUser(t, db, "user")
+	other := newTestUser(t, db, "user")
+	post := newTestPost(t, db, leaving)
+	otherPost := newTestPost(t, db, other)
+	mustExec(t, db, `INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, 'mine'), ($3, $2, 'theirs')`, post, leaving, otherPost)
+	_, err := s.Followers.Follow(ctx, other, leaving)
+	checkErr(t, nil, err)
+
+	now := time.Now()
+	due := func() []int64 {
+		t.Helper()
+		ids, err := s.Users.GetDueForDeletion(ctx, now, 100)
+		checkErr(t, nil, err)
+		return ids
+	}
+	contains := func(ids []int64, id int64) bool {
+		for _, i := range ids {
+			if i == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("should only hand out accounts whose grace period is over", func(t *testing.T) {
+		checkErr(t, nil, s.Users.ScheduleDeletion(ctx, leaving, now.Add(-time.Minute)))
+		checkErr(t, nil, s.Users.ScheduleDeletion(ctx, staying, now.Add(time.Hour)))
+		checkErr(t, ErrNotFound, s.Users.ScheduleDeletion(ctx, other+1000000, now))
+
+		ids := due()
+		if !contains(ids, leaving) || contains(ids, staying) {
+			t.Errorf("expected only user %d to be due, got %v", leaving, ids)
+		}
+	})
+
+	t.Run("should cancel scheduled deletions", func(t *testing.T) {
+		checkErr(t, nil, s.Users.ScheduleDeletion(ctx, staying, now.Add(-time.Minute)))
+		checkErr(t, nil, s.Users.CancelDeletion(ctx, staying))
+		if contains(due(), staying) {
+			t.Error("expected the cancelled deletion not to be due")
+		}
+	})
+
+	t.Run("should export comments on any post and post attachments", func(t *testing.T) {
+		m := &Media{UserID: leaving, Key: "media/export/a.png", ThumbnailKey: "media/export/a_thumb.png", ContentType: "image/png", Size: 3, Width: 16, Height: 16}
+		checkErr(t, nil, s.Media.Create(ctx, m))
+		mustExec(t, db, `INSERT INTO post_attachments (post_id, media_id, position) VALUES ($1, $2, 0)`, post, m.ID)
+
+		export, err := s.Export.Export(ctx, leaving)
+		checkErr(t, nil, err)
+		if len(export.Comments) != 2 || len(export.Followers) != 1 || len(export.Media) != 1 {
+			t.Errorf("expected 2 comments, 1 follower and 1 upload, got %d, %d and %d",
+				len(export.Comments), len(export.Followers), len(export.Media))
+		}
+		if len(export.Posts) != 1 || len(export.Posts[0].Attachments) != 1 || export.Posts[0].Attachments[0].ID != m.ID {
+			t.Errorf("expected the post with its attachment, got %+v", export.Posts)
+		}
+	})
+
+	t.Run("should delete the account with its content", func(t *testing.T) {
+		checkErr(t, nil, s.Users.Delete(ctx, leaving))
+		_, err := s.Users.GetByID(ctx, leaving)
+		checkErr(t, ErrNotFound, err)
+		if contains(due(), leaving) {
+			t.Error("expected the deleted account not to be due anymore")
+		}
+
+		var comments int
+		err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM comments WHERE post_id = $1`, otherPost).Scan(&comments)
+		checkErr(t, nil, err)
+		if comments != 0 {
+			t.Errorf("expected the comments of the account to be deleted, got %d", comments)
+		}
+	})
+}
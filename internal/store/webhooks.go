@@ -0,0 +1,311 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+type Webhook struct {
+	ID           int64    `json:"id"`
+	UserID       int64    `json:"user_id"`
+	URL          string   `json:"url"`
+	Secret       string   `json:"-"`
+	Events       []string `json:"events"`
+	Global       bool     `json:"global"`
+	Active       bool     `json:"active"`
+	FailureCount int      `json:"failure_count"`
+	// DisabledAt is set when the webhook was disabled for failing.
+	DisabledAt *string `json:"disabled_at"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    *string         `json:"delivered_at"`
+
+	// URL and Secret are those of the webhook, set on claimed deliveries.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhooksStore struct {
+	db *sql.DB
+}
+
+func (s *WebhooksStore) Create(ctx context.Context, w *Webhook) error {
+	query := `
+	INSERT INTO webhooks (user_id, url, secret, events, global)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, active, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, w.UserID, w.URL, w.Secret, pq.Array(w.Events), w.Global).Scan(
+		&w.ID, &w.Active, &w.CreatedAt)
+}
+
+const webhookColumns = `id, user_id, url, secret, events, global, active, failure_count, disabled_at, created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }, w *Webhook) error {
+	var disabledAt sql.NullString
+	err := row.Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.Global, &w.Active,
+		&w.FailureCount, &disabledAt, &w.CreatedAt)
+	if disabledAt.Valid {
+		w.DisabledAt = &disabledAt.String
+	}
+	return err
+}
+
+// GetByID returns a webhook of userID.
+func (s *WebhooksStore) GetByID(ctx context.Context, id, userID int64) (*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var w Webhook
+	if err := scanWebhook(s.db.QueryRowContext(ctx, query, id, userID), &w); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *WebhooksStore) GetByUserID(ctx context.Context, userID int64) ([]Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = $1 ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// Update saves the URL, events and active state of a webhook. Activating
+// it again resets its failures.
+func (s *WebhooksStore) Update(ctx context.Context, w *Webhook) error {
+	query := `
+	UPDATE webhooks SET url = $3, events = $4, active = $5,
+		failure_count = CASE WHEN $5 AND NOT active THEN 0 ELSE failure_count END,
+		disabled_at = CASE WHEN $5 THEN NULL ELSE disabled_at END
+	WHERE id = $1 AND user_id = $2
+	RETURNING failure_count, disabled_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	var disabledAt sql.NullString
+	err := s.db.QueryRowContext(ctx, query, w.ID, w.UserID, w.URL, pq.Array(w.Events), w.Active).Scan(
+		&w.FailureCount, &disabledAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	w.DisabledAt = nil
+	if disabledAt.Valid {
+		w.DisabledAt = &disabledAt.String
+	}
+	return nil
+}
+
+func (s *WebhooksStore) Delete(ctx context.Context, id, userID int64) error {
+	query := `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Enqueue queues payload for the active webhooks subscribed to event that
+// are global or owned by one of ownerIDs, within the transaction of ctx if
+// there is one.
+func (s *WebhooksStore) Enqueue(ctx context.Context, event string, ownerIDs []int64, payload []byte) error {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, event, payload)
+	SELECT w.id, $1, $3::jsonb FROM webhooks w
+	WHERE w.active AND w.events @> ARRAY[$1]::varchar[] AND (w.global OR w.user_id = ANY($2::bigint[]))`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, event, pq.Array(ownerIDs), string(payload))
+	return err
+}
+
+// ClaimDeliveries returns up to limit due deliveries of active webhooks and
+// leases them for lease: a worker that dies mid-delivery leaves them to be
+// claimed again once the lease ends.
+func (s *WebhooksStore) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	query := `
+	UPDATE webhook_deliveries d SET next_attempt_at = NOW() + make_interval(secs => $2)
+	FROM webhooks w
+	WHERE w.id = d.webhook_id AND d.id IN (
+		SELECT dd.id FROM webhook_deliveries dd
+		JOIN webhooks ww ON ww.id = dd.webhook_id
+		WHERE dd.status = 'pending' AND dd.next_attempt_at <= NOW() AND ww.active
+		ORDER BY dd.next_attempt_at
+		LIMIT $1
+		FOR UPDATE OF dd SKIP LOCKED)
+	RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordSuccess marks a delivery as delivered and clears the failures of
+// its webhook.
+func (s *WebhooksStore) RecordSuccess(ctx context.Context, d *WebhookDelivery, statusCode int) error {
+	return withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status = 'succeeded', attempts = attempts + 1,
+			last_status_code = $2, last_error = '', delivered_at = NOW()
+		WHERE id = $1`, d.ID, statusCode)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE webhooks SET failure_count = 0 WHERE id = $1`, d.WebhookID)
+		return err
+	})
+}
+
+// RecordFailure counts a failed attempt of a delivery, to be retried at
+// retryAt or given up when retryAt is nil. The webhook is disabled once it
+// failed disableAfter times in a row; whether this failure disabled it is
+// reported.
+func (s *WebhooksStore) RecordFailure(ctx context.Context, d *WebhookDelivery, statusCode int, reason string, retryAt *time.Time, disableAfter int) (bool, error) {
+	var disabled bool
+	err := withTx(s.db, ctx, func(ctx context.Context, tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+		defer cancel()
+
+		status := "failed"
+		next := time.Now()
+		if retryAt != nil {
+			status = "pending"
+			next = *retryAt
+		}
+		_, err := tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, next_attempt_at = $3,
+			last_status_code = $4, last_error = $5
+		WHERE id = $1`, d.ID, status, next, sql.NullInt64{Int64: int64(statusCode), Valid: statusCode != 0}, reason)
+		if err != nil {
+			return err
+		}
+
+		// RETURNING only sees the new row, so the old state is read first
+		// to tell webhooks disabled here from ones paused by their owner.
+		return tx.QueryRowContext(ctx, `
+		UPDATE webhooks w SET failure_count = w.failure_count + 1,
+			active = w.active AND w.failure_count + 1 < $2,
+			disabled_at = CASE WHEN w.active AND w.failure_count + 1 >= $2 THEN NOW() ELSE w.disabled_at END
+		FROM (SELECT id, active FROM webhooks WHERE id = $1 FOR UPDATE) old
+		WHERE w.id = old.id
+		RETURNING old.active AND NOT w.active`, d.WebhookID, disableAfter).Scan(&disabled)
+	})
+	return disabled, err
+}
+
+// GetDeliveries lists the deliveries of a webhook, latest first.
+func (s *WebhooksStore) GetDeliveries(ctx context.Context, webhookID int64, page PaginationQuery) ([]WebhookDelivery, error) {
+	query := `
+	SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code,
+		last_error, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE webhook_id = $1
+	ORDER BY id DESC
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDelay)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, webhookID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var (
+			d           WebhookDelivery
+			statusCode  sql.NullInt64
+			deliveredAt sql.NullString
+		)
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&statusCode, &d.LastError, &d.CreatedAt, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			d.LastStatusCode = &code
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.String
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWebhookFailures(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	owner := newTestUser(t, db, "user")
+	newDelivery := func(w *Webhook) *WebhookDelivery {
+		t.Helper()
+		d := &WebhookDelivery{WebhookID: w.ID}
+		err := db.QueryRowContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload) VALUES ($1, 'post.created', '{}')
+		RETURNING id`, w.ID).Scan(&d.ID)
+		checkErr(t, nil, err)
+		return d
+	}
+	fail := func(w *Webhook) bool {
+		t.Helper()
+		retryAt := time.Now().Add(time.Minute)
+		disabled, err := s.Webhooks.RecordFailure(ctx, newDelivery(w), 500, "server error", &retryAt, 2)
+		checkErr(t, nil, err)
+		return disabled
+	}
+
+	t.Run("should report disabling a failing webhook once", func(t *testing.T) {
+		w := &Webhook{UserID: owner, URL: "https://example.com/hook", Secret: "s", Events: []string{"post.created"}}
+		checkErr(t, nil, s.Webhooks.Create(ctx, w))
+
+		for i, want := range []bool{false, true, false} {
+			if got := fail(w); got != want {
+				t.Errorf("failure %d: expected disabled %t, got %t", i+1, want, got)
+			}
+		}
+	})
+
+	t.Run("should not report webhooks paused by their owner", func(t *testing.T) {
+		w := &Webhook{UserID: owner, URL: "https://example.com/paused", Secret: "s", Events: []string{"post.created"}}
+		checkErr(t, nil, s.Webhooks.Create(ctx, w))
+		w.Active = false
+		checkErr(t, nil, s.Webhooks.Update(ctx, w))
+
+		for i := 0; i < 3; i++ {
+			if fail(w) {
+				t.Errorf("failure %d: expected a paused webhook not to be reported as disabled", i+1)
+			}
+		}
+	})
+}
+
+func TestEnqueueInTx(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStorage(db)
+	ctx := context.Background()
+
+	owner := newTestUser(t, db, "user")
+	w := &Webhook{UserID: owner, URL: "https://example.com/hook", Secret: "s", Events: []string{"post.deleted"}}
+	checkErr(t, nil, s.Webhooks.Create(ctx, w))
+	count := func() int {
+		t.Helper()
+		var n int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = $1`, w.ID).Scan(&n)
+		checkErr(t, nil, err)
+		return n
+	}
+	deleteAndEnqueue := func(postID int64, fail error) error {
+		return s.InTx(ctx, func(ctx context.Context) error {
+			if err := s.Posts.Delete(ctx, postID); err != nil {
+				return err
+			}
+			if err := s.Webhooks.Enqueue(ctx, "post.deleted", []int64{owner}, []byte(`{}`)); err != nil {
+				return err
+			}
+			return fail
+		})
+	}
+
+	t.Run("should roll back the change and its deliveries together", func(t *testing.T) {
+		postID := newTestPost(t, db, owner)
+		checkErr(t, ErrConflict, deleteAndEnqueue(postID, ErrConflict))
+
+		if n := count(); n != 0 {
+			t.Errorf("expected no deliveries, got %d", n)
+		}
+		_, err := s.Posts.GetByID(ctx, postID)
+		checkErr(t, nil, err)
+	})
+
+	t.Run("should commit the change and its deliveries together", func(t *testing.T) {
+		postID := newTestPost(t, db, owner)
+		checkErr(t, nil, deleteAndEnqueue(postID, nil))
+
+		if n := count(); n != 1 {
+			t.Errorf("expected 1 delivery, got %d", n)
+		}
+		_, err := s.Posts.GetByID(ctx, postID)
+		checkErr(t, ErrNotFound, err)
+	})
+}
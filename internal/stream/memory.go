@@ -0,0 +1,175 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// MaxConnsPerUser caps the clients one user has connected to this
+	// process.
+	MaxConnsPerUser int
+	// Buffer is how many events a client may fall behind before it is
+	// disconnected.
+	Buffer int
+	// Replay is how long events are kept for clients resuming with
+	// Last-Event-ID.
+	Replay time.Duration
+}
+
+// maxReplayEvents caps the events kept for replay per user.
+const maxReplayEvents = 256
+
+type bufferedEvent struct {
+	Event
+	at time.Time
+}
+
+// MemoryHub delivers events to the clients connected to this process.
+type MemoryHub struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	seq       uint64
+	subs      map[int64]map[*Subscription]struct{}
+	recent    map[int64][]bufferedEvent
+	lastSweep time.Time
+	closed    bool
+}
+
+func NewMemoryHub(cfg Config) *MemoryHub {
+	return &MemoryHub{
+		cfg:    cfg,
+		now:    time.Now,
+		subs:   map[int64]map[*Subscription]struct{}{},
+		recent: map[int64][]bufferedEvent{},
+	}
+}
+
+func (h *MemoryHub) Publish(ctx context.Context, userID int64, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.seq++
+	id := h.seq
+	h.mu.Unlock()
+
+	h.Deliver(Event{ID: id, UserID: userID, Type: eventType, Data: payload})
+	return nil
+}
+
+// Deliver buffers e for replay and hands it to the clients of its user.
+// Clients too far behind to take it are disconnected.
+func (h *MemoryHub) Deliver(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+
+	now := h.now()
+	h.sweep(now)
+	recent := append(h.recent[e.UserID], bufferedEvent{Event: e, at: now})
+	if len(recent) > maxReplayEvents {
+		recent = recent[len(recent)-maxReplayEvents:]
+	}
+	h.recent[e.UserID] = recent
+	if e.ID > h.seq {
+		h.seq = e.ID
+	}
+
+	for sub := range h.subs[e.UserID] {
+		select {
+		case sub.c <- e:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+func (h *MemoryHub) Subscribe(userID int64, lastEventID uint64) (*Subscription, []Event, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, nil, ErrClosed
+	}
+	if len(h.subs[userID]) >= h.cfg.MaxConnsPerUser {
+		return nil, nil, ErrTooManyConnections
+	}
+
+	c := make(chan Event, h.cfg.Buffer)
+	sub := &Subscription{C: c, c: c, userID: userID, hub: h}
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*Subscription]struct{}{}
+	}
+	h.subs[userID][sub] = struct{}{}
+
+	var replay []Event
+	if lastEventID > 0 {
+		cutoff := h.now().Add(-h.cfg.Replay)
+		for _, e := range h.recent[userID] {
+			if e.ID > lastEventID && !e.at.Before(cutoff) {
+				replay = append(replay, e.Event)
+			}
+		}
+	}
+	return sub, replay, nil
+}
+
+func (h *MemoryHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+func (h *MemoryHub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// remove must be called with h.mu held.
+func (h *MemoryHub) remove(sub *Subscription) {
+	subs := h.subs[sub.userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.userID)
+	}
+	close(sub.c)
+}
+
+// sweep drops the events too old to replay, at most once a minute. It must
+// be called with h.mu held.
+func (h *MemoryHub) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < time.Minute {
+		return
+	}
+	h.lastSweep = now
+
+	cutoff := now.Add(-h.cfg.Replay)
+	for userID, events := range h.recent {
+		i := 0
+		for i < len(events) && events[i].at.Before(cutoff) {
+			i++
+		}
+		if i == len(events) {
+			delete(h.recent, userID)
+		} else if i > 0 {
+			h.recent[userID] = append([]bufferedEvent(nil), events[i:]...)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryHub(t *testing.T) {
+	ctx := context.Background()
+	hub := NewMemoryHub(Config{MaxConnsPerUser: 2, Buffer: 2, Replay: time.Minute})
+
+	sub, replay, err := hub.Subscribe(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replay) != 0 {
+		t.Fatalf("expected no replay, got %v", replay)
+	}
+
+	t.Run("delivers events to their user only", func(t *testing.T) {
+		if err := hub.Publish(ctx, 2, EventPost, map[string]int{"post_id": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := hub.Publish(ctx, 1, EventPost, map[string]int{"post_id": 2}); err != nil {
+			t.Fatal(err)
+		}
+
+		e := <-sub.C
+		if e.ID != 2 || e.Type != EventPost || string(e.Data) != `{"post_id":2}` {
+			t.Errorf("unexpected event %+v", e)
+		}
+	})
+
+	t.Run("replays events after the last event ID", func(t *testing.T) {
+		_ = hub.Publish(ctx, 1, EventFollow, nil)
+		_, replay, err := hub.Subscribe(1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(replay) != 1 || replay[0].ID != 3 {
+			t.Errorf("expected event 3 to be replayed, got %+v", replay)
+		}
+	})
+
+	t.Run("limits connections per user", func(t *testing.T) {
+		if _, _, err := hub.Subscribe(1, 0); err != ErrTooManyConnections {
+			t.Errorf("expected ErrTooManyConnections, got %v", err)
+		}
+	})
+
+	t.Run("disconnects clients that fall behind", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_ = hub.Publish(ctx, 1, EventPost, nil)
+		}
+		n := 0
+		for range sub.C {
+			n++
+		}
+		if n != 2 {
+			t.Errorf("expected the 2 buffered events before the close, got %d", n)
+		}
+	})
+
+	t.Run("closes subscriptions on Close", func(t *testing.T) {
+		hub.Close()
+		if _, _, err := hub.Subscribe(3, 0); err != ErrClosed {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisChannel = "stream:events"
+	redisSeqKey  = "stream:seq"
+)
+
+// RedisHub shares events between the processes of a deployment over Redis
+// pub/sub. Every process receives every event and delivers it to its own
+// clients through a MemoryHub, which also keeps it for replay.
+type RedisHub struct {
+	*MemoryHub
+	client *redis.Client
+}
+
+func NewRedisHub(client *redis.Client, cfg Config) *RedisHub {
+	return &RedisHub{MemoryHub: NewMemoryHub(cfg), client: client}
+}
+
+func (h *RedisHub) Publish(ctx context.Context, userID int64, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// IDs come from Redis so they increase across processes.
+	id, err := h.client.Incr(ctx, redisSeqKey).Uint64()
+	if err != nil {
+		return err
+	}
+
+	msg, err := json.Marshal(Event{ID: id, UserID: userID, Type: eventType, Data: payload})
+	if err != nil {
+		return err
+	}
+	return h.client.Publish(ctx, redisChannel, msg).Err()
+}
+
+// Run receives the events published by every process until ctx is
+// cancelled. The client resubscribes by itself when the connection drops;
+// events published meanwhile are lost.
+func (h *RedisHub) Run(ctx context.Context, onError func(error)) {
+	pubsub := h.client.Subscribe(ctx, redisChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				onError(err)
+				continue
+			}
+			h.Deliver(e)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Package stream delivers real-time events to the connected clients of a
+// user.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrTooManyConnections = errors.New("too many connections")
+	ErrClosed             = errors.New("hub closed")
+)
+
+const (
+	EventPost          = "post"
+	EventComment       = "comment"
+	EventFollow        = "follow"
+	EventFollowRequest = "follow_request"
+	EventNotification  = "notification"
+	EventMessage       = "message"
+)
+
+// Event is addressed to one user. IDs increase with every published event,
+// so clients resume from the last ID they saw.
+type Event struct {
+	ID     uint64          `json:"id"`
+	UserID int64           `json:"user_id"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type Hub interface {
+	// Publish sends an event of kind eventType carrying data, encoded as
+	// JSON, to the connected clients of userID.
+	Publish(ctx context.Context, userID int64, eventType string, data any) error
+	// Subscribe connects a client of userID. Events published after
+	// lastEventID that are still buffered are returned for replay before
+	// anything is delivered on the subscription.
+	Subscribe(userID int64, lastEventID uint64) (*Subscription, []Event, error)
+	// Close disconnects every client and rejects new ones.
+	Close()
+}
+
+// Subscription receives the events of one connected client. C is closed
+// when the subscription ends, either by Close, by the hub closing, or
+// because the client fell too far behind; it should then reconnect with
+// the last event ID it received.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	userID int64
+	hub    *MemoryHub
+}
+
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
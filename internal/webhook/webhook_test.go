@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"post.created"}`)
+	sig := Sign("secret", now.Unix(), body)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	if err := Verify("secret", ts, sig, body, time.Minute, now); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	tests := map[string]struct {
+		secret, ts, sig string
+		body            []byte
+		now             time.Time
+	}{
+		"wrong secret":    {"other", ts, sig, body, now},
+		"tampered body":   {"secret", ts, sig, []byte(`{}`), now},
+		"replayed":        {"secret", ts, sig, body, now.Add(time.Hour)},
+		"bad timestamp":   {"secret", "abc", sig, body, now},
+		"moved timestamp": {"secret", strconv.FormatInt(now.Unix()+1, 10), sig, body, now},
+	}
+	for name, tt := range tests {
+		if err := Verify(tt.secret, tt.ts, tt.sig, tt.body, time.Minute, tt.now); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 30*time.Second, time.Hour
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, w := range want {
+		if got := Backoff(i+1, base, max); got != w {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, w, got)
+		}
+	}
+	if got := Backoff(20, base, max); got != max {
+		t.Errorf("expected the backoff to be capped at %v, got %v", max, got)
+	}
+}
+
+func TestSender(t *testing.T) {
+	var status = http.StatusOK
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	d := Delivery{ID: 7, Event: EventPostCreated, URL: receiver.URL, Secret: "secret", Payload: []byte(`{"id":1}`)}
+
+	t.Run("should sign deliveries", func(t *testing.T) {
+		code, err := NewSender(time.Second, true).Send(context.Background(), d)
+		if err != nil || code != http.StatusOK {
+			t.Fatalf("expected a delivery, got %d %v", code, err)
+		}
+		if received.Header.Get(HeaderEvent) != EventPostCreated || received.Header.Get(HeaderDelivery) != "7" {
+			t.Errorf("unexpected headers %v", received.Header)
+		}
+		err = Verify("secret", received.Header.Get(HeaderTimestamp), received.Header.Get(HeaderSignature), body, time.Minute, time.Now())
+		if err != nil {
+			t.Errorf("expected the receiver to verify the signature, got %v", err)
+		}
+	})
+
+	t.Run("should fail on error responses", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		defer func() { status = http.StatusOK }()
+		code, err := NewSender(time.Second, true).Send(context.Background(), d)
+		if err == nil || code != http.StatusInternalServerError {
+			t.Errorf("expected a failed delivery, got %d %v", code, err)
+		}
+	})
+
+	t.Run("should refuse private addresses", func(t *testing.T) {
+		_, err := NewSender(time.Second, false).Send(context.Background(), d)
+		if !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("expected ErrPrivateAddress, got %v", err)
+		}
+	})
+}